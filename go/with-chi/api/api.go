@@ -6,6 +6,8 @@ import (
 	"log"
 	"net/http"
 	"node-week-02-with-chi/handlers"
+	"node-week-02-with-chi/store"
+	"node-week-02-with-chi/webhook"
 	"os"
 	"os/signal"
 	"syscall"
@@ -15,12 +17,29 @@ import (
 type APIServer struct {
 	Addr    string
 	Handler *handlers.MessageHandler
+	Events  *store.Broker
+	// Webhooks delivers Events to subscribed URLs.
+	Webhooks *webhook.Dispatcher
+	// AdminToken guards the admin routes; empty disables them.
+	AdminToken string
 }
 
-func NewAPIServer(addr string) *APIServer {
+// eventHistory is how many recent events clients can catch up on.
+const eventHistory = 1024
+
+func NewAPIServer(addr string, messageStore store.MessageStore) *APIServer {
+	events := store.NewBroker(eventHistory)
+	handler := handlers.New(store.NewNotifyingStore(messageStore, events))
+	handler.Events = events
+
+	webhooks := webhook.NewDispatcher(webhook.Options{})
+	webhooks.Start(events)
+
 	return &APIServer{
-		Addr:    addr,
-		Handler: handlers.New(),
+		Addr:     addr,
+		Handler:  handler,
+		Events:   events,
+		Webhooks: webhooks,
 	}
 }
 
@@ -32,6 +51,10 @@ func (s *APIServer) Run() error {
 	srv := http.Server{
 		Addr: s.Addr, Handler: router,
 	}
+	// Streaming handlers only return once their subscription closes.
+	srv.RegisterOnShutdown(s.Events.Close)
+	srv.RegisterOnShutdown(s.Handler.Close)
+	srv.RegisterOnShutdown(s.Webhooks.Close)
 
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
@@ -51,6 +74,10 @@ func (s *APIServer) Run() error {
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Fatalf("error: %v\n", err)
 	}
+	// Shutdown does not track hijacked WebSocket connections.
+	if err := s.Handler.WaitForSockets(ctx); err != nil {
+		log.Printf("WebSockets still open: %v\n", err)
+	}
 
 	fmt.Println("Server gracefully stopped")
 
@@ -3,6 +3,7 @@ package api
 import (
 	_ "node-week-02-with-chi/docs"
 	"node-week-02-with-chi/handlers"
+	"node-week-02-with-chi/utils"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -12,20 +13,72 @@ import (
 func (s *APIServer) Routes() chi.Router {
 	router := chi.NewRouter()
 	router.Use(middleware.Logger)
+	router.Use(utils.Timer)
 	router.Use(middleware.SetHeader("Content-Type", "application/json"))
 
-	messageHandler := handlers.New()
+	messageHandler := s.Handler
 	router.Get("/swagger/*", httpSwagger.Handler(httpSwagger.URL("/swagger/doc.json")))
 	router.Route("/api/v1/messages", func(r chi.Router) {
 		r.Get("/", messageHandler.GetAllMessages)
 		r.Post("/", messageHandler.CreateMessage)
 		r.Get("/latest", messageHandler.GetLatestMessages)
 		r.Get("/search", messageHandler.GetSearchedMessages)
+		r.Get("/poll", messageHandler.PollMessages)
+		r.Get("/stream", messageHandler.StreamMessages)
+		r.Get("/ws", messageHandler.ChatSocket)
 		r.Get("/swagger/*", httpSwagger.Handler(httpSwagger.URL("/swagger/doc.json")))
 
 		r.Get("/{messageId}", messageHandler.GetMessage)
 		r.Put("/{messageId}", messageHandler.UpdateMessage)
+		r.Patch("/{messageId}", messageHandler.PatchMessage)
 		r.Delete("/{messageId}", messageHandler.DeleteMessage)
+		r.With(utils.RequireBearer(s.AdminToken)).Post("/{messageId}/restore", messageHandler.RestoreMessage)
+		r.Get("/{messageId}/replies", messageHandler.GetReplies)
+		r.Get("/{messageId}/revisions", messageHandler.GetRevisions)
+		r.Post("/{messageId}/reactions/{emoji}", messageHandler.AddReaction)
+		r.Delete("/{messageId}/reactions/{emoji}", messageHandler.RemoveReaction)
+	})
+
+	roomHandler := handlers.NewRoomHandler(messageHandler.Store)
+	router.Route("/api/v1/rooms", func(r chi.Router) {
+		r.Get("/", roomHandler.ListRooms)
+		r.Post("/", roomHandler.CreateRoom)
+
+		r.Route("/{roomId}", func(r chi.Router) {
+			r.Get("/", roomHandler.GetRoom)
+			r.Put("/", roomHandler.UpdateRoom)
+			r.Delete("/", roomHandler.DeleteRoom)
+
+			r.Route("/messages", func(r chi.Router) {
+				r.Get("/", messageHandler.ListRoomMessages)
+				r.Post("/", messageHandler.CreateRoomMessage)
+				r.Get("/latest", messageHandler.GetLatestRoomMessages)
+				r.Get("/search", messageHandler.SearchRoomMessages)
+				r.Get("/poll", messageHandler.PollRoomMessages)
+
+				r.Get("/{messageId}", messageHandler.GetRoomMessage)
+				r.Put("/{messageId}", messageHandler.UpdateRoomMessage)
+				r.Patch("/{messageId}", messageHandler.PatchRoomMessage)
+				r.Delete("/{messageId}", messageHandler.DeleteRoomMessage)
+				r.Get("/{messageId}/replies", messageHandler.GetRoomMessageReplies)
+				r.Get("/{messageId}/revisions", messageHandler.GetRoomMessageRevisions)
+				r.Post("/{messageId}/reactions/{emoji}", messageHandler.AddRoomMessageReaction)
+				r.Delete("/{messageId}/reactions/{emoji}", messageHandler.RemoveRoomMessageReaction)
+			})
+		})
+	})
+
+	webhookHandler := handlers.NewWebhookHandler(s.Webhooks)
+	router.Route("/api/v1/webhooks", func(r chi.Router) {
+		r.Use(utils.RequireBearer(s.AdminToken))
+		r.Get("/", webhookHandler.ListWebhooks)
+		r.Post("/", webhookHandler.CreateWebhook)
+		r.Get("/dead-letters", webhookHandler.ListDeadLetters)
+		r.Post("/dead-letters/{deliveryId}/retry", webhookHandler.RetryDeadLetter)
+
+		r.Get("/{webhookId}", webhookHandler.GetWebhook)
+		r.Delete("/{webhookId}", webhookHandler.DeleteWebhook)
+		r.Get("/{webhookId}/deliveries", webhookHandler.ListWebhookDeliveries)
 	})
 
 	return router
@@ -0,0 +1,153 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"node-week-02-with-chi/store"
+	"node-week-02-with-chi/utils"
+)
+
+// TestRoutesConcurrentAccess hammers every message route from many
+// goroutines at once. Run with -race to check the store's locking.
+func TestRoutesConcurrentAccess(t *testing.T) {
+	server := NewAPIServer(":0", store.NewMemoryStore())
+	ts := httptest.NewServer(server.Routes())
+	defer ts.Close()
+
+	const (
+		workers    = 16
+		iterations = 25
+	)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*iterations)
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				if err := exerciseRoutes(ts.URL, worker, i); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(w)
+	}
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func exerciseRoutes(baseURL string, worker, i int) error {
+	body, _ := json.Marshal(store.CreateMessageRequest{
+		From: fmt.Sprintf("worker-%d", worker),
+		Text: fmt.Sprintf("message %d", i),
+	})
+	resp, err := http.Post(baseURL+"/api/v1/messages", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	var created utils.Response[store.Message]
+	err = json.NewDecoder(resp.Body).Decode(&created)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("create: status %d", resp.StatusCode)
+	}
+
+	messageURL := baseURL + "/api/v1/messages/" + created.Data.ID
+	requests := []struct {
+		method, url string
+		body        []byte
+	}{
+		{http.MethodGet, baseURL + "/api/v1/messages", nil},
+		{http.MethodGet, baseURL + "/api/v1/messages/latest", nil},
+		{http.MethodGet, baseURL + "/api/v1/messages/search?text=message", nil},
+		{http.MethodGet, baseURL + "/api/v1/messages/poll?timeout=0s", nil},
+		{http.MethodGet, baseURL + "/api/v1/rooms", nil},
+		{http.MethodGet, baseURL + "/api/v1/rooms/general/messages/latest", nil},
+		{http.MethodGet, messageURL, nil},
+		{http.MethodGet, messageURL + "/replies", nil},
+		{http.MethodGet, messageURL + "/revisions", nil},
+		{http.MethodPost, messageURL + "/reactions/%F0%9F%91%8D", []byte(`{"user":"worker"}`)},
+		{http.MethodDelete, messageURL + "/reactions/%F0%9F%91%8D?user=worker", nil},
+		{http.MethodPut, messageURL, body},
+		{http.MethodPatch, messageURL, body},
+		{http.MethodDelete, messageURL, nil},
+		{http.MethodPost, messageURL + "/restore", nil},
+	}
+
+	for _, r := range requests {
+		req, _ := http.NewRequest(r.method, r.url, bytes.NewReader(r.body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return fmt.Errorf("%s %s: status %d", r.method, r.url, resp.StatusCode)
+		}
+	}
+	return nil
+}
+
+// Testing the webhook routes are admin-only
+func TestWebhookRoutesRequireAdminToken(t *testing.T) {
+	server := NewAPIServer(":0", store.NewMemoryStore())
+	server.AdminToken = "let-me-in"
+	ts := httptest.NewServer(server.Routes())
+	defer ts.Close()
+
+	base := ts.URL + "/api/v1/webhooks"
+	for _, r := range []struct{ method, url, body string }{
+		{http.MethodGet, base, ""},
+		{http.MethodPost, base, `{"url":"https://example.com/hook"}`},
+		{http.MethodGet, base + "/dead-letters", ""},
+		{http.MethodPost, base + "/dead-letters/1/retry", ""},
+		{http.MethodGet, base + "/1", ""},
+		{http.MethodDelete, base + "/1", ""},
+		{http.MethodGet, base + "/1/deliveries", ""},
+	} {
+		for token, want := range map[string]int{"": http.StatusUnauthorized, "wrong": http.StatusUnauthorized} {
+			req, _ := http.NewRequest(r.method, r.url, bytes.NewBufferString(r.body))
+			req.Header.Set("Content-Type", "application/json")
+			if token != "" {
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != want {
+				t.Errorf("%s %s with token %q: expected status %d, got %d", r.method, r.url, token, want, resp.StatusCode)
+			}
+		}
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, base, nil)
+	req.Header.Set("Authorization", "Bearer let-me-in")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status 200 with the admin token, got %d", resp.StatusCode)
+	}
+}
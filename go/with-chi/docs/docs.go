@@ -17,7 +17,7 @@ const docTemplate = `{
     "paths": {
         "/messages": {
             "get": {
-                "description": "Return a list of all messages in the app",
+                "description": "Return a page of messages, oldest first unless sort says otherwise. Follow the opaque\n\"next\" and \"prev\" cursors in the response with the after and before parameters to walk\nthe list; cursors stay valid while other clients add or delete messages, but only with\nthe same sort. from, since and until narrow the list down and fields picks the fields\nreturned for each message.",
                 "produces": [
                     "application/json"
                 ],
@@ -25,23 +25,103 @@ const docTemplate = `{
                     "messages"
                 ],
                 "summary": "Get all messages",
+                "parameters": [
+                    {
+                        "maximum": 200,
+                        "minimum": 1,
+                        "type": "integer",
+                        "default": 50,
+                        "description": "Page size",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cursor: return messages after this position",
+                        "name": "after",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cursor: return messages before this position",
+                        "name": "before",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only messages from this sender",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only messages sent at or after this date or RFC 3339 time",
+                        "name": "since",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only messages sent before this date or RFC 3339 time",
+                        "name": "until",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "id",
+                            "time_sent",
+                            "-time_sent"
+                        ],
+                        "type": "string",
+                        "default": "id",
+                        "description": "Order of the messages",
+                        "name": "sort",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Comma-separated message fields to return, e.g. id,from,text",
+                        "name": "fields",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag of a previous response; 304 if the list is unchanged",
+                        "name": "If-None-Match",
+                        "in": "header"
+                    }
+                ],
                 "responses": {
                     "200": {
                         "description": "message list",
                         "schema": {
                             "$ref": "#/definitions/utils.Response-array_store_Message"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Tag of this list, for If-None-Match"
+                            }
+                        }
+                    },
+                    "304": {
+                        "description": "Not Modified - the list still matches If-None-Match"
+                    },
+                    "400": {
+                        "description": "Invalid query parameters",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
                         }
                     },
                     "500": {
                         "description": "Internal server error",
                         "schema": {
-                            "$ref": "#/definitions/utils.ErrorResponse"
+                            "$ref": "#/definitions/utils.Problem"
                         }
                     }
                 }
             },
             "post": {
-                "description": "Create a new message and add it to the system",
+                "description": "Create a new message and add it to the system. Set parent_id to reply to another\nmessage in the same room.",
                 "consumes": [
                     "application/json"
                 ],
@@ -68,18 +148,36 @@ const docTemplate = `{
                         "description": "Successful creation of message",
                         "schema": {
                             "$ref": "#/definitions/utils.Response-store_Message"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Tag of the message's version, reactions and replies, for If-Match"
+                            }
                         }
                     },
                     "400": {
-                        "description": "Invalid request",
+                        "description": "Invalid request, or parent_id names no message in this room",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "413": {
+                        "description": "Request body too large",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "415": {
+                        "description": "Content-Type is not application/json",
                         "schema": {
-                            "$ref": "#/definitions/utils.ErrorResponse"
+                            "$ref": "#/definitions/utils.Problem"
                         }
                     },
                     "500": {
                         "description": "Internal server error",
                         "schema": {
-                            "$ref": "#/definitions/utils.ErrorResponse"
+                            "$ref": "#/definitions/utils.Problem"
                         }
                     }
                 }
@@ -87,25 +185,115 @@ const docTemplate = `{
         },
         "/messages/latest": {
             "get": {
-                "description": "Return the latest 10 messages",
+                "description": "Return the latest messages by time sent: 10 unless limit says otherwise, oldest first\nunless order is desc.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "messages"
+                ],
+                "summary": "Get the latest messages",
+                "parameters": [
+                    {
+                        "maximum": 200,
+                        "minimum": 1,
+                        "type": "integer",
+                        "default": 10,
+                        "description": "How many messages to return",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "asc",
+                            "desc"
+                        ],
+                        "type": "string",
+                        "default": "asc",
+                        "description": "asc for oldest first, desc for newest first",
+                        "name": "order",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag of a previous response; 304 if the list is unchanged",
+                        "name": "If-None-Match",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "the latest messages",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Response-array_store_Message"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Tag of this list, for If-None-Match"
+                            }
+                        }
+                    },
+                    "304": {
+                        "description": "Not Modified - the list still matches If-None-Match"
+                    },
+                    "400": {
+                        "description": "Invalid limit or order",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/messages/poll": {
+            "get": {
+                "description": "Wait until messages newer than since exist, then return them oldest first, at most 200 at a\ntime. Returns an empty list once the timeout elapses. Poll again with the \"next\" link,\nwhich carries the ID of the newest message seen. Without since, returns the oldest messages.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
                     "messages"
                 ],
-                "summary": "Get the latest 10 messages",
+                "summary": "Long-poll for new messages",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID of the newest message the client already has",
+                        "name": "since",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "default": "30s",
+                        "description": "How long to wait, as a duration like 30s or a number of seconds",
+                        "name": "timeout",
+                        "in": "query"
+                    }
+                ],
                 "responses": {
                     "200": {
-                        "description": "the latest 10 messages list",
+                        "description": "new messages, possibly none",
                         "schema": {
                             "$ref": "#/definitions/utils.Response-array_store_Message"
                         }
                     },
+                    "400": {
+                        "description": "Invalid poll parameters",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
                     "500": {
                         "description": "Internal server error",
                         "schema": {
-                            "$ref": "#/definitions/utils.ErrorResponse"
+                            "$ref": "#/definitions/utils.Problem"
                         }
                     }
                 }
@@ -113,46 +301,136 @@ const docTemplate = `{
         },
         "/messages/search": {
             "get": {
-                "description": "Return the messages that has searched if matched",
+                "description": "Return a page of the messages matching text, most relevant first by BM25 score, or an\nempty page if none do. Words are matched whole, ignoring case and accents, and every\npart of text must match:\n\"green tea\" for a phrase, tea OR coffee for either word, -milk to exclude a word or\nphrase, from:ann (or from:\"Ann Lee\") for a sender, before:2026-01-01 and\nafter:2026-01-01 for when it was sent (a date or RFC 3339 time), and has:reply or\nhas:reaction. Filters and exclusions need a word to go with them, and can be negated\nbut not joined with OR. highlight is the HTML-escaped text with the matches in \u003cmark\u003e\ntags.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
                     "messages"
                 ],
-                "summary": "Get the messages that has searched if matched",
+                "summary": "Search messages",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Text to search for in messages",
+                        "description": "What to search for, e.g. green tea OR coffee -milk from:ann",
                         "name": "text",
                         "in": "query",
                         "required": true
+                    },
+                    {
+                        "maximum": 200,
+                        "minimum": 1,
+                        "type": "integer",
+                        "default": 50,
+                        "description": "Page size",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cursor: return the results after this position",
+                        "name": "after",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cursor: return the results before this position",
+                        "name": "before",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag of a previous response; 304 if the results are unchanged",
+                        "name": "If-None-Match",
+                        "in": "header"
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "the messages list if matched",
+                        "description": "the matching messages",
                         "schema": {
-                            "$ref": "#/definitions/utils.Response-array_store_Message"
+                            "$ref": "#/definitions/utils.Response-array_store_SearchResult"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Tag of these results, for If-None-Match"
+                            }
                         }
                     },
+                    "304": {
+                        "description": "Not Modified - the results still match If-None-Match"
+                    },
                     "400": {
-                        "description": "Invalid request",
+                        "description": "Missing or malformed text, or invalid pagination parameters",
                         "schema": {
-                            "$ref": "#/definitions/utils.ErrorResponse"
+                            "$ref": "#/definitions/utils.Problem"
                         }
                     },
-                    "404": {
-                        "description": "No matching messages found",
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/messages/stream": {
+            "get": {
+                "description": "Push message.created, message.updated, message.deleted and message.restored events as Server-Sent Events.\nEach event's id is the stream's epoch and a sequence number, such as \"3f9a0c2b71de-42\"; reconnect\nwith the Last-Event-ID header to receive the events missed in between. Only the most recent\nevents are retained, in memory, so resuming is best effort: after a longer gap, or with an id\nfrom before a server restart, a \"resync\" event is sent and the client should reload the list.\nComment lines are sent as heartbeats.\nEvents from every room are streamed; filter on message.room_id.",
+                "produces": [
+                    "text/event-stream"
+                ],
+                "tags": [
+                    "messages"
+                ],
+                "summary": "Stream message events",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID of the last event received",
+                        "name": "Last-Event-ID",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Stream of events",
+                        "schema": {
+                            "$ref": "#/definitions/store.Event"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid Last-Event-ID",
                         "schema": {
-                            "$ref": "#/definitions/utils.ErrorResponse"
+                            "$ref": "#/definitions/utils.Problem"
                         }
                     },
                     "500": {
                         "description": "Internal server error",
                         "schema": {
-                            "$ref": "#/definitions/utils.ErrorResponse"
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/messages/ws": {
+            "get": {
+                "description": "Upgrade to a WebSocket that broadcasts the same events as /messages/stream and accepts\n{\"type\": \"message.create\", \"ref\": \"...\", \"room\": \"...\", \"data\": {\"from\": \"...\", \"text\": \"...\"}}\nframes, where room defaults to the \"general\" room. Events from every room are broadcast.\nEach frame is validated like POST /messages and answered with an \"ack\" carrying the new\nmessage or an \"error\" carrying a problem document, echoing ref. The server pings\nperiodically and closes clients that stop answering or fall behind.",
+                "tags": [
+                    "messages"
+                ],
+                "summary": "Chat over WebSocket",
+                "responses": {
+                    "101": {
+                        "description": "Switching Protocols"
+                    },
+                    "400": {
+                        "description": "Not a WebSocket handshake",
+                        "schema": {
+                            "type": "string"
                         }
                     }
                 }
@@ -182,24 +460,30 @@ const docTemplate = `{
                         "description": "the message if matched",
                         "schema": {
                             "$ref": "#/definitions/utils.Response-store_Message"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Tag of the message's version, reactions and replies, for If-Match"
+                            }
                         }
                     },
                     "404": {
                         "description": "No matching messages found",
                         "schema": {
-                            "$ref": "#/definitions/utils.ErrorResponse"
+                            "$ref": "#/definitions/utils.Problem"
                         }
                     },
                     "500": {
                         "description": "Internal server error",
                         "schema": {
-                            "$ref": "#/definitions/utils.ErrorResponse"
+                            "$ref": "#/definitions/utils.Problem"
                         }
                     }
                 }
             },
             "put": {
-                "description": "Return an updated message by ID",
+                "description": "Return an updated message by ID. An update that changes the sender or text sets\nedited_at and records the previous version as a revision, crediting editor or, if it\nis empty, from. parent_id is ignored: replies cannot be moved. Send the ETag from GET as\nIf-Match to fail with 412 instead of overwriting someone else's change; new reactions and\nreplies count as changes too.",
                 "consumes": [
                     "application/json"
                 ],
@@ -226,6 +510,12 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/store.CreateMessageRequest"
                         }
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag the message must still have",
+                        "name": "If-Match",
+                        "in": "header"
                     }
                 ],
                 "responses": {
@@ -233,24 +523,54 @@ const docTemplate = `{
                         "description": "the updated message",
                         "schema": {
                             "$ref": "#/definitions/utils.Response-store_Message"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Tag of the updated message"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
                         }
                     },
                     "404": {
                         "description": "No matching messages found",
                         "schema": {
-                            "$ref": "#/definitions/utils.ErrorResponse"
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "412": {
+                        "description": "The message no longer matches If-Match",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "413": {
+                        "description": "Request body too large",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "415": {
+                        "description": "Content-Type is not application/json",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
                         }
                     },
                     "500": {
                         "description": "Internal server error",
                         "schema": {
-                            "$ref": "#/definitions/utils.ErrorResponse"
+                            "$ref": "#/definitions/utils.Problem"
                         }
                     }
                 }
             },
             "delete": {
-                "description": "Deletes a message with the specified ID and returns no content on success",
+                "description": "Deletes a message with the specified ID and returns no content on success. The message\nbecomes a tombstone that is left out of lists and search and cannot be edited, but can\nbe brought back with POST /messages/{messageId}/restore until it is purged. A tombstone\nwith replies can still be read, with deleted_at set and its sender and text blanked.\nIf-Match works as with PUT.",
                 "produces": [
                     "application/json"
                 ],
@@ -265,6 +585,12 @@ const docTemplate = `{
                         "name": "messageId",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag the message must still have",
+                        "name": "If-Match",
+                        "in": "header"
                     }
                 ],
                 "responses": {
@@ -274,58 +600,2473 @@ const docTemplate = `{
                     "404": {
                         "description": "No matching message found",
                         "schema": {
-                            "$ref": "#/definitions/utils.ErrorResponse"
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "412": {
+                        "description": "The message no longer matches If-Match",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
                         }
                     },
                     "500": {
                         "description": "Internal server error",
                         "schema": {
-                            "$ref": "#/definitions/utils.ErrorResponse"
+                            "$ref": "#/definitions/utils.Problem"
                         }
                     }
                 }
-            }
-        }
-    },
-    "definitions": {
-        "store.CreateMessageRequest": {
-            "type": "object",
-            "properties": {
-                "from": {
-                    "type": "string",
-                    "example": "Alice"
-                },
-                "text": {
-                    "type": "string",
-                    "example": "Hello World"
-                }
-            }
-        },
-        "store.Message": {
-            "type": "object",
-            "properties": {
-                "from": {
-                    "type": "string"
-                },
-                "id": {
-                    "type": "string"
-                },
-                "text": {
-                    "type": "string"
-                },
-                "time_sent": {
-                    "type": "string"
+            },
+            "patch": {
+                "description": "Change only some of a message's fields. With application/merge-patch+json (RFC 7386) the\nbody is an object whose from and text replace the current ones; with\napplication/json-patch+json (RFC 6902) it is a list of operations on /from, /text and\n/editor. editor credits the change as with PUT. The patched message is validated like a PUT.\nIf-Match works as with PUT.",
+                "consumes": [
+                    "application/merge-patch+json",
+                    "application/json-patch+json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "messages"
+                ],
+                "summary": "Partially update a message by ID",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Message ID",
+                        "name": "messageId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Merge patch, e.g. {\\",
+                        "name": "patch",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.messagePatch"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag the message must still have",
+                        "name": "If-Match",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "the updated message",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Response-store_Message"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Tag of the updated message"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Malformed patch, or the patched message is invalid",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "No matching messages found",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "A JSON Patch operation could not be applied, such as a failed test",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "412": {
+                        "description": "The message no longer matches If-Match",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "413": {
+                        "description": "Request body too large",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "415": {
+                        "description": "Content-Type is not a supported patch format",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    }
                 }
             }
         },
-        "utils.ErrorResponse": {
+        "/messages/{messageId}/reactions/{emoji}": {
+            "post": {
+                "description": "Add a user's emoji reaction to a message. Each user can add each emoji once: repeating a\nreaction changes nothing and answers 200 instead of 201. The emoji is URL-encoded in the\npath and must be a single emoji, including skin tone, keycap and ZWJ sequences.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "messages"
+                ],
+                "summary": "React to a message",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Message ID",
+                        "name": "messageId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Emoji",
+                        "name": "emoji",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Reacting user",
+                        "name": "reaction",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/store.ReactionRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "the user had already reacted with this emoji",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Response-store_Message"
+                        }
+                    },
+                    "201": {
+                        "description": "the message with its new reaction counts",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Response-store_Message"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid emoji or user",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "No matching message found",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "413": {
+                        "description": "Request body too large",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "415": {
+                        "description": "Content-Type is not application/json",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Remove a user's emoji reaction from a message",
+                "tags": [
+                    "messages"
+                ],
+                "summary": "Remove a reaction from a message",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Message ID",
+                        "name": "messageId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Emoji",
+                        "name": "emoji",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Reacting user",
+                        "name": "user",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content - Reaction successfully removed"
+                    },
+                    "400": {
+                        "description": "Invalid emoji or user",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "No matching message or reaction found",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/messages/{messageId}/replies": {
+            "get": {
+                "description": "Return a page of the direct replies to a message, oldest first; see GET /messages for the cursors",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "messages"
+                ],
+                "summary": "Get the replies to a message",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Message ID",
+                        "name": "messageId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "maximum": 200,
+                        "minimum": 1,
+                        "type": "integer",
+                        "default": 50,
+                        "description": "Page size",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cursor: return replies after this position",
+                        "name": "after",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cursor: return replies before this position",
+                        "name": "before",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag of a previous response; 304 if the list is unchanged",
+                        "name": "If-None-Match",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "reply list",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Response-array_store_Message"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Tag of this list, for If-None-Match"
+                            }
+                        }
+                    },
+                    "304": {
+                        "description": "Not Modified - the list still matches If-None-Match"
+                    },
+                    "400": {
+                        "description": "Invalid pagination parameters",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "No matching message found",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/messages/{messageId}/restore": {
+            "post": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Undo the deletion of a message, with its text, reactions and edit history, as long as it\nhas not been purged yet. Restoring a message that is not deleted returns it unchanged.\nRequires the server's admin token.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "messages"
+                ],
+                "summary": "Restore a deleted message",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Message ID",
+                        "name": "messageId",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "The restored message",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Response-store_Message"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Tag of the updated message"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Missing or wrong admin token",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "The server has no admin token configured",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "No matching message found, or it was purged",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/messages/{messageId}/revisions": {
+            "get": {
+                "description": "Return every edit of a message, oldest first, with when and by whom it was made and\nthe sender and text it replaced. Deleted messages show no history until restored.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "messages"
+                ],
+                "summary": "Get the edit history of a message",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Message ID",
+                        "name": "messageId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag of a previous response; 304 if the list is unchanged",
+                        "name": "If-None-Match",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "revision list",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Response-array_store_Revision"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Tag of this list, for If-None-Match"
+                            }
+                        }
+                    },
+                    "304": {
+                        "description": "Not Modified - the list still matches If-None-Match"
+                    },
+                    "404": {
+                        "description": "No matching message found",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/rooms": {
+            "get": {
+                "description": "Return every room, the default \"general\" room first, then oldest first",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "rooms"
+                ],
+                "summary": "List rooms",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ETag of a previous response; 304 if the list is unchanged",
+                        "name": "If-None-Match",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "room list",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Response-array_store_Room"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Tag of this list, for If-None-Match"
+                            }
+                        }
+                    },
+                    "304": {
+                        "description": "Not Modified - the list still matches If-None-Match"
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Create a new room; post messages to it under /rooms/{roomId}/messages",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "rooms"
+                ],
+                "summary": "Create a room",
+                "parameters": [
+                    {
+                        "description": "Room",
+                        "name": "room",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/store.CreateRoomRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Successful creation of room",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Response-store_Room"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "413": {
+                        "description": "Request body too large",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "415": {
+                        "description": "Content-Type is not application/json",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/rooms/{roomId}": {
+            "get": {
+                "description": "Return a room by ID",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "rooms"
+                ],
+                "summary": "Get a room by ID",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Room ID",
+                        "name": "roomId",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "the room",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Response-store_Room"
+                        }
+                    },
+                    "404": {
+                        "description": "No matching room found",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "description": "Rename a room or change its topic",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "rooms"
+                ],
+                "summary": "Update a room by ID",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Room ID",
+                        "name": "roomId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Updated room",
+                        "name": "room",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/store.CreateRoomRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "the updated room",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Response-store_Room"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "No matching room found",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "413": {
+                        "description": "Request body too large",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "415": {
+                        "description": "Content-Type is not application/json",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Delete a room and every message in it. The default \"general\" room cannot be deleted.",
+                "tags": [
+                    "rooms"
+                ],
+                "summary": "Delete a room by ID",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Room ID",
+                        "name": "roomId",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content - Room successfully deleted"
+                    },
+                    "404": {
+                        "description": "No matching room found",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "The default room cannot be deleted",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/rooms/{roomId}/messages": {
+            "get": {
+                "description": "Return a page of a room's messages, oldest first unless sort says otherwise; see\nGET /messages for the cursors and filters",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "rooms"
+                ],
+                "summary": "Get a room's messages",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Room ID",
+                        "name": "roomId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "maximum": 200,
+                        "minimum": 1,
+                        "type": "integer",
+                        "default": 50,
+                        "description": "Page size",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cursor: return messages after this position",
+                        "name": "after",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cursor: return messages before this position",
+                        "name": "before",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only messages from this sender",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only messages sent at or after this date or RFC 3339 time",
+                        "name": "since",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only messages sent before this date or RFC 3339 time",
+                        "name": "until",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "id",
+                            "time_sent",
+                            "-time_sent"
+                        ],
+                        "type": "string",
+                        "default": "id",
+                        "description": "Order of the messages",
+                        "name": "sort",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Comma-separated message fields to return, e.g. id,from,text",
+                        "name": "fields",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag of a previous response; 304 if the list is unchanged",
+                        "name": "If-None-Match",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "message list",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Response-array_store_Message"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Tag of this list, for If-None-Match"
+                            }
+                        }
+                    },
+                    "304": {
+                        "description": "Not Modified - the list still matches If-None-Match"
+                    },
+                    "400": {
+                        "description": "Invalid query parameters",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "No matching room found",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Create a new message in a room",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "rooms"
+                ],
+                "summary": "Post a message to a room",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Room ID",
+                        "name": "roomId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Message content",
+                        "name": "message",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/store.CreateMessageRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Successful creation of message",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Response-store_Message"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Tag of the message's version, reactions and replies, for If-Match"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "No matching room found",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "413": {
+                        "description": "Request body too large",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "415": {
+                        "description": "Content-Type is not application/json",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/rooms/{roomId}/messages/latest": {
+            "get": {
+                "description": "Return the latest messages in a room; see GET /messages/latest",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "rooms"
+                ],
+                "summary": "Get a room's latest messages",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Room ID",
+                        "name": "roomId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "maximum": 200,
+                        "minimum": 1,
+                        "type": "integer",
+                        "default": 10,
+                        "description": "How many messages to return",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "asc",
+                            "desc"
+                        ],
+                        "type": "string",
+                        "default": "asc",
+                        "description": "asc for oldest first, desc for newest first",
+                        "name": "order",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag of a previous response; 304 if the list is unchanged",
+                        "name": "If-None-Match",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "the latest messages",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Response-array_store_Message"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Tag of this list, for If-None-Match"
+                            }
+                        }
+                    },
+                    "304": {
+                        "description": "Not Modified - the list still matches If-None-Match"
+                    },
+                    "400": {
+                        "description": "Invalid limit or order",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "No matching room found",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/rooms/{roomId}/messages/poll": {
+            "get": {
+                "description": "Wait until a room has messages newer than since; see GET /messages/poll",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "rooms"
+                ],
+                "summary": "Long-poll for new messages in a room",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Room ID",
+                        "name": "roomId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ID of the newest message the client already has",
+                        "name": "since",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "default": "30s",
+                        "description": "How long to wait, as a duration like 30s or a number of seconds",
+                        "name": "timeout",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "new messages, possibly none",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Response-array_store_Message"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid poll parameters",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "No matching room found",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/rooms/{roomId}/messages/search": {
+            "get": {
+                "description": "Return a page of the messages in a room matching the search, most relevant first; see\nGET /messages/search",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "rooms"
+                ],
+                "summary": "Search a room's messages",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Room ID",
+                        "name": "roomId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "What to search for, e.g. green tea OR coffee -milk from:ann",
+                        "name": "text",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "maximum": 200,
+                        "minimum": 1,
+                        "type": "integer",
+                        "default": 50,
+                        "description": "Page size",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cursor: return the results after this position",
+                        "name": "after",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cursor: return the results before this position",
+                        "name": "before",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag of a previous response; 304 if the results are unchanged",
+                        "name": "If-None-Match",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "the matching messages",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Response-array_store_SearchResult"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Tag of these results, for If-None-Match"
+                            }
+                        }
+                    },
+                    "304": {
+                        "description": "Not Modified - the results still match If-None-Match"
+                    },
+                    "400": {
+                        "description": "Missing or malformed text, or invalid pagination parameters",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "No matching room found",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/rooms/{roomId}/messages/{messageId}": {
+            "get": {
+                "description": "Return a message by ID if it was posted in the room",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "rooms"
+                ],
+                "summary": "Get a message in a room by ID",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Room ID",
+                        "name": "roomId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Message ID",
+                        "name": "messageId",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "the message if matched",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Response-store_Message"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Tag of the message's version, reactions and replies, for If-Match"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "No matching message found",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "description": "Return an updated message by ID; messages cannot move between rooms",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "rooms"
+                ],
+                "summary": "Update a message in a room by ID",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Room ID",
+                        "name": "roomId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Message ID",
+                        "name": "messageId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Updated message content",
+                        "name": "message",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/store.CreateMessageRequest"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag the message must still have",
+                        "name": "If-Match",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "the updated message",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Response-store_Message"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Tag of the updated message"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "No matching message found",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "412": {
+                        "description": "The message no longer matches If-Match",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "413": {
+                        "description": "Request body too large",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "415": {
+                        "description": "Content-Type is not application/json",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Deletes a message with the specified ID from the room and returns no content on success",
+                "tags": [
+                    "rooms"
+                ],
+                "summary": "Delete a message in a room by ID",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Room ID",
+                        "name": "roomId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Message ID",
+                        "name": "messageId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag the message must still have",
+                        "name": "If-Match",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content - Message successfully deleted"
+                    },
+                    "404": {
+                        "description": "No matching message found",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "412": {
+                        "description": "The message no longer matches If-Match",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "description": "Change only some of a message's fields; see PATCH /messages/{messageId}",
+                "consumes": [
+                    "application/merge-patch+json",
+                    "application/json-patch+json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "rooms"
+                ],
+                "summary": "Partially update a message in a room by ID",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Room ID",
+                        "name": "roomId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Message ID",
+                        "name": "messageId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Merge patch or JSON Patch array",
+                        "name": "patch",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.messagePatch"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag the message must still have",
+                        "name": "If-Match",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "the updated message",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Response-store_Message"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Tag of the updated message"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Malformed patch, or the patched message is invalid",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "No matching message found",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "A JSON Patch operation could not be applied",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "412": {
+                        "description": "The message no longer matches If-Match",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "415": {
+                        "description": "Content-Type is not a supported patch format",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/rooms/{roomId}/messages/{messageId}/reactions/{emoji}": {
+            "post": {
+                "description": "Add a user's emoji reaction to a message in a room; see POST /messages/{messageId}/reactions/{emoji}",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "rooms"
+                ],
+                "summary": "React to a message in a room",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Room ID",
+                        "name": "roomId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Message ID",
+                        "name": "messageId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Emoji",
+                        "name": "emoji",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Reacting user",
+                        "name": "reaction",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/store.ReactionRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "the user had already reacted with this emoji",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Response-store_Message"
+                        }
+                    },
+                    "201": {
+                        "description": "the message with its new reaction counts",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Response-store_Message"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid emoji or user",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "No matching message found",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "413": {
+                        "description": "Request body too large",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "415": {
+                        "description": "Content-Type is not application/json",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Remove a user's emoji reaction from a message in a room",
+                "tags": [
+                    "rooms"
+                ],
+                "summary": "Remove a reaction from a message in a room",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Room ID",
+                        "name": "roomId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Message ID",
+                        "name": "messageId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Emoji",
+                        "name": "emoji",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Reacting user",
+                        "name": "user",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content - Reaction successfully removed"
+                    },
+                    "400": {
+                        "description": "Invalid emoji or user",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "No matching message or reaction found",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/rooms/{roomId}/messages/{messageId}/replies": {
+            "get": {
+                "description": "Return a page of the direct replies to a message in a room, oldest first",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "rooms"
+                ],
+                "summary": "Get the replies to a message in a room",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Room ID",
+                        "name": "roomId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Message ID",
+                        "name": "messageId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "maximum": 200,
+                        "minimum": 1,
+                        "type": "integer",
+                        "default": 50,
+                        "description": "Page size",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cursor: return replies after this position",
+                        "name": "after",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cursor: return replies before this position",
+                        "name": "before",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag of a previous response; 304 if the list is unchanged",
+                        "name": "If-None-Match",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "reply list",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Response-array_store_Message"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Tag of this list, for If-None-Match"
+                            }
+                        }
+                    },
+                    "304": {
+                        "description": "Not Modified - the list still matches If-None-Match"
+                    },
+                    "400": {
+                        "description": "Invalid pagination parameters",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "No matching message found",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/rooms/{roomId}/messages/{messageId}/revisions": {
+            "get": {
+                "description": "Return every edit of a message in a room, oldest first",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "rooms"
+                ],
+                "summary": "Get the edit history of a message in a room",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Room ID",
+                        "name": "roomId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Message ID",
+                        "name": "messageId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag of a previous response; 304 if the list is unchanged",
+                        "name": "If-None-Match",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "revision list",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Response-array_store_Revision"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Tag of this list, for If-None-Match"
+                            }
+                        }
+                    },
+                    "304": {
+                        "description": "Not Modified - the list still matches If-None-Match"
+                    },
+                    "404": {
+                        "description": "No matching message found",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/webhooks": {
+            "get": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Return every webhook subscription, oldest first",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "List webhook subscriptions",
+                "responses": {
+                    "200": {
+                        "description": "subscription list",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Response-array_webhook_Subscription"
+                        }
+                    },
+                    "401": {
+                        "description": "Missing or wrong admin token",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "The server has no admin token configured",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Register a URL to receive a signed JSON POST of every message.created, message.updated,\nmessage.deleted and message.restored event, or only the listed ones. Each delivery carries Webhook-Id,\nWebhook-Event, Webhook-Timestamp and Webhook-Signature headers; the signature is\n\"sha256=\" followed by the hex HMAC-SHA256 of \"\u003ctimestamp\u003e.\u003cbody\u003e\" keyed with the secret.\nThe secret is only returned here. The URL may not point to localhost or a private or\nlink-local address unless the server allowlists it with -webhook-allow; every delivery\nchecks the address it connects to as well, and redirects are not followed. Like every\nwebhook endpoint, this requires the server's admin token.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "Subscribe to message events",
+                "parameters": [
+                    {
+                        "description": "Subscription",
+                        "name": "webhook",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/webhook.CreateSubscriptionRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "the new subscription, with its secret",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Response-webhook_Subscription"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "Missing or wrong admin token",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "The server has no admin token configured",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "413": {
+                        "description": "Request body too large",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "415": {
+                        "description": "Content-Type is not application/json",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/webhooks/dead-letters": {
+            "get": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Return the deliveries that failed every attempt, oldest first",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "List dead-lettered deliveries",
+                "responses": {
+                    "200": {
+                        "description": "dead letters",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Response-array_webhook_Delivery"
+                        }
+                    },
+                    "401": {
+                        "description": "Missing or wrong admin token",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "The server has no admin token configured",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/webhooks/dead-letters/{deliveryId}/retry": {
+            "post": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Take a delivery off the dead-letter list and send it again with a fresh set of attempts",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "Retry a dead-lettered delivery",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Delivery ID",
+                        "name": "deliveryId",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "the delivery, pending again",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Response-webhook_Delivery"
+                        }
+                    },
+                    "401": {
+                        "description": "Missing or wrong admin token",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "The server has no admin token configured",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "No matching dead letter, or its subscription was deleted",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/webhooks/{webhookId}": {
+            "get": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Return a webhook subscription by ID, without its secret",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "Get a webhook subscription by ID",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Subscription ID",
+                        "name": "webhookId",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "the subscription",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Response-webhook_Subscription"
+                        }
+                    },
+                    "401": {
+                        "description": "Missing or wrong admin token",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "The server has no admin token configured",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "No matching subscription found",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Stop deliveries to a subscription and cancel its pending retries",
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "Delete a webhook subscription by ID",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Subscription ID",
+                        "name": "webhookId",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content - Subscription successfully deleted"
+                    },
+                    "401": {
+                        "description": "Missing or wrong admin token",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "The server has no admin token configured",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "No matching subscription found",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/webhooks/{webhookId}/deliveries": {
+            "get": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Return the delivery log of a subscription, oldest first, with every attempt's status\ncode, error and duration. Only the most recent deliveries are kept.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "List a subscription's deliveries",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Subscription ID",
+                        "name": "webhookId",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "delivery log",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Response-array_webhook_Delivery"
+                        }
+                    },
+                    "401": {
+                        "description": "Missing or wrong admin token",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "The server has no admin token configured",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "No matching subscription found",
+                        "schema": {
+                            "$ref": "#/definitions/utils.Problem"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "handlers.messagePatch": {
+            "type": "object",
+            "properties": {
+                "editor": {
+                    "type": "string"
+                },
+                "from": {
+                    "type": "string"
+                },
+                "text": {
+                    "type": "string"
+                }
+            }
+        },
+        "store.CreateMessageRequest": {
+            "type": "object",
+            "required": [
+                "from",
+                "text"
+            ],
+            "properties": {
+                "editor": {
+                    "description": "Name recorded as the editor of an update; defaults to From. Ignored\nwhen creating a message.",
+                    "type": "string",
+                    "maxLength": 50,
+                    "example": "Alice"
+                },
+                "from": {
+                    "description": "Sender name on a single line, without control characters",
+                    "type": "string",
+                    "maxLength": 50,
+                    "example": "Alice"
+                },
+                "parent_id": {
+                    "description": "ID of the message to reply to, which must be in the same room. Only\nused when creating a message; replies cannot be moved between threads.",
+                    "type": "string",
+                    "maxLength": 100,
+                    "example": ""
+                },
+                "text": {
+                    "description": "Message body; tabs and newlines are the only control characters allowed",
+                    "type": "string",
+                    "maxLength": 2000,
+                    "example": "Hello World"
+                }
+            }
+        },
+        "store.CreateRoomRequest": {
+            "type": "object",
+            "required": [
+                "name"
+            ],
+            "properties": {
+                "name": {
+                    "description": "Room name on a single line",
+                    "type": "string",
+                    "maxLength": 50,
+                    "example": "Random"
+                },
+                "topic": {
+                    "description": "Optional one-line description",
+                    "type": "string",
+                    "maxLength": 200,
+                    "example": "Anything goes"
+                }
+            }
+        },
+        "store.Event": {
+            "type": "object",
+            "properties": {
+                "message": {
+                    "$ref": "#/definitions/store.Message"
+                },
+                "seq": {
+                    "type": "integer"
+                },
+                "time": {
+                    "type": "string"
+                },
+                "type": {
+                    "$ref": "#/definitions/store.EventType"
+                }
+            }
+        },
+        "store.EventType": {
+            "type": "string",
+            "enum": [
+                "message.created",
+                "message.updated",
+                "message.deleted",
+                "message.restored"
+            ],
+            "x-enum-varnames": [
+                "MessageCreated",
+                "MessageUpdated",
+                "MessageDeleted",
+                "MessageRestored"
+            ]
+        },
+        "store.Message": {
+            "type": "object",
+            "properties": {
+                "deleted_at": {
+                    "description": "DeletedAt is set on tombstones: deleted messages that are shown\nwithout their sender and text while they still have replies.",
+                    "type": "string"
+                },
+                "edited_at": {
+                    "description": "EditedAt is when the sender or text last changed; see Revisions.",
+                    "type": "string"
+                },
+                "from": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "parent_id": {
+                    "description": "ParentID is the message this one replies to, if any.",
+                    "type": "string"
+                },
+                "reactions": {
+                    "description": "Reactions counts the users who reacted with each emoji.",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "integer"
+                    }
+                },
+                "reply_count": {
+                    "description": "ReplyCount is the number of direct replies to the message.",
+                    "type": "integer"
+                },
+                "room_id": {
+                    "description": "RoomID is the room the message was posted in.",
+                    "type": "string",
+                    "example": "general"
+                },
+                "text": {
+                    "type": "string"
+                },
+                "time_sent": {
+                    "type": "string"
+                },
+                "version": {
+                    "description": "Version starts at 1 and goes up with every edit, delete and restore.\nReactions and replies leave it alone.",
+                    "type": "integer",
+                    "example": 1
+                }
+            }
+        },
+        "store.ReactionRequest": {
+            "type": "object",
+            "required": [
+                "user"
+            ],
+            "properties": {
+                "user": {
+                    "description": "Name of the reacting user on a single line, without control characters",
+                    "type": "string",
+                    "maxLength": 50,
+                    "example": "Alice"
+                }
+            }
+        },
+        "store.Revision": {
             "type": "object",
             "properties": {
-                "error": {
+                "edited_at": {
+                    "type": "string"
+                },
+                "editor": {
+                    "type": "string",
+                    "example": "Alice"
+                },
+                "from": {
+                    "type": "string"
+                },
+                "message_id": {
+                    "type": "string"
+                },
+                "number": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "text": {
+                    "type": "string"
+                }
+            }
+        },
+        "store.Room": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string",
+                    "example": "2025-02-12T12:12:12Z"
+                },
+                "id": {
+                    "type": "string",
+                    "example": "01JB8ZC5T8M2X9Q4Y7W3R6K1PN"
+                },
+                "name": {
+                    "type": "string",
+                    "example": "Random"
+                },
+                "topic": {
+                    "type": "string",
+                    "example": "Anything goes"
+                }
+            }
+        },
+        "store.SearchResult": {
+            "type": "object",
+            "properties": {
+                "deleted_at": {
+                    "description": "DeletedAt is set on tombstones: deleted messages that are shown\nwithout their sender and text while they still have replies.",
+                    "type": "string"
+                },
+                "edited_at": {
+                    "description": "EditedAt is when the sender or text last changed; see Revisions.",
+                    "type": "string"
+                },
+                "from": {
+                    "type": "string"
+                },
+                "highlight": {
+                    "description": "Highlight is the text, HTML-escaped, with the words that matched\nwrapped in \u003cmark\u003e tags.",
+                    "type": "string",
+                    "example": "\u003cmark\u003eHello\u003c/mark\u003e World"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "parent_id": {
+                    "description": "ParentID is the message this one replies to, if any.",
+                    "type": "string"
+                },
+                "reactions": {
+                    "description": "Reactions counts the users who reacted with each emoji.",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "integer"
+                    }
+                },
+                "reply_count": {
+                    "description": "ReplyCount is the number of direct replies to the message.",
+                    "type": "integer"
+                },
+                "room_id": {
+                    "description": "RoomID is the room the message was posted in.",
+                    "type": "string",
+                    "example": "general"
+                },
+                "score": {
+                    "description": "Score is the BM25 relevance of the message to the query; results\ncome highest first.",
+                    "type": "number",
+                    "example": 1.86
+                },
+                "text": {
+                    "type": "string"
+                },
+                "time_sent": {
+                    "type": "string"
+                },
+                "version": {
+                    "description": "Version starts at 1 and goes up with every edit, delete and restore.\nReactions and replies leave it alone.",
+                    "type": "integer",
+                    "example": 1
+                }
+            }
+        },
+        "utils.FieldError": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "type": "string",
+                    "example": "required"
+                },
+                "field": {
+                    "type": "string",
+                    "example": "from"
+                },
+                "message": {
+                    "type": "string",
+                    "example": "from is required"
+                }
+            }
+        },
+        "utils.Links": {
+            "type": "object",
+            "properties": {
+                "next": {
+                    "type": "string"
+                },
+                "prev": {
+                    "type": "string"
+                },
+                "self": {
+                    "type": "string"
+                }
+            }
+        },
+        "utils.Meta": {
+            "type": "object",
+            "properties": {
+                "count": {
+                    "type": "integer"
+                },
+                "pagination": {
+                    "$ref": "#/definitions/utils.Pagination"
+                },
+                "took_ms": {
+                    "description": "TookMS is how long the server spent on the request, in milliseconds.",
+                    "type": "number"
+                }
+            }
+        },
+        "utils.Pagination": {
+            "type": "object",
+            "properties": {
+                "limit": {
+                    "type": "integer"
+                },
+                "next": {
                     "type": "string"
+                },
+                "prev": {
+                    "type": "string"
+                }
+            }
+        },
+        "utils.Problem": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/utils.ProblemCode"
+                        }
+                    ],
+                    "example": "validation_failed"
+                },
+                "detail": {
+                    "type": "string",
+                    "example": "The message has 1 invalid field."
+                },
+                "errors": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/utils.FieldError"
+                    }
+                },
+                "status": {
+                    "type": "integer",
+                    "example": 400
+                },
+                "title": {
+                    "type": "string",
+                    "example": "Request failed validation"
+                },
+                "type": {
+                    "type": "string",
+                    "example": "/problems/validation-failed"
                 }
             }
         },
+        "utils.ProblemCode": {
+            "type": "string",
+            "enum": [
+                "invalid_body",
+                "unsupported_media_type",
+                "payload_too_large",
+                "validation_failed",
+                "invalid_query",
+                "unauthorized",
+                "forbidden",
+                "not_found",
+                "conflict",
+                "precondition_failed",
+                "internal_error"
+            ],
+            "x-enum-varnames": [
+                "CodeInvalidBody",
+                "CodeUnsupportedMediaType",
+                "CodePayloadTooLarge",
+                "CodeValidationFailed",
+                "CodeInvalidQuery",
+                "CodeUnauthorized",
+                "CodeForbidden",
+                "CodeNotFound",
+                "CodeConflict",
+                "CodePreconditionFailed",
+                "CodeInternal"
+            ]
+        },
         "utils.Response-array_store_Message": {
             "type": "object",
             "properties": {
@@ -334,6 +3075,97 @@ const docTemplate = `{
                     "items": {
                         "$ref": "#/definitions/store.Message"
                     }
+                },
+                "links": {
+                    "$ref": "#/definitions/utils.Links"
+                },
+                "meta": {
+                    "$ref": "#/definitions/utils.Meta"
+                }
+            }
+        },
+        "utils.Response-array_store_Revision": {
+            "type": "object",
+            "properties": {
+                "data": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/store.Revision"
+                    }
+                },
+                "links": {
+                    "$ref": "#/definitions/utils.Links"
+                },
+                "meta": {
+                    "$ref": "#/definitions/utils.Meta"
+                }
+            }
+        },
+        "utils.Response-array_store_Room": {
+            "type": "object",
+            "properties": {
+                "data": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/store.Room"
+                    }
+                },
+                "links": {
+                    "$ref": "#/definitions/utils.Links"
+                },
+                "meta": {
+                    "$ref": "#/definitions/utils.Meta"
+                }
+            }
+        },
+        "utils.Response-array_store_SearchResult": {
+            "type": "object",
+            "properties": {
+                "data": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/store.SearchResult"
+                    }
+                },
+                "links": {
+                    "$ref": "#/definitions/utils.Links"
+                },
+                "meta": {
+                    "$ref": "#/definitions/utils.Meta"
+                }
+            }
+        },
+        "utils.Response-array_webhook_Delivery": {
+            "type": "object",
+            "properties": {
+                "data": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/webhook.Delivery"
+                    }
+                },
+                "links": {
+                    "$ref": "#/definitions/utils.Links"
+                },
+                "meta": {
+                    "$ref": "#/definitions/utils.Meta"
+                }
+            }
+        },
+        "utils.Response-array_webhook_Subscription": {
+            "type": "object",
+            "properties": {
+                "data": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/webhook.Subscription"
+                    }
+                },
+                "links": {
+                    "$ref": "#/definitions/utils.Links"
+                },
+                "meta": {
+                    "$ref": "#/definitions/utils.Meta"
                 }
             }
         },
@@ -342,9 +3174,197 @@ const docTemplate = `{
             "properties": {
                 "data": {
                     "$ref": "#/definitions/store.Message"
+                },
+                "links": {
+                    "$ref": "#/definitions/utils.Links"
+                },
+                "meta": {
+                    "$ref": "#/definitions/utils.Meta"
+                }
+            }
+        },
+        "utils.Response-store_Room": {
+            "type": "object",
+            "properties": {
+                "data": {
+                    "$ref": "#/definitions/store.Room"
+                },
+                "links": {
+                    "$ref": "#/definitions/utils.Links"
+                },
+                "meta": {
+                    "$ref": "#/definitions/utils.Meta"
+                }
+            }
+        },
+        "utils.Response-webhook_Delivery": {
+            "type": "object",
+            "properties": {
+                "data": {
+                    "$ref": "#/definitions/webhook.Delivery"
+                },
+                "links": {
+                    "$ref": "#/definitions/utils.Links"
+                },
+                "meta": {
+                    "$ref": "#/definitions/utils.Meta"
+                }
+            }
+        },
+        "utils.Response-webhook_Subscription": {
+            "type": "object",
+            "properties": {
+                "data": {
+                    "$ref": "#/definitions/webhook.Subscription"
+                },
+                "links": {
+                    "$ref": "#/definitions/utils.Links"
+                },
+                "meta": {
+                    "$ref": "#/definitions/utils.Meta"
+                }
+            }
+        },
+        "webhook.Attempt": {
+            "type": "object",
+            "properties": {
+                "at": {
+                    "type": "string",
+                    "example": "2025-02-12T12:12:12Z"
+                },
+                "duration_ms": {
+                    "type": "number",
+                    "example": 12.5
+                },
+                "error": {
+                    "type": "string"
+                },
+                "status_code": {
+                    "description": "StatusCode is the receiver's response status, absent when the\nrequest failed before a response arrived.",
+                    "type": "integer",
+                    "example": 200
+                }
+            }
+        },
+        "webhook.CreateSubscriptionRequest": {
+            "type": "object",
+            "required": [
+                "url"
+            ],
+            "properties": {
+                "events": {
+                    "description": "Events limits deliveries to these event types; empty means all.",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "message.created"
+                    ]
+                },
+                "secret": {
+                    "description": "Secret signs deliveries. When empty, a random one is generated and\nreturned in the response.",
+                    "type": "string",
+                    "maxLength": 200,
+                    "minLength": 16,
+                    "example": "a-long-shared-secret"
+                },
+                "url": {
+                    "description": "URL receives a POST for every matching event.",
+                    "type": "string",
+                    "maxLength": 2000,
+                    "example": "https://example.com/hooks/chat"
+                }
+            }
+        },
+        "webhook.Delivery": {
+            "type": "object",
+            "properties": {
+                "attempts": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/webhook.Attempt"
+                    }
+                },
+                "event": {
+                    "$ref": "#/definitions/store.Event"
+                },
+                "id": {
+                    "type": "string",
+                    "example": "01JB8ZD0Q2A6C3V5N7M9K1H4TX"
+                },
+                "next_attempt_at": {
+                    "type": "string"
+                },
+                "status": {
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/webhook.DeliveryStatus"
+                        }
+                    ],
+                    "example": "succeeded"
+                },
+                "subscription_id": {
+                    "type": "string",
+                    "example": "01JB8ZC5T8M2X9Q4Y7W3R6K1PN"
+                }
+            }
+        },
+        "webhook.DeliveryStatus": {
+            "type": "string",
+            "enum": [
+                "pending",
+                "succeeded",
+                "dead",
+                "canceled"
+            ],
+            "x-enum-varnames": [
+                "DeliveryPending",
+                "DeliverySucceeded",
+                "DeliveryDead",
+                "DeliveryCanceled"
+            ]
+        },
+        "webhook.Subscription": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string",
+                    "example": "2025-02-12T12:12:12Z"
+                },
+                "events": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "message.created",
+                        "message.deleted"
+                    ]
+                },
+                "id": {
+                    "type": "string",
+                    "example": "01JB8ZC5T8M2X9Q4Y7W3R6K1PN"
+                },
+                "secret": {
+                    "description": "Secret is only returned when the subscription is created.",
+                    "type": "string",
+                    "example": "3q2-7wR0bX9kY1v..."
+                },
+                "url": {
+                    "type": "string",
+                    "example": "https://example.com/hooks/chat"
                 }
             }
         }
+    },
+    "securityDefinitions": {
+        "AdminToken": {
+            "description": "\"Bearer \" followed by the token given to -admin-token.",
+            "type": "apiKey",
+            "name": "Authorization",
+            "in": "header"
+        }
     }
 }`
 
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/url"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"node-week-02-with-chi/search"
+	"node-week-02-with-chi/store"
+	"node-week-02-with-chi/utils"
+)
+
+// messageFields are the JSON names of the store.Message fields, which
+// fields= may pick from.
+var messageFields = func() []string {
+	var names []string
+	for _, field := range reflect.VisibleFields(reflect.TypeFor[store.Message]()) {
+		if name, _, _ := strings.Cut(field.Tag.Get("json"), ","); name != "" && name != "-" {
+			names = append(names, name)
+		}
+	}
+	return names
+}()
+
+// listQuery is a page of messages narrowed down by the filters of
+// GET /messages, plus the fields to return.
+type listQuery struct {
+	store.PageQuery
+	Fields []string
+}
+
+// parseListQuery reads the pagination parameters along with from, since,
+// until, sort and fields, reporting every invalid parameter.
+func parseListQuery(query url.Values) (listQuery, []utils.FieldError) {
+	page, fieldErrors := parsePageQuery(query)
+	q := listQuery{PageQuery: page}
+
+	q.From = strings.TrimSpace(query.Get("from"))
+	for _, param := range []struct {
+		name string
+		dest *time.Time
+	}{{"since", &q.Since}, {"until", &q.Until}} {
+		value := query.Get(param.name)
+		if value == "" {
+			continue
+		}
+		// Read like the before: and after: of a search.
+		t, err := search.ParseTime(value)
+		if err != nil {
+			fieldErrors = append(fieldErrors, utils.FieldError{
+				Field:   param.name,
+				Code:    utils.FieldInvalid,
+				Message: param.name + " must be a date like 2026-01-01 or a time like 2026-01-01T12:00:00Z",
+			})
+		}
+		*param.dest = t
+	}
+	if !q.Since.IsZero() && !q.Until.IsZero() && !q.Since.Before(q.Until) {
+		fieldErrors = append(fieldErrors, utils.FieldError{
+			Field:   "until",
+			Code:    utils.FieldOutOfRange,
+			Message: "until must be after since",
+		})
+	}
+
+	if sort := query.Get("sort"); sort != "" {
+		q.Sort = store.Sort(sort)
+		if !slices.Contains(store.Sorts, q.Sort) {
+			fieldErrors = append(fieldErrors, utils.FieldError{
+				Field:   "sort",
+				Code:    utils.FieldInvalid,
+				Message: "sort must be one of time_sent, -time_sent or id",
+			})
+		}
+	}
+
+	if fields := query.Get("fields"); fields != "" {
+		for _, field := range strings.Split(fields, ",") {
+			field = strings.TrimSpace(field)
+			if !slices.Contains(messageFields, field) {
+				fieldErrors = append(fieldErrors, utils.FieldError{
+					Field:   "fields",
+					Code:    utils.FieldUnknown,
+					Message: "unknown field " + strconv.Quote(field) + "; fields may be " + strings.Join(messageFields, ", "),
+				})
+				continue
+			}
+			q.Fields = append(q.Fields, field)
+		}
+	}
+
+	return q, fieldErrors
+}
+
+// defaultLatestLimit is how many messages GET /messages/latest returns
+// without a limit.
+const defaultLatestLimit = 10
+
+// latestQuery is how many of the latest messages to return and whether
+// newest comes first.
+type latestQuery struct {
+	Limit       int
+	NewestFirst bool
+}
+
+// parseLatestQuery reads limit and order=asc|desc, reporting every invalid
+// parameter. The default order is asc: the latest messages, oldest first.
+func parseLatestQuery(query url.Values) (latestQuery, []utils.FieldError) {
+	var q latestQuery
+	var fieldErrors []utils.FieldError
+
+	q.Limit, fieldErrors = parseLimit(query, defaultLatestLimit, fieldErrors)
+	switch query.Get("order") {
+	case "", "asc":
+	case "desc":
+		q.NewestFirst = true
+	default:
+		fieldErrors = append(fieldErrors, utils.FieldError{
+			Field:   "order",
+			Code:    utils.FieldInvalid,
+			Message: "order must be asc or desc",
+		})
+	}
+	return q, fieldErrors
+}
+
+// parseSearchQuery reads text, as parsed by search.Parse, along with the
+// pagination parameters, reporting every invalid parameter. A syntax error
+// in text is reported with the position of the mistake.
+func parseSearchQuery(query url.Values) (store.SearchQuery, []utils.FieldError) {
+	page, fieldErrors := parsePageQuery(query)
+	q := store.SearchQuery{Limit: page.Limit, After: page.After, Before: page.Before}
+
+	text := query.Get("text")
+	if strings.TrimSpace(text) == "" {
+		fieldErrors = append(fieldErrors, utils.FieldError{Field: "text", Code: utils.FieldRequired, Message: "text is required"})
+		return q, fieldErrors
+	}
+	parsed, err := search.Parse(text)
+	if err != nil {
+		fieldErrors = append(fieldErrors, utils.FieldError{Field: "text", Code: utils.FieldInvalid, Message: err.Error()})
+	}
+	q.Query = parsed
+	return q, fieldErrors
+}
+
+// project keeps only fields of each message.
+func project(messages []store.Message, fields []string) ([]map[string]json.RawMessage, error) {
+	projected := make([]map[string]json.RawMessage, 0, len(messages))
+	for _, m := range messages {
+		data, err := json.Marshal(m)
+		if err != nil {
+			return nil, err
+		}
+		var all map[string]json.RawMessage
+		if err := json.Unmarshal(data, &all); err != nil {
+			return nil, err
+		}
+		picked := make(map[string]json.RawMessage, len(fields))
+		for _, field := range fields {
+			if value, ok := all[field]; ok {
+				picked[field] = value
+			}
+		}
+		projected = append(projected, picked)
+	}
+	return projected, nil
+}
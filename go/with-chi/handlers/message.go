@@ -1,133 +1,232 @@
 package handlers
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"mime"
 	"net/http"
 	"node-week-02-with-chi/store"
 	"node-week-02-with-chi/utils"
-
+	"node-week-02-with-chi/validate"
 	"slices"
-	"strconv"
-	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 )
 
 type MessageHandler struct {
-	Message []store.Message
+	Store store.MessageStore
+	// Events streams changes made through Store; nil disables streaming.
+	Events *store.Broker
+	// HeartbeatInterval spaces keep-alive comments on idle streams; zero
+	// means 15 seconds.
+	HeartbeatInterval time.Duration
+	// Limits overrides the default maximum lengths declared on
+	// store.CreateMessageRequest.
+	Limits validate.Limits
+
+	// sockets counts open WebSocket connections.
+	sockets sync.WaitGroup
+	// closed wakes long polls when the server shuts down.
+	closed    chan struct{}
+	closeOnce sync.Once
 }
 
-func New() *MessageHandler {
+func New(s store.MessageStore) *MessageHandler {
 	return &MessageHandler{
-		Message: messages,
+		Store:  s,
+		closed: make(chan struct{}),
 	}
 }
 
-var messages = []store.Message{
-	{
-		ID:   strconv.Itoa(0),
-		From: "Bart",
-		Text: "Welcome to CYF chat system!",
-	},
-}
-
-func validateMessage(req store.CreateMessageRequest) bool {
-	return req.From != "" && req.Text != ""
+// Close ends pending long polls so that the server can shut down promptly.
+func (h *MessageHandler) Close() {
+	h.closeOnce.Do(func() {
+		if h.closed != nil {
+			close(h.closed)
+		}
+	})
 }
 
 // CreateMessage godoc
 // @Summary Create a message
-// @Description Create a new message and add it to the system
+// @Description Create a new message and add it to the system. Set parent_id to reply to another
+// @Description message in the same room.
 // @Tags messages
 // @Accept json
 // @Produce json
 // @Param message body store.CreateMessageRequest true "Message content"
 // @Success 201 {object} utils.Response[store.Message] "Successful creation of message"
-// @Failure 400 {object} utils.ErrorResponse "Invalid request"
-// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Header 201 {string} ETag "Tag of the message's version, reactions and replies, for If-Match"
+// @Failure 400 {object} utils.Problem "Invalid request, or parent_id names no message in this room"
+// @Failure 413 {object} utils.Problem "Request body too large"
+// @Failure 415 {object} utils.Problem "Content-Type is not application/json"
+// @Failure 500 {object} utils.Problem "Internal server error"
 // @Router /messages [post]
 func (h *MessageHandler) CreateMessage(w http.ResponseWriter, r *http.Request) {
 	var req store.CreateMessageRequest
 
-	if err := utils.ParseJSON(r, &req); err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+	if err := utils.ParseJSON(w, r, &req); err != nil {
+		utils.WriteBodyError(w, err)
 		return
 	}
 
-	if !validateMessage(req) {
-		utils.WriteError(w, http.StatusBadRequest, "Your name or message are missing.")
+	if fieldErrors := h.validateRequest(&req); len(fieldErrors) > 0 {
+		utils.WriteProblem(w, http.StatusBadRequest, utils.CodeValidationFailed, "The message is invalid.", fieldErrors...)
 		return
 	}
 
-	newMessage := store.Message{
-		ID:       strconv.Itoa(len(h.Message)),
-		From:     req.From,
-		Text:     req.Text,
-		TimeSent: time.Now().UTC(),
+	req.RoomID = roomID(r)
+	newMessage, err := h.Store.Create(r.Context(), req)
+	if err != nil {
+		writeStoreError(w, err)
+		return
 	}
 
-	h.Message = append(h.Message, newMessage)
-
-	respondJSON(w, http.StatusCreated, newMessage)
+	respondMessage(w, http.StatusCreated, newMessage)
 
 }
 
 // GetAllMessages godoc
 // @Summary Get all messages
-// @Description Return a list of all messages in the app
+// @Description Return a page of messages, oldest first unless sort says otherwise. Follow the opaque
+// @Description "next" and "prev" cursors in the response with the after and before parameters to walk
+// @Description the list; cursors stay valid while other clients add or delete messages, but only with
+// @Description the same sort. from, since and until narrow the list down and fields picks the fields
+// @Description returned for each message.
 // @Tags messages
 // @Produce json
+// @Param limit query int false "Page size" minimum(1) maximum(200) default(50)
+// @Param after query string false "Cursor: return messages after this position"
+// @Param before query string false "Cursor: return messages before this position"
+// @Param from query string false "Only messages from this sender"
+// @Param since query string false "Only messages sent at or after this date or RFC 3339 time"
+// @Param until query string false "Only messages sent before this date or RFC 3339 time"
+// @Param sort query string false "Order of the messages" Enums(id, time_sent, -time_sent) default(id)
+// @Param fields query string false "Comma-separated message fields to return, e.g. id,from,text"
+// @Param If-None-Match header string false "ETag of a previous response; 304 if the list is unchanged"
 // @Success 200 {object} utils.Response[[]store.Message] "message list"
-// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Header 200 {string} ETag "Tag of this list, for If-None-Match"
+// @Success 304 "Not Modified - the list still matches If-None-Match"
+// @Failure 400 {object} utils.Problem "Invalid query parameters"
+// @Failure 500 {object} utils.Problem "Internal server error"
 // @Router /messages [get]
 func (h *MessageHandler) GetAllMessages(w http.ResponseWriter, r *http.Request) {
-	respondJSON(w, http.StatusOK, h.Message)
+	q, fieldErrors := parseListQuery(r.URL.Query())
+	if len(fieldErrors) > 0 {
+		utils.WriteProblem(w, http.StatusBadRequest, utils.CodeInvalidQuery, "Invalid query parameters.", fieldErrors...)
+		return
+	}
+
+	page, err := h.Store.ListPage(r.Context(), roomID(r), q.PageQuery)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	next, prev := encodeCursor(page.Next), encodeCursor(page.Prev)
+	meta := utils.ListMeta(r, len(page.Messages))
+	meta.Pagination = &utils.Pagination{Limit: q.Limit, Next: next, Prev: prev}
+	links := utils.PageLinks(r, next, prev)
+
+	if len(q.Fields) == 0 {
+		respondList(w, r, utils.Response[[]store.Message]{Data: nonNil(page.Messages), Meta: meta, Links: links})
+		return
+	}
+	projected, err := project(page.Messages, q.Fields)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	respondList(w, r, utils.Response[[]map[string]json.RawMessage]{Data: projected, Meta: meta, Links: links})
 }
 
 // GetLatestMessages godoc
-// @Summary Get the latest 10 messages
-// @Description Return the latest 10 messages
+// @Summary Get the latest messages
+// @Description Return the latest messages by time sent: 10 unless limit says otherwise, oldest first
+// @Description unless order is desc.
 // @Tags messages
 // @Produce json
-// @Success 200 {object} utils.Response[[]store.Message] "the latest 10 messages list"
-// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Param limit query int false "How many messages to return" minimum(1) maximum(200) default(10)
+// @Param order query string false "asc for oldest first, desc for newest first" Enums(asc, desc) default(asc)
+// @Param If-None-Match header string false "ETag of a previous response; 304 if the list is unchanged"
+// @Success 200 {object} utils.Response[[]store.Message] "the latest messages"
+// @Header 200 {string} ETag "Tag of this list, for If-None-Match"
+// @Success 304 "Not Modified - the list still matches If-None-Match"
+// @Failure 400 {object} utils.Problem "Invalid limit or order"
+// @Failure 500 {object} utils.Problem "Internal server error"
 // @Router /messages/latest [get]
 func (h *MessageHandler) GetLatestMessages(w http.ResponseWriter, r *http.Request) {
-	start := max(0, len(h.Message)-10)
-	respondJSON(w, http.StatusOK, h.Message[start:])
+	q, fieldErrors := parseLatestQuery(r.URL.Query())
+	if len(fieldErrors) > 0 {
+		utils.WriteProblem(w, http.StatusBadRequest, utils.CodeInvalidQuery, "Invalid query parameters.", fieldErrors...)
+		return
+	}
+
+	page, err := h.Store.ListPage(r.Context(), roomID(r), store.PageQuery{Limit: q.Limit, Sort: store.SortByTimeDesc})
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	latestMessages := page.Messages
+	if !q.NewestFirst {
+		slices.Reverse(latestMessages)
+	}
+
+	respondList(w, r, utils.Response[[]store.Message]{
+		Data: nonNil(latestMessages),
+		Meta: utils.ListMeta(r, len(latestMessages)),
+	})
 }
 
 // GetSearchedMessages godoc
-// @Summary Get the messages that has searched if matched
-// @Description Return the messages that has searched if matched
+// @Summary Search messages
+// @Description Return a page of the messages matching text, most relevant first by BM25 score, or an
+// @Description empty page if none do. Words are matched whole, ignoring case and accents, and every
+// @Description part of text must match:
+// @Description "green tea" for a phrase, tea OR coffee for either word, -milk to exclude a word or
+// @Description phrase, from:ann (or from:"Ann Lee") for a sender, before:2026-01-01 and
+// @Description after:2026-01-01 for when it was sent (a date or RFC 3339 time), and has:reply or
+// @Description has:reaction. Filters and exclusions need a word to go with them, and can be negated
+// @Description but not joined with OR. highlight is the HTML-escaped text with the matches in <mark>
+// @Description tags.
 // @Tags messages
 // @Produce json
-// @Param text query string true "Text to search for in messages"
-// @Success 200 {object} utils.Response[[]store.Message] "the messages list if matched"
-// @Failure 400 {object} utils.ErrorResponse "Invalid request"
-// @Failure 404 {object} utils.ErrorResponse "No matching messages found"
-// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Param text query string true "What to search for, e.g. green tea OR coffee -milk from:ann"
+// @Param limit query int false "Page size" minimum(1) maximum(200) default(50)
+// @Param after query string false "Cursor: return the results after this position"
+// @Param before query string false "Cursor: return the results before this position"
+// @Param If-None-Match header string false "ETag of a previous response; 304 if the results are unchanged"
+// @Success 200 {object} utils.Response[[]store.SearchResult] "the matching messages"
+// @Header 200 {string} ETag "Tag of these results, for If-None-Match"
+// @Success 304 "Not Modified - the results still match If-None-Match"
+// @Failure 400 {object} utils.Problem "Missing or malformed text, or invalid pagination parameters"
+// @Failure 500 {object} utils.Problem "Internal server error"
 // @Router /messages/search [get]
 func (h *MessageHandler) GetSearchedMessages(w http.ResponseWriter, r *http.Request) {
-	text := r.URL.Query().Get("text")
-
-	if text == "" {
-		utils.WriteError(w, http.StatusBadRequest, "Please fill the text field")
+	q, fieldErrors := parseSearchQuery(r.URL.Query())
+	if len(fieldErrors) > 0 {
+		utils.WriteProblem(w, http.StatusBadRequest, utils.CodeInvalidQuery, "Invalid search.", fieldErrors...)
 		return
 	}
 
-	var matchedMessages []store.Message
-	for _, message := range h.Message {
-		if strings.Contains(strings.ToLower(message.Text), strings.ToLower(text)) {
-			matchedMessages = append(matchedMessages, message)
-		}
-	}
-	if len(matchedMessages) == 0 {
-		utils.WriteError(w, http.StatusNotFound, "Not found the message that has matched")
+	page, err := h.Store.Search(r.Context(), roomID(r), q)
+	if err != nil {
+		writeStoreError(w, err)
 		return
 	}
 
-	respondJSON(w, http.StatusOK, matchedMessages)
+	next, prev := encodeCursor(page.Next), encodeCursor(page.Prev)
+	meta := utils.ListMeta(r, len(page.Results))
+	meta.Pagination = &utils.Pagination{Limit: q.Limit, Next: next, Prev: prev}
+	respondList(w, r, utils.Response[[]store.SearchResult]{
+		Data:  nonNil(page.Results),
+		Meta:  meta,
+		Links: utils.PageLinks(r, next, prev),
+	})
 }
 
 // GetMessage godoc
@@ -137,100 +236,457 @@ func (h *MessageHandler) GetSearchedMessages(w http.ResponseWriter, r *http.Requ
 // @Produce json
 // @Param messageId path string true "Message ID"
 // @Success 200 {object} utils.Response[store.Message] "the message if matched"
-// @Failure 404 {object} utils.ErrorResponse "No matching messages found"
-// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Header 200 {string} ETag "Tag of the message's version, reactions and replies, for If-Match"
+// @Failure 404 {object} utils.Problem "No matching messages found"
+// @Failure 500 {object} utils.Problem "Internal server error"
 // @Router /messages/{messageId} [get]
 func (h *MessageHandler) GetMessage(w http.ResponseWriter, r *http.Request) {
 	messageId := chi.URLParam(r, "messageId")
-	for _, message := range h.Message {
-		if message.ID == messageId {
-			respondJSON(w, http.StatusOK, message)
-			return
-		}
+
+	message, err := h.getInRoom(r, messageId)
+	if err != nil {
+		writeStoreError(w, err)
+		return
 	}
-	utils.WriteError(w, http.StatusNotFound, "Message not found")
+
+	respondMessage(w, http.StatusOK, message)
 }
 
 // UpdateMessage godoc
 // @Summary Update a message by ID
-// @Description Return an updated message by ID
+// @Description Return an updated message by ID. An update that changes the sender or text sets
+// @Description edited_at and records the previous version as a revision, crediting editor or, if it
+// @Description is empty, from. parent_id is ignored: replies cannot be moved. Send the ETag from GET as
+// @Description If-Match to fail with 412 instead of overwriting someone else's change; new reactions and
+// @Description replies count as changes too.
 // @Tags messages
 // @Accept json
 // @Produce json
 // @Param messageId path string true "Message ID"
 // @Param message body store.CreateMessageRequest true "Updated message content"
+// @Param If-Match header string false "ETag the message must still have"
 // @Success 200 {object} utils.Response[store.Message] "the updated message"
-// @Failure 404 {object} utils.ErrorResponse "No matching messages found"
-// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Header 200 {string} ETag "Tag of the updated message"
+// @Failure 400 {object} utils.Problem "Invalid request"
+// @Failure 404 {object} utils.Problem "No matching messages found"
+// @Failure 412 {object} utils.Problem "The message no longer matches If-Match"
+// @Failure 413 {object} utils.Problem "Request body too large"
+// @Failure 415 {object} utils.Problem "Content-Type is not application/json"
+// @Failure 500 {object} utils.Problem "Internal server error"
 // @Router /messages/{messageId} [put]
 func (h *MessageHandler) UpdateMessage(w http.ResponseWriter, r *http.Request) {
 
 	messageId := chi.URLParam(r, "messageId")
 
-	var existingMessage *store.Message
 	var req store.CreateMessageRequest
 
-	for i := range h.Message {
-		if h.Message[i].ID == messageId {
-			existingMessage = &h.Message[i]
-			break
-		}
+	if err := utils.ParseJSON(w, r, &req); err != nil {
+		utils.WriteBodyError(w, err)
+		return
+	}
+
+	if fieldErrors := h.validateRequest(&req); len(fieldErrors) > 0 {
+		utils.WriteProblem(w, http.StatusBadRequest, utils.CodeValidationFailed, "The message is invalid.", fieldErrors...)
+		return
+	}
+
+	message, err := h.getInRoom(r, messageId)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if !checkIfMatch(w, r, message) {
+		return
+	}
+	if r.Header.Get("If-Match") != "" {
+		req.Version = message.Version
 	}
 
-	if existingMessage == nil {
-		utils.WriteError(w, http.StatusNotFound, "Message not found")
+	updatedMessage, err := h.Store.Update(r.Context(), messageId, req)
+	if err != nil {
+		writeStoreError(w, err)
 		return
 	}
 
-	if err := utils.ParseJSON(r, &req); err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+	respondMessage(w, http.StatusOK, updatedMessage)
+}
+
+// messagePatch is the document a PATCH edits: the fields of a message a
+// client can change, plus who is making the change.
+type messagePatch struct {
+	From   string `json:"from"`
+	Text   string `json:"text"`
+	Editor string `json:"editor,omitempty"`
+}
+
+// PatchMessage godoc
+// @Summary Partially update a message by ID
+// @Description Change only some of a message's fields. With application/merge-patch+json (RFC 7386) the
+// @Description body is an object whose from and text replace the current ones; with
+// @Description application/json-patch+json (RFC 6902) it is a list of operations on /from, /text and
+// @Description /editor. editor credits the change as with PUT. The patched message is validated like a PUT.
+// @Description If-Match works as with PUT.
+// @Tags messages
+// @Accept application/merge-patch+json
+// @Accept application/json-patch+json
+// @Produce json
+// @Param messageId path string true "Message ID"
+// @Param patch body handlers.messagePatch true "Merge patch, e.g. {\"text\": \"Hello\"}, or a JSON Patch array"
+// @Param If-Match header string false "ETag the message must still have"
+// @Success 200 {object} utils.Response[store.Message] "the updated message"
+// @Header 200 {string} ETag "Tag of the updated message"
+// @Failure 400 {object} utils.Problem "Malformed patch, or the patched message is invalid"
+// @Failure 404 {object} utils.Problem "No matching messages found"
+// @Failure 409 {object} utils.Problem "A JSON Patch operation could not be applied, such as a failed test"
+// @Failure 412 {object} utils.Problem "The message no longer matches If-Match"
+// @Failure 413 {object} utils.Problem "Request body too large"
+// @Failure 415 {object} utils.Problem "Content-Type is not a supported patch format"
+// @Failure 500 {object} utils.Problem "Internal server error"
+// @Router /messages/{messageId} [patch]
+func (h *MessageHandler) PatchMessage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Accept-Patch", utils.MergePatchContentType+", "+utils.JSONPatchContentType)
+	messageId := chi.URLParam(r, "messageId")
+
+	var patch json.RawMessage
+	if err := utils.ParseJSONAs(w, r, &patch, utils.MergePatchContentType, utils.JSONPatchContentType); err != nil {
+		utils.WriteBodyError(w, err)
 		return
 	}
 
-	if !validateMessage(req) {
-		utils.WriteError(w, http.StatusBadRequest, "Your name or message are missing.")
+	// The patch is applied to the message as read, so the update must
+	// find it unchanged. Without If-Match a concurrent change is not the
+	// client's concern and the patch is simply applied again.
+	for attempt := 1; ; attempt++ {
+		message, err := h.getInRoom(r, messageId)
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		if !checkIfMatch(w, r, message) {
+			return
+		}
+
+		req, err := applyPatch(message, patch, r.Header.Get("Content-Type"))
+		if err != nil {
+			utils.WriteBodyError(w, err)
+			return
+		}
+		if fieldErrors := h.validateRequest(&req); len(fieldErrors) > 0 {
+			utils.WriteProblem(w, http.StatusBadRequest, utils.CodeValidationFailed, "The patched message is invalid.", fieldErrors...)
+			return
+		}
+		req.Version = message.Version
+
+		updatedMessage, err := h.Store.Update(r.Context(), messageId, req)
+		if errors.Is(err, store.ErrVersionMismatch) && r.Header.Get("If-Match") == "" && attempt < maxPatchAttempts {
+			continue
+		}
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+
+		respondMessage(w, http.StatusOK, updatedMessage)
 		return
 	}
+}
+
+// maxPatchAttempts bounds how often PatchMessage reapplies a patch that
+// lost a race with another change.
+const maxPatchAttempts = 3
 
-	existingMessage.From = req.From
-	existingMessage.Text = req.Text
+// applyPatch applies a patch in the given format to message and returns
+// the resulting update.
+func applyPatch(message store.Message, patch []byte, contentType string) (store.CreateMessageRequest, error) {
+	doc, err := json.Marshal(messagePatch{From: message.From, Text: message.Text})
+	if err != nil {
+		return store.CreateMessageRequest{}, err
+	}
 
-	respondJSON(w, http.StatusOK, existingMessage)
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType == utils.JSONPatchContentType {
+		doc, err = utils.ApplyJSONPatch(doc, patch)
+	} else if bytes.HasPrefix(bytes.TrimSpace(patch), []byte("{")) {
+		doc, err = utils.ApplyMergePatch(doc, patch)
+	} else {
+		err = &utils.BodyError{
+			Status: http.StatusBadRequest,
+			Code:   utils.CodeInvalidBody,
+			Detail: "A merge patch for a message must be a JSON object.",
+		}
+	}
+	if err != nil {
+		return store.CreateMessageRequest{}, err
+	}
+
+	var patched messagePatch
+	if err := utils.DecodeJSON(doc, &patched); err != nil {
+		return store.CreateMessageRequest{}, err
+	}
+	return store.CreateMessageRequest{From: patched.From, Text: patched.Text, Editor: patched.Editor}, nil
 }
 
 // DeleteMessage godoc
 // @Summary Delete a message by ID
-// @Description Deletes a message with the specified ID and returns no content on success
+// @Description Deletes a message with the specified ID and returns no content on success. The message
+// @Description becomes a tombstone that is left out of lists and search and cannot be edited, but can
+// @Description be brought back with POST /messages/{messageId}/restore until it is purged. A tombstone
+// @Description with replies can still be read, with deleted_at set and its sender and text blanked.
+// @Description If-Match works as with PUT.
 // @Tags messages
 // @Produce json
 // @Param messageId path string true "Message ID"
+// @Param If-Match header string false "ETag the message must still have"
 // @Success 204 "No Content - Message successfully deleted"
-// @Failure 404 {object} utils.ErrorResponse "No matching message found"
-// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Failure 404 {object} utils.Problem "No matching message found"
+// @Failure 412 {object} utils.Problem "The message no longer matches If-Match"
+// @Failure 500 {object} utils.Problem "Internal server error"
 // @Router /messages/{messageId} [delete]
 func (h *MessageHandler) DeleteMessage(w http.ResponseWriter, r *http.Request) {
 	messageId := chi.URLParam(r, "messageId")
 
-	index := -1
-	for i, message := range h.Message {
-		if message.ID == messageId {
-			index = i
-			break
-		}
+	message, err := h.getInRoom(r, messageId)
+	if err != nil {
+		writeStoreError(w, err)
+		return
 	}
-
-	if index == -1 {
-		utils.WriteError(w, http.StatusNotFound, "Message not found")
+	if !checkIfMatch(w, r, message) {
 		return
 	}
+	version := 0
+	if r.Header.Get("If-Match") != "" {
+		version = message.Version
+	}
 
-	h.Message = slices.Delete(h.Message, index, index+1)
+	if err := h.Store.Delete(r.Context(), messageId, version); err != nil {
+		writeStoreError(w, err)
+		return
+	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
-func respondJSON[T utils.MessageData](w http.ResponseWriter, status int, data T) {
-	if err := utils.WriteJSON(w, status, data); err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+// RestoreMessage godoc
+// @Summary Restore a deleted message
+// @Description Undo the deletion of a message, with its text, reactions and edit history, as long as it
+// @Description has not been purged yet. Restoring a message that is not deleted returns it unchanged.
+// @Description Requires the server's admin token.
+// @Tags messages
+// @Produce json
+// @Security AdminToken
+// @Param messageId path string true "Message ID"
+// @Success 200 {object} utils.Response[store.Message] "The restored message"
+// @Header 200 {string} ETag "Tag of the updated message"
+// @Failure 401 {object} utils.Problem "Missing or wrong admin token"
+// @Failure 403 {object} utils.Problem "The server has no admin token configured"
+// @Failure 404 {object} utils.Problem "No matching message found, or it was purged"
+// @Failure 500 {object} utils.Problem "Internal server error"
+// @Router /messages/{messageId}/restore [post]
+func (h *MessageHandler) RestoreMessage(w http.ResponseWriter, r *http.Request) {
+	messageId := chi.URLParam(r, "messageId")
+
+	restoredMessage, _, err := h.Store.Restore(r.Context(), messageId)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	respondMessage(w, http.StatusOK, restoredMessage)
+}
+
+// GetReplies godoc
+// @Summary Get the replies to a message
+// @Description Return a page of the direct replies to a message, oldest first; see GET /messages for the cursors
+// @Tags messages
+// @Produce json
+// @Param messageId path string true "Message ID"
+// @Param limit query int false "Page size" minimum(1) maximum(200) default(50)
+// @Param after query string false "Cursor: return replies after this position"
+// @Param before query string false "Cursor: return replies before this position"
+// @Param If-None-Match header string false "ETag of a previous response; 304 if the list is unchanged"
+// @Success 200 {object} utils.Response[[]store.Message] "reply list"
+// @Header 200 {string} ETag "Tag of this list, for If-None-Match"
+// @Success 304 "Not Modified - the list still matches If-None-Match"
+// @Failure 400 {object} utils.Problem "Invalid pagination parameters"
+// @Failure 404 {object} utils.Problem "No matching message found"
+// @Failure 500 {object} utils.Problem "Internal server error"
+// @Router /messages/{messageId}/replies [get]
+func (h *MessageHandler) GetReplies(w http.ResponseWriter, r *http.Request) {
+	messageId := chi.URLParam(r, "messageId")
+
+	q, fieldErrors := parsePageQuery(r.URL.Query())
+	if len(fieldErrors) > 0 {
+		utils.WriteProblem(w, http.StatusBadRequest, utils.CodeInvalidQuery, "Invalid pagination parameters.", fieldErrors...)
+		return
+	}
+
+	if _, err := h.getInRoom(r, messageId); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	page, err := h.Store.Replies(r.Context(), messageId, q)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	next, prev := encodeCursor(page.Next), encodeCursor(page.Prev)
+	meta := utils.ListMeta(r, len(page.Messages))
+	meta.Pagination = &utils.Pagination{Limit: q.Limit, Next: next, Prev: prev}
+
+	respondList(w, r, utils.Response[[]store.Message]{
+		Data:  nonNil(page.Messages),
+		Meta:  meta,
+		Links: utils.PageLinks(r, next, prev),
+	})
+}
+
+// GetRevisions godoc
+// @Summary Get the edit history of a message
+// @Description Return every edit of a message, oldest first, with when and by whom it was made and
+// @Description the sender and text it replaced. Deleted messages show no history until restored.
+// @Tags messages
+// @Produce json
+// @Param messageId path string true "Message ID"
+// @Param If-None-Match header string false "ETag of a previous response; 304 if the list is unchanged"
+// @Success 200 {object} utils.Response[[]store.Revision] "revision list"
+// @Header 200 {string} ETag "Tag of this list, for If-None-Match"
+// @Success 304 "Not Modified - the list still matches If-None-Match"
+// @Failure 404 {object} utils.Problem "No matching message found"
+// @Failure 500 {object} utils.Problem "Internal server error"
+// @Router /messages/{messageId}/revisions [get]
+func (h *MessageHandler) GetRevisions(w http.ResponseWriter, r *http.Request) {
+	messageId := chi.URLParam(r, "messageId")
+
+	if _, err := h.getInRoom(r, messageId); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	revisions, err := h.Store.Revisions(r.Context(), messageId)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	respondList(w, r, utils.Response[[]store.Revision]{
+		Data: nonNil(revisions),
+		Meta: utils.ListMeta(r, len(revisions)),
+	})
+}
+
+func respondJSON[T any](w http.ResponseWriter, status int, data T) {
+	respond(w, status, utils.Response[T]{Data: data})
+}
+
+// respondMessage writes m with messageETag as the ETag.
+func respondMessage(w http.ResponseWriter, status int, m store.Message) {
+	w.Header().Set("ETag", messageETag(m))
+	respondJSON(w, status, m)
+}
+
+// messageETag tags m by its version and by its reactions and reply count,
+// which change without changing the version.
+func messageETag(m store.Message) string {
+	return utils.VersionETag(m.Version, m.Reactions, m.ReplyCount)
+}
+
+// respondList writes a 200 list response tagged with an ETag of its data
+// and links, or 304 Not Modified if the client already has it.
+func respondList[T any](w http.ResponseWriter, r *http.Request, response utils.Response[T]) {
+	etag, err := utils.ContentETag(utils.Response[T]{Data: response.Data, Links: response.Links})
+	if err != nil {
+		log.Printf("tagging response: %v", err)
+	} else {
+		w.Header().Set("ETag", etag)
+		if utils.NotModified(r, etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	respond(w, http.StatusOK, response)
+}
+
+// checkIfMatch checks the If-Match header of r against message, writing a
+// 412 and returning false if the client's copy is out of date.
+func checkIfMatch(w http.ResponseWriter, r *http.Request, message store.Message) bool {
+	if utils.IfMatch(r, messageETag(message)) {
+		return true
+	}
+	writeStoreError(w, store.ErrVersionMismatch)
+	return false
+}
+
+func respond[T any](w http.ResponseWriter, status int, response utils.Response[T]) {
+	if err := utils.WriteResponse(w, status, response); err != nil {
+		log.Printf("writing response: %v", err)
+	}
+}
+
+// nonNil makes empty lists encode as [] rather than null.
+func nonNil[T any](items []T) []T {
+	if items == nil {
+		return []T{}
+	}
+	return items
+}
+
+// validateRequest applies the rules shared by every way of creating or
+// editing a message, trimming req in place.
+func (h *MessageHandler) validateRequest(req *store.CreateMessageRequest) []utils.FieldError {
+	return validate.Struct(req, h.Limits)
+}
+
+// roomID returns the room named in the URL; the top-level /messages
+// routes have none and use the default room.
+func roomID(r *http.Request) string {
+	if id := chi.URLParam(r, "roomId"); id != "" {
+		return id
+	}
+	return store.DefaultRoomID
+}
+
+// getInRoom fetches message id, treating messages from other rooms than
+// the request's as missing.
+func (h *MessageHandler) getInRoom(r *http.Request, id string) (store.Message, error) {
+	message, err := h.Store.Get(r.Context(), id)
+	if err != nil {
+		return store.Message{}, err
+	}
+	if message.RoomID != roomID(r) {
+		return store.Message{}, store.ErrNotFound
+	}
+	return message, nil
+}
+
+func writeStoreError(w http.ResponseWriter, err error) {
+	problem := storeProblem(err)
+	utils.WriteProblem(w, problem.Status, problem.Code, problem.Detail, problem.Errors...)
+}
+
+// storeProblem describes a store error to clients, logging the ones that
+// are not their fault.
+func storeProblem(err error) utils.Problem {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		return utils.NewProblem(http.StatusNotFound, utils.CodeNotFound, "Message not found")
+	case errors.Is(err, store.ErrRoomNotFound):
+		return utils.NewProblem(http.StatusNotFound, utils.CodeNotFound, "Room not found")
+	case errors.Is(err, store.ErrInvalidCursor):
+		return utils.NewProblem(http.StatusBadRequest, utils.CodeInvalidQuery,
+			"The after or before cursor does not belong to this sort order.")
+	case errors.Is(err, store.ErrVersionMismatch):
+		return utils.NewProblem(http.StatusPreconditionFailed, utils.CodePreconditionFailed,
+			"The message has changed since it was read; fetch it again and retry.")
+	case errors.Is(err, store.ErrReactionNotFound):
+		return utils.NewProblem(http.StatusNotFound, utils.CodeNotFound, "Reaction not found")
+	case errors.Is(err, store.ErrParentNotFound):
+		return utils.NewProblem(http.StatusBadRequest, utils.CodeValidationFailed, "The message is invalid.",
+			utils.FieldError{Field: "parent_id", Code: utils.FieldInvalid, Message: "parent_id must name a message in this room"})
+	case errors.Is(err, store.ErrDefaultRoom):
+		return utils.NewProblem(http.StatusConflict, utils.CodeConflict, "The default room cannot be deleted.")
 	}
+	log.Printf("store error: %v", err)
+	return utils.NewProblem(http.StatusInternalServerError, utils.CodeInternal, "The message store failed to complete the request.")
 }
@@ -6,7 +6,9 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -18,7 +20,8 @@ import (
 
 // TestNew tests whether the New() function initialises the MessageHandler correctly
 func TestNew(t *testing.T) {
-	handler := New()
+	messageStore := store.NewMemoryStore()
+	handler := New(messageStore)
 
 	t.Run("Check if the returned handler is nil", func(t *testing.T) {
 		if handler == nil {
@@ -27,37 +30,19 @@ func TestNew(t *testing.T) {
 		}
 	})
 
-	t.Run("Check if the Message field is initialised correctly", func(t *testing.T) {
-		if handler.Message == nil {
-			t.Errorf("The Message field is nil and is expected to contain the initial message")
-		}
-	})
-
-	t.Run("Checking the length of the Message slice", func(t *testing.T) {
-		expectedLength := len(messages)
-		if len(handler.Message) != expectedLength {
-			t.Errorf("Expected Message slice length %d, actually got %d", expectedLength, len(handler.Message))
-		}
-	})
-
-	t.Run("Check if the initial message content is correct", func(t *testing.T) {
-		if len(handler.Message) > 0 {
-			firstMessage := handler.Message[0]
-			if firstMessage.ID != "0" || firstMessage.From != "Bart" || firstMessage.Text != "Welcome to CYF chat system!" {
-				t.Errorf("The initial message content is incorrect, got %+v", firstMessage)
-			}
+	t.Run("Check if the Store field is initialised correctly", func(t *testing.T) {
+		if handler.Store != messageStore {
+			t.Errorf("The Store field is %v, expected the store passed to New()", handler.Store)
 		}
 	})
 }
 
 // Initialisation function for testing to ensure consistent test environment
 func setupTestHandler() *MessageHandler {
-	return &MessageHandler{
-		Message: []store.Message{
-			{ID: "0", From: "Bart", Text: "Welcome to CYF chat system!", TimeSent: time.Now().UTC()},
-			{ID: "1", From: "Lisa", Text: "Hello everyone!", TimeSent: time.Now().UTC()},
-		},
-	}
+	return New(store.NewMemoryStore(
+		store.Message{ID: "0", From: "Bart", Text: "Welcome to CYF chat system!", TimeSent: time.Now().UTC()},
+		store.Message{ID: "1", From: "Lisa", Text: "Hello everyone!", TimeSent: time.Now().UTC()},
+	))
 }
 
 // Testing CreateMessage
@@ -73,6 +58,7 @@ func TestCreateMessage(t *testing.T) {
 		newMessage := store.CreateMessageRequest{From: testName, Text: testText} // 使用 CreateMessageRequest
 		body, _ := json.Marshal(newMessage)
 		req, _ := http.NewRequest("POST", "/api/v1/messages", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
 		rr := httptest.NewRecorder()
 
 		handler.CreateMessage(rr, req)
@@ -95,6 +81,7 @@ func TestCreateMessage(t *testing.T) {
 		invalidMessage := store.CreateMessageRequest{From: "", Text: "Invalid"}
 		body, _ := json.Marshal(invalidMessage)
 		req, _ := http.NewRequest("POST", "/api/v1/messages", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
 		rr := httptest.NewRecorder()
 
 		handler.CreateMessage(rr, req)
@@ -104,10 +91,75 @@ func TestCreateMessage(t *testing.T) {
 		}
 	})
 
+	t.Run("Missing both fields reports each one", func(t *testing.T) {
+		body, _ := json.Marshal(store.CreateMessageRequest{})
+		req, _ := http.NewRequest("POST", "/api/v1/messages", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+
+		handler.CreateMessage(rr, req)
+
+		if status := rr.Code; status != http.StatusBadRequest {
+			t.Errorf("Expected status code %v, got %v", http.StatusBadRequest, status)
+		}
+		if contentType := rr.Header().Get("Content-Type"); contentType != utils.ProblemContentType {
+			t.Errorf("Expected content type %q, got %q", utils.ProblemContentType, contentType)
+		}
+
+		var problem utils.Problem
+		if err := json.Unmarshal(rr.Body.Bytes(), &problem); err != nil {
+			t.Errorf("Failed to unmarshal response: %v", err)
+		}
+		if problem.Code != utils.CodeValidationFailed || problem.Status != http.StatusBadRequest {
+			t.Errorf("Unexpected problem: %+v", problem)
+		}
+		if len(problem.Errors) != 2 || problem.Errors[0].Field != "from" || problem.Errors[1].Field != "text" {
+			t.Errorf("Expected field errors for from and text, got %+v", problem.Errors)
+		}
+	})
+
+	t.Run("Whitespace-only fields are rejected", func(t *testing.T) {
+		body, _ := json.Marshal(store.CreateMessageRequest{From: "   ", Text: "Hello"})
+		req, _ := http.NewRequest("POST", "/api/v1/messages", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+
+		handler.CreateMessage(rr, req)
+
+		if status := rr.Code; status != http.StatusBadRequest {
+			t.Errorf("Expected status code %v, got %v", http.StatusBadRequest, status)
+		}
+	})
+
+	t.Run("Malformed body is a client error", func(t *testing.T) {
+		req, _ := http.NewRequest("POST", "/api/v1/messages", bytes.NewBufferString(`{"from": "Tom",`))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+
+		handler.CreateMessage(rr, req)
+
+		if status := rr.Code; status != http.StatusBadRequest {
+			t.Errorf("Expected status code %v, got %v", http.StatusBadRequest, status)
+		}
+	})
+
+	t.Run("Wrong content type", func(t *testing.T) {
+		req, _ := http.NewRequest("POST", "/api/v1/messages", bytes.NewBufferString(`from=Tom&text=Hello`))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+
+		handler.CreateMessage(rr, req)
+
+		if status := rr.Code; status != http.StatusUnsupportedMediaType {
+			t.Errorf("Expected status code %v, got %v", http.StatusUnsupportedMediaType, status)
+		}
+	})
+
 	t.Run("Missing Text of Required Fields", func(t *testing.T) {
 		invalidMessage := store.CreateMessageRequest{From: "Invalid", Text: ""}
 		body, _ := json.Marshal(invalidMessage)
 		req, _ := http.NewRequest("POST", "/api/v1/messages", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
 		rr := httptest.NewRecorder()
 
 		handler.CreateMessage(rr, req)
@@ -141,6 +193,89 @@ func TestGetAllMessages(t *testing.T) {
 			t.Errorf("Expected 2 messages, got %v", len(messages))
 		}
 	})
+
+	t.Run("Walk the pages with cursors", func(t *testing.T) {
+		for i := 2; i < 7; i++ {
+			handler.Store.Create(context.Background(), store.CreateMessageRequest{From: "Test", Text: "Message " + strconv.Itoa(i)})
+		}
+
+		var seen []string
+		url := "/api/v1/messages?limit=3"
+		for url != "" {
+			req, _ := http.NewRequest("GET", url, nil)
+			rr := httptest.NewRecorder()
+
+			handler.GetAllMessages(rr, req)
+
+			if status := rr.Code; status != http.StatusOK {
+				t.Fatalf("Expected status code %v, got %v", http.StatusOK, status)
+			}
+			var response utils.Response[[]store.Message]
+			if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+			for _, m := range response.Data {
+				seen = append(seen, m.ID)
+			}
+
+			if *response.Meta.Count != len(response.Data) {
+				t.Errorf("meta.count %v does not match %v messages", *response.Meta.Count, len(response.Data))
+			}
+			url = response.Links.Next
+		}
+
+		if len(seen) != 7 {
+			t.Errorf("Expected to walk 7 messages, got %v", seen)
+		}
+	})
+
+	t.Run("Filter, sort and project", func(t *testing.T) {
+		rr := serve(http.HandlerFunc(handler.GetAllMessages), "GET", "/api/v1/messages?from=Test&sort=-time_sent&limit=2", "")
+		got := decodeData[[]store.Message](t, rr.Body.Bytes())
+		if rr.Code != http.StatusOK || len(got) != 2 || got[0].Text != "Message 6" || got[1].Text != "Message 5" {
+			t.Errorf("Expected the newest two test messages, got %v %+v", rr.Code, got)
+		}
+
+		since := url.QueryEscape(got[1].TimeSent.Format(time.RFC3339Nano))
+		rr = serve(http.HandlerFunc(handler.GetAllMessages), "GET", "/api/v1/messages?since="+since+"&fields=id,text", "")
+		projected := decodeData[[]map[string]any](t, rr.Body.Bytes())
+		if len(projected) != 2 || len(projected[0]) != 2 || projected[0]["text"] != "Message 5" {
+			t.Errorf("Expected id and text of two messages, got %+v", projected)
+		}
+	})
+
+	t.Run("Reject invalid filters", func(t *testing.T) {
+		for _, query := range []string{"since=yesterday", "until=2026-13-01", "since=2026-02-01&until=2026-01-01", "sort=from", "fields=id,secret"} {
+			rr := serve(http.HandlerFunc(handler.GetAllMessages), "GET", "/api/v1/messages?"+query, "")
+			var problem utils.Problem
+			json.Unmarshal(rr.Body.Bytes(), &problem)
+			if rr.Code != http.StatusBadRequest || problem.Code != utils.CodeInvalidQuery || len(problem.Errors) != 1 {
+				t.Errorf("%s: expected one invalid_query error, got %v %+v", query, rr.Code, problem)
+			}
+		}
+
+		// A cursor from another sort order
+		rr := serve(http.HandlerFunc(handler.GetAllMessages), "GET", "/api/v1/messages?limit=1", "")
+		var response utils.Response[[]store.Message]
+		json.Unmarshal(rr.Body.Bytes(), &response)
+		rr = serve(http.HandlerFunc(handler.GetAllMessages), "GET", "/api/v1/messages?sort=time_sent&after="+response.Meta.Pagination.Next, "")
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for a cursor from another order, got %v", rr.Code)
+		}
+	})
+
+	t.Run("Reject invalid pagination parameters", func(t *testing.T) {
+		for _, query := range []string{"limit=0", "limit=1000", "limit=abc", "after=!!!", "before=bm90LWEtY3Vyc29y"} {
+			req, _ := http.NewRequest("GET", "/api/v1/messages?"+query, nil)
+			rr := httptest.NewRecorder()
+
+			handler.GetAllMessages(rr, req)
+
+			if status := rr.Code; status != http.StatusBadRequest {
+				t.Errorf("%s: expected status code %v, got %v", query, http.StatusBadRequest, status)
+			}
+		}
+	})
 }
 
 // Testing GetLatestMessages
@@ -150,8 +285,7 @@ func TestGetLatestMessages(t *testing.T) {
 	t.Run("Get Latest 10 Messages", func(t *testing.T) {
 		// Add more messages to test "latest 10" logic
 		for i := 2; i < 15; i++ {
-			handler.Message = append(handler.Message, store.Message{
-				ID:   strconv.Itoa(i),
+			handler.Store.Create(context.Background(), store.CreateMessageRequest{
 				From: "Test",
 				Text: "Message " + strconv.Itoa(i),
 			})
@@ -174,6 +308,43 @@ func TestGetLatestMessages(t *testing.T) {
 		if len(messages) != 10 {
 			t.Errorf("Expected 10 messages, got %v", len(messages))
 		}
+		if messages[0].Text != "Message 5" || messages[9].Text != "Message 14" {
+			t.Errorf("Expected messages 5 to 14 oldest first, got %q to %q", messages[0].Text, messages[9].Text)
+		}
+	})
+
+	t.Run("limit and order", func(t *testing.T) {
+		for _, tc := range []struct {
+			query string
+			want  []string
+		}{
+			{"limit=3", []string{"Message 12", "Message 13", "Message 14"}},
+			{"limit=3&order=asc", []string{"Message 12", "Message 13", "Message 14"}},
+			{"limit=3&order=desc", []string{"Message 14", "Message 13", "Message 12"}},
+			{"limit=200&order=desc", nil},
+		} {
+			rr := serve(http.HandlerFunc(handler.GetLatestMessages), "GET", "/api/v1/messages/latest?"+tc.query, "")
+			var texts []string
+			for _, m := range decodeData[[]store.Message](t, rr.Body.Bytes()) {
+				texts = append(texts, m.Text)
+			}
+			if tc.want == nil {
+				if len(texts) != 15 || texts[0] != "Message 14" || texts[14] != "Welcome to CYF chat system!" {
+					t.Errorf("%s: expected all 15 messages newest first, got %v", tc.query, texts)
+				}
+			} else if strings.Join(texts, ",") != strings.Join(tc.want, ",") {
+				t.Errorf("%s: expected %v, got %v", tc.query, tc.want, texts)
+			}
+		}
+	})
+
+	t.Run("reject invalid limit and order", func(t *testing.T) {
+		for _, query := range []string{"limit=0", "limit=201", "limit=ten", "order=newest"} {
+			rr := serve(http.HandlerFunc(handler.GetLatestMessages), "GET", "/api/v1/messages/latest?"+query, "")
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("%s: expected status 400, got %v", query, rr.Code)
+			}
+		}
 	})
 }
 
@@ -191,7 +362,7 @@ func TestGetSearchedMessages(t *testing.T) {
 			t.Errorf("Expected status code %v, got %v", http.StatusOK, status)
 		}
 
-		var response utils.Response[[]store.Message]
+		var response utils.Response[[]store.SearchResult]
 		if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
 			t.Errorf("Failed to unmarshal response: %v", err)
 		}
@@ -201,14 +372,99 @@ func TestGetSearchedMessages(t *testing.T) {
 		}
 	})
 
+	t.Run("Results are ranked and highlighted", func(t *testing.T) {
+		rr := serve(http.HandlerFunc(handler.GetSearchedMessages), "GET", "/api/v1/messages/search?text=welcome+OR+hello", "")
+		results := decodeData[[]store.SearchResult](t, rr.Body.Bytes())
+		if rr.Code != http.StatusOK || len(results) != 2 {
+			t.Fatalf("Expected 2 results, got %v %+v", rr.Code, results)
+		}
+		if results[0].Score < results[1].Score {
+			t.Errorf("Expected results in score order, got %+v", results)
+		}
+		for _, result := range results {
+			if result.ID == "1" && result.Highlight != "<mark>Hello</mark> everyone!" {
+				t.Errorf("Unexpected highlight %q", result.Highlight)
+			}
+		}
+
+		rr = serve(http.HandlerFunc(handler.GetSearchedMessages), "GET", "/api/v1/messages/search?text=hello+everyone", "")
+		if results := decodeData[[]store.SearchResult](t, rr.Body.Bytes()); len(results) != 1 || results[0].ID != "1" {
+			t.Errorf("Expected both words to be required, got %+v", results)
+		}
+	})
+
+	t.Run("Reject malformed queries", func(t *testing.T) {
+		for text, message := range map[string]string{
+			"":                 "text is required",
+			"hello+OR":         "OR must come between two words (at character 7)",
+			"OR+hello":         "OR must come between two words (at character 1)",
+			"%21%21":           "the query has no words to search for (at character 1)",
+			"hello+%22there":   "the quote has no closing quote (at character 7)",
+			"hello+has%3Acake": "has: can only be has:reply or has:reaction (at character 7)",
+			"-hello":           "add a word or phrase to search for; filters and exclusions only narrow a search down (at character 1)",
+		} {
+			rr := serve(http.HandlerFunc(handler.GetSearchedMessages), "GET", "/api/v1/messages/search?text="+text, "")
+			var problem utils.Problem
+			json.Unmarshal(rr.Body.Bytes(), &problem)
+			if rr.Code != http.StatusBadRequest || len(problem.Errors) != 1 || problem.Errors[0].Message != message {
+				t.Errorf("%s: expected 400 saying %q, got %v %s", text, message, rr.Code, rr.Body)
+			}
+		}
+	})
+
+	t.Run("Operators narrow the search", func(t *testing.T) {
+		for text, want := range map[string]string{
+			"hello+from%3Alisa":              "1",
+			"%22hello+everyone%22":           "1",
+			"welcome+OR+hello+-everyone":     "0",
+			"welcome+OR+hello+-from%3ALisa":  "0",
+			"hello+before%3A2000-01-01":      "",
+			"welcome+OR+hello+has%3Areply":   "",
+			"%22everyone+hello%22+OR+system": "0",
+		} {
+			rr := serve(http.HandlerFunc(handler.GetSearchedMessages), "GET", "/api/v1/messages/search?text="+text, "")
+			var ids []string
+			for _, result := range decodeData[[]store.SearchResult](t, rr.Body.Bytes()) {
+				ids = append(ids, result.ID)
+			}
+			if rr.Code != http.StatusOK || strings.Join(ids, ",") != want {
+				t.Errorf("%s: expected %q, got %v %v", text, want, rr.Code, ids)
+			}
+		}
+	})
+
+	t.Run("Results are paginated", func(t *testing.T) {
+		rr := serve(http.HandlerFunc(handler.GetSearchedMessages), "GET", "/api/v1/messages/search?text=welcome+OR+hello&limit=1", "")
+		var first utils.Response[[]store.SearchResult]
+		json.Unmarshal(rr.Body.Bytes(), &first)
+		if len(first.Data) != 1 || first.Links == nil || first.Links.Next == "" || first.Links.Prev != "" {
+			t.Fatalf("Expected one result and a next link, got %s", rr.Body)
+		}
+
+		rr = serve(http.HandlerFunc(handler.GetSearchedMessages), "GET", first.Links.Next, "")
+		var second utils.Response[[]store.SearchResult]
+		json.Unmarshal(rr.Body.Bytes(), &second)
+		if len(second.Data) != 1 || second.Data[0].ID == first.Data[0].ID || second.Links.Next != "" || second.Links.Prev == "" {
+			t.Errorf("Expected the other result and no next link, got %s", rr.Body)
+		}
+
+		rr = serve(http.HandlerFunc(handler.GetSearchedMessages), "GET", "/api/v1/messages/search?text=hello&after=bogus", "")
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for an invalid cursor, got %v", rr.Code)
+		}
+	})
+
 	t.Run("Search for non-existent messages", func(t *testing.T) {
 		req, _ := http.NewRequest("GET", "/api/v1/messages/search?text=Nonexistent", nil)
 		rr := httptest.NewRecorder()
 
 		handler.GetSearchedMessages(rr, req)
 
-		if status := rr.Code; status != http.StatusNotFound {
-			t.Errorf("Expected status code %v, got %v", http.StatusNotFound, status)
+		if status := rr.Code; status != http.StatusOK {
+			t.Errorf("Expected status code %v, got %v", http.StatusOK, status)
+		}
+		if !strings.Contains(rr.Body.String(), `"data":[]`) {
+			t.Errorf("Expected an empty page, got %s", rr.Body)
 		}
 	})
 }
@@ -253,6 +509,7 @@ func TestUpdateMessage(t *testing.T) {
 		updatedMessage := store.CreateMessageRequest{From: updatedName, Text: updatedText}
 		body, _ := json.Marshal(updatedMessage)
 		req, _ := http.NewRequest("PUT", "/api/v1/messages/0", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
 		rctx := chi.NewRouteContext()
 		rctx.URLParams.Add("messageId", "0")
 		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
@@ -292,8 +549,338 @@ func TestDeleteMessage(t *testing.T) {
 			t.Errorf("Expected status code %v, got %v", http.StatusNoContent, status)
 		}
 
-		if len(handler.Message) != 1 {
-			t.Errorf("Expected 1 message, got %v", len(handler.Message))
+		remaining, _ := handler.Store.List(context.Background(), store.DefaultRoomID)
+		if len(remaining) != 1 {
+			t.Errorf("Expected 1 message, got %v", len(remaining))
+		}
+	})
+
+	t.Run("delete a message that does not exist", func(t *testing.T) {
+		req, _ := http.NewRequest("DELETE", "/api/v1/messages/99", nil)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("messageId", "99")
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+		rr := httptest.NewRecorder()
+
+		handler.DeleteMessage(rr, req)
+
+		if status := rr.Code; status != http.StatusNotFound {
+			t.Errorf("Expected status code %v, got %v", http.StatusNotFound, status)
+		}
+
+		var problem utils.Problem
+		if err := json.Unmarshal(rr.Body.Bytes(), &problem); err != nil {
+			t.Errorf("Failed to unmarshal response: %v", err)
+		}
+		if problem.Code != utils.CodeNotFound {
+			t.Errorf("Expected code %q, got %q", utils.CodeNotFound, problem.Code)
+		}
+	})
+}
+
+// Testing PatchMessage with merge patches and JSON Patches
+func TestPatchMessage(t *testing.T) {
+	handler := setupTestHandler()
+	router := chi.NewRouter()
+	router.Patch("/messages/{messageId}", handler.PatchMessage)
+
+	patch := func(contentType, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("PATCH", "/messages/1", strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("merge patch changes only the text", func(t *testing.T) {
+		rr := patch("application/merge-patch+json", `{"text":" Hi all "}`)
+		got := decodeData[store.Message](t, rr.Body.Bytes())
+		if rr.Code != http.StatusOK || got.From != "Lisa" || got.Text != "Hi all" || got.EditedAt == nil {
+			t.Errorf("Expected only the text to change, got %v %+v", rr.Code, got)
+		}
+	})
+
+	t.Run("JSON Patch with a test", func(t *testing.T) {
+		rr := patch("application/json-patch+json",
+			`[{"op":"test","path":"/text","value":"Hi all"},{"op":"replace","path":"/from","value":"Bart"},{"op":"add","path":"/editor","value":"Marge"}]`)
+		got := decodeData[store.Message](t, rr.Body.Bytes())
+		if rr.Code != http.StatusOK || got.From != "Bart" || got.Text != "Hi all" {
+			t.Errorf("Expected the sender to change, got %v %+v", rr.Code, got)
+		}
+		revisions, _ := handler.Store.Revisions(context.Background(), "1")
+		if len(revisions) != 2 || revisions[1].Editor != "Marge" {
+			t.Errorf("Expected Marge to be credited, got %+v", revisions)
+		}
+
+		if rr := patch("application/json-patch+json", `[{"op":"test","path":"/text","value":"Stale"}]`); rr.Code != http.StatusConflict {
+			t.Errorf("Expected status 409 for a failed test, got %v", rr.Code)
+		}
+	})
+
+	t.Run("the patched message is validated", func(t *testing.T) {
+		rr := patch("application/merge-patch+json", `{"text":null}`)
+		var problem utils.Problem
+		json.Unmarshal(rr.Body.Bytes(), &problem)
+		if rr.Code != http.StatusBadRequest || problem.Code != utils.CodeValidationFailed || len(problem.Errors) != 1 || problem.Errors[0].Field != "text" {
+			t.Errorf("Expected a text validation error, got %v %+v", rr.Code, problem)
+		}
+	})
+
+	t.Run("bad patches are rejected", func(t *testing.T) {
+		for _, tc := range []struct {
+			contentType, body string
+			status            int
+		}{
+			{"application/json", `{"text":"Hi"}`, http.StatusUnsupportedMediaType},
+			{"application/merge-patch+json", `["text"]`, http.StatusBadRequest},
+			{"application/merge-patch+json", `{"id":"7"}`, http.StatusBadRequest},
+			{"application/merge-patch+json", `{"text":5}`, http.StatusBadRequest},
+			{"application/json-patch+json", `[{"op":"remove","path":"/id"}]`, http.StatusConflict},
+		} {
+			if rr := patch(tc.contentType, tc.body); rr.Code != tc.status {
+				t.Errorf("%s %s: expected status %v, got %v: %s", tc.contentType, tc.body, tc.status, rr.Code, rr.Body)
+			}
+		}
+		if rr := patch("application/json", `{}`); rr.Header().Get("Accept-Patch") == "" {
+			t.Errorf("Expected an Accept-Patch header")
+		}
+	})
+}
+
+// Testing deleted messages are hidden until RestoreMessage
+func TestRestoreMessage(t *testing.T) {
+	handler := setupTestHandler()
+	router := chi.NewRouter()
+	router.Get("/messages", handler.GetAllMessages)
+	router.Get("/messages/{messageId}", handler.GetMessage)
+	router.Delete("/messages/{messageId}", handler.DeleteMessage)
+	router.Post("/messages/{messageId}/restore", handler.RestoreMessage)
+
+	if rr := serve(router, "DELETE", "/messages/1", ""); rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %v", rr.Code)
+	}
+
+	t.Run("deleted messages are hidden", func(t *testing.T) {
+		if rr := serve(router, "GET", "/messages/1", ""); rr.Code != http.StatusNotFound {
+			t.Errorf("Expected status 404, got %v", rr.Code)
+		}
+		rr := serve(router, "GET", "/messages", "")
+		if all := decodeData[[]store.Message](t, rr.Body.Bytes()); len(all) != 1 || all[0].ID != "0" {
+			t.Errorf("Expected only message 0, got %+v", all)
+		}
+	})
+
+	t.Run("restore a deleted message", func(t *testing.T) {
+		rr := serve(router, "POST", "/messages/1/restore", "")
+		got := decodeData[store.Message](t, rr.Body.Bytes())
+		if rr.Code != http.StatusOK || got.Text != "Hello everyone!" || got.DeletedAt != nil {
+			t.Errorf("Expected the restored message, got %v %+v", rr.Code, got)
+		}
+		if rr := serve(router, "GET", "/messages/1", ""); rr.Code != http.StatusOK {
+			t.Errorf("Expected status 200 after restoring, got %v", rr.Code)
+		}
+	})
+
+	t.Run("restore a message that does not exist", func(t *testing.T) {
+		if rr := serve(router, "POST", "/messages/99/restore", ""); rr.Code != http.StatusNotFound {
+			t.Errorf("Expected status 404, got %v", rr.Code)
+		}
+	})
+}
+
+// Testing ETags, If-Match and If-None-Match
+func TestConditionalRequests(t *testing.T) {
+	handler := setupTestHandler()
+	router := chi.NewRouter()
+	router.Get("/messages", handler.GetAllMessages)
+	router.Get("/messages/{messageId}", handler.GetMessage)
+	router.Put("/messages/{messageId}", handler.UpdateMessage)
+	router.Patch("/messages/{messageId}", handler.PatchMessage)
+	router.Delete("/messages/{messageId}", handler.DeleteMessage)
+
+	conditional := func(method, url, header, etag, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, url, strings.NewReader(body))
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if method == "PATCH" {
+			req.Header.Set("Content-Type", utils.MergePatchContentType)
+		}
+		req.Header.Set(header, etag)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	var etag string
+	t.Run("GetMessage returns an ETag", func(t *testing.T) {
+		rr := serve(router, "GET", "/messages/1", "")
+		got := decodeData[store.Message](t, rr.Body.Bytes())
+		etag = rr.Header().Get("ETag")
+		if got.Version != 1 || !strings.HasPrefix(etag, `"1-`) {
+			t.Errorf("Expected version 1 and a strong ETag for it, got %v and %q", got.Version, etag)
+		}
+	})
+
+	t.Run("reactions and replies change the ETag", func(t *testing.T) {
+		ctx := context.Background()
+		handler.Store.React(ctx, "1", "👍", "Lisa")
+		rr := serve(router, "GET", "/messages/1", "")
+		reacted := rr.Header().Get("ETag")
+		if reacted == etag || !strings.HasPrefix(reacted, `"1-`) {
+			t.Errorf("Expected a new ETag for version 1, got %q after %q", reacted, etag)
+		}
+
+		handler.Store.Create(ctx, store.CreateMessageRequest{From: "Bart", Text: "Re", ParentID: "1"})
+		rr = serve(router, "GET", "/messages/1", "")
+		if replied := rr.Header().Get("ETag"); replied == reacted || replied == etag {
+			t.Errorf("Expected a new ETag after a reply, got %q", replied)
+		}
+		if rr := conditional("PUT", "/messages/1", "If-Match", etag, `{"from":"Lisa","text":"Stale"}`); rr.Code != http.StatusPreconditionFailed {
+			t.Errorf("Expected status 412 for the ETag from before the reaction, got %v", rr.Code)
+		}
+		etag = rr.Header().Get("ETag")
+	})
+
+	t.Run("PUT with a current If-Match", func(t *testing.T) {
+		rr := conditional("PUT", "/messages/1", "If-Match", etag, `{"from":"Lisa","text":"Hi"}`)
+		got := decodeData[store.Message](t, rr.Body.Bytes())
+		if rr.Code != http.StatusOK || got.Version != 2 || !strings.HasPrefix(rr.Header().Get("ETag"), `"2-`) {
+			t.Errorf("Expected version 2, got %v %+v %q", rr.Code, got, rr.Header().Get("ETag"))
+		}
+	})
+
+	t.Run("stale If-Match is refused", func(t *testing.T) {
+		for _, tc := range []struct{ method, body string }{
+			{"PUT", `{"from":"Lisa","text":"Stale"}`},
+			{"PATCH", `{"text":"Stale"}`},
+			{"DELETE", ""},
+		} {
+			rr := conditional(tc.method, "/messages/1", "If-Match", etag, tc.body)
+			var problem utils.Problem
+			json.Unmarshal(rr.Body.Bytes(), &problem)
+			if rr.Code != http.StatusPreconditionFailed || problem.Code != utils.CodePreconditionFailed {
+				t.Errorf("%s: expected status 412, got %v %+v", tc.method, rr.Code, problem)
+			}
+		}
+		if got, _ := handler.Store.Get(context.Background(), "1"); got.Text != "Hi" {
+			t.Errorf("Expected the message to be unchanged, got %+v", got)
+		}
+	})
+
+	t.Run("DELETE with a current If-Match", func(t *testing.T) {
+		current := serve(router, "GET", "/messages/1", "").Header().Get("ETag")
+		if rr := conditional("DELETE", "/messages/1", "If-Match", `W/"1", `+current, ""); rr.Code != http.StatusNoContent {
+			t.Errorf("Expected status 204, got %v", rr.Code)
+		}
+	})
+
+	t.Run("list If-None-Match", func(t *testing.T) {
+		rr := serve(router, "GET", "/messages", "")
+		etag := rr.Header().Get("ETag")
+		if etag == "" {
+			t.Fatalf("Expected an ETag on the list")
+		}
+		if rr := conditional("GET", "/messages", "If-None-Match", etag, ""); rr.Code != http.StatusNotModified || rr.Body.Len() != 0 {
+			t.Errorf("Expected an empty 304, got %v %s", rr.Code, rr.Body)
+		}
+
+		conditional("PUT", "/messages/0", "If-Match", "*", `{"from":"Bart","text":"Changed"}`)
+		if rr := conditional("GET", "/messages", "If-None-Match", etag, ""); rr.Code != http.StatusOK || rr.Header().Get("ETag") == etag {
+			t.Errorf("Expected a new list after a change, got %v", rr.Code)
+		}
+	})
+}
+
+// Testing replies, GetReplies and deleting a parent
+func TestGetReplies(t *testing.T) {
+	handler := setupTestHandler()
+	router := chi.NewRouter()
+	router.Post("/messages", handler.CreateMessage)
+	router.Get("/messages/{messageId}", handler.GetMessage)
+	router.Delete("/messages/{messageId}", handler.DeleteMessage)
+	router.Get("/messages/{messageId}/replies", handler.GetReplies)
+
+	for _, text := range []string{"First", "Second"} {
+		if rr := serve(router, "POST", "/messages", `{"from":"Tom","text":"`+text+`","parent_id":" 0 "}`); rr.Code != http.StatusCreated {
+			t.Fatalf("Expected status 201, got %v: %s", rr.Code, rr.Body)
+		}
+	}
+
+	t.Run("list replies", func(t *testing.T) {
+		rr := serve(router, "GET", "/messages/0/replies?limit=1", "")
+		replies := decodeData[[]store.Message](t, rr.Body.Bytes())
+		if rr.Code != http.StatusOK || len(replies) != 1 || replies[0].Text != "First" || replies[0].ParentID != "0" {
+			t.Errorf("Expected the first reply, got %v %+v", rr.Code, replies)
+		}
+		if !strings.Contains(rr.Body.String(), `"next"`) {
+			t.Errorf("Expected a next link, got %s", rr.Body)
+		}
+
+		rr = serve(router, "GET", "/messages/0", "")
+		if got := decodeData[store.Message](t, rr.Body.Bytes()); got.ReplyCount != 2 {
+			t.Errorf("Expected a reply count of 2, got %+v", got)
+		}
+	})
+
+	t.Run("reply to a missing message", func(t *testing.T) {
+		rr := serve(router, "POST", "/messages", `{"from":"Tom","text":"Hi","parent_id":"99"}`)
+		var problem utils.Problem
+		json.Unmarshal(rr.Body.Bytes(), &problem)
+		if rr.Code != http.StatusBadRequest || len(problem.Errors) != 1 || problem.Errors[0].Field != "parent_id" {
+			t.Errorf("Expected a parent_id error, got %v %+v", rr.Code, problem)
+		}
+		if rr := serve(router, "GET", "/messages/99/replies", ""); rr.Code != http.StatusNotFound {
+			t.Errorf("Expected status 404, got %v", rr.Code)
+		}
+	})
+
+	t.Run("deleting a parent leaves a tombstone", func(t *testing.T) {
+		if rr := serve(router, "DELETE", "/messages/0", ""); rr.Code != http.StatusNoContent {
+			t.Fatalf("Expected status 204, got %v", rr.Code)
+		}
+		rr := serve(router, "GET", "/messages/0", "")
+		if got := decodeData[store.Message](t, rr.Body.Bytes()); got.DeletedAt == nil || got.Text != "" || got.ReplyCount != 2 {
+			t.Errorf("Expected a tombstone, got %+v", got)
+		}
+		if rr := serve(router, "DELETE", "/messages/0", ""); rr.Code != http.StatusNotFound {
+			t.Errorf("Expected status 404 deleting a tombstone, got %v", rr.Code)
+		}
+	})
+}
+
+// Testing GetRevisions
+func TestGetRevisions(t *testing.T) {
+	handler := setupTestHandler()
+	router := chi.NewRouter()
+	router.Put("/messages/{messageId}", handler.UpdateMessage)
+	router.Get("/messages/{messageId}/revisions", handler.GetRevisions)
+
+	original, _ := handler.Store.Get(context.Background(), "0")
+	rr := serve(router, "PUT", "/messages/0", `{"from":"Marge","text":"Edited","editor":" Moderator "}`)
+	if got := decodeData[store.Message](t, rr.Body.Bytes()); rr.Code != http.StatusOK || got.EditedAt == nil {
+		t.Fatalf("Expected an edited message, got %v %s", rr.Code, rr.Body)
+	}
+
+	t.Run("list revisions", func(t *testing.T) {
+		rr := serve(router, "GET", "/messages/0/revisions", "")
+		revisions := decodeData[[]store.Revision](t, rr.Body.Bytes())
+		if rr.Code != http.StatusOK || len(revisions) != 1 {
+			t.Fatalf("Expected one revision, got %v %+v", rr.Code, revisions)
+		}
+		if got := revisions[0]; got.Number != 1 || got.Editor != "Moderator" || got.From != original.From || got.Text != original.Text {
+			t.Errorf("Expected the original content edited by Moderator, got %+v", got)
+		}
+
+		rr = serve(router, "GET", "/messages/1/revisions", "")
+		if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"data":[]`) {
+			t.Errorf("Expected an empty history, got %v %s", rr.Code, rr.Body)
+		}
+	})
+
+	t.Run("revisions of a missing message", func(t *testing.T) {
+		if rr := serve(router, "GET", "/messages/99/revisions", ""); rr.Code != http.StatusNotFound {
+			t.Errorf("Expected status 404, got %v", rr.Code)
 		}
 	})
 }
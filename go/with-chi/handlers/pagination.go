@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"node-week-02-with-chi/store"
+	"node-week-02-with-chi/utils"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 200
+
+	cursorPrefix = "msg:"
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// encodeCursor hides the message ID behind an opaque token so clients do
+// not come to depend on the ID format.
+func encodeCursor(id string) string {
+	if id == "" {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(cursorPrefix + id))
+}
+
+func decodeCursor(cursor string) (string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", errInvalidCursor
+	}
+	id, ok := strings.CutPrefix(string(raw), cursorPrefix)
+	if !ok || id == "" {
+		return "", errInvalidCursor
+	}
+	return id, nil
+}
+
+// parsePageQuery reads limit, after and before from the query string,
+// reporting every invalid parameter.
+func parsePageQuery(query url.Values) (store.PageQuery, []utils.FieldError) {
+	var q store.PageQuery
+	var fieldErrors []utils.FieldError
+
+	q.Limit, fieldErrors = parseLimit(query, defaultPageLimit, fieldErrors)
+
+	for _, param := range []struct {
+		name string
+		dest *string
+	}{{"after", &q.After}, {"before", &q.Before}} {
+		cursor := query.Get(param.name)
+		if cursor == "" {
+			continue
+		}
+		id, err := decodeCursor(cursor)
+		if err != nil {
+			fieldErrors = append(fieldErrors, utils.FieldError{
+				Field:   param.name,
+				Code:    utils.FieldInvalid,
+				Message: param.name + " is not a valid cursor",
+			})
+		}
+		*param.dest = id
+	}
+
+	return q, fieldErrors
+}
+
+// parseLimit reads limit from the query string, defaulting to def, and
+// appends to fieldErrors if it is out of range.
+func parseLimit(query url.Values, def int, fieldErrors []utils.FieldError) (int, []utils.FieldError) {
+	limit := query.Get("limit")
+	if limit == "" {
+		return def, fieldErrors
+	}
+	n, err := strconv.Atoi(limit)
+	if err != nil || n < 1 || n > maxPageLimit {
+		fieldErrors = append(fieldErrors, utils.FieldError{
+			Field:   "limit",
+			Code:    utils.FieldOutOfRange,
+			Message: "limit must be a number between 1 and " + strconv.Itoa(maxPageLimit),
+		})
+	}
+	return n, fieldErrors
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"node-week-02-with-chi/store"
+	"node-week-02-with-chi/utils"
+)
+
+const (
+	defaultPollTimeout = 30 * time.Second
+	maxPollTimeout     = 60 * time.Second
+)
+
+// PollMessages godoc
+// @Summary Long-poll for new messages
+// @Description Wait until messages newer than since exist, then return them oldest first, at most 200 at a
+// @Description time. Returns an empty list once the timeout elapses. Poll again with the "next" link,
+// @Description which carries the ID of the newest message seen. Without since, returns the oldest messages.
+// @Tags messages
+// @Produce json
+// @Param since query string false "ID of the newest message the client already has"
+// @Param timeout query string false "How long to wait, as a duration like 30s or a number of seconds" default(30s)
+// @Success 200 {object} utils.Response[[]store.Message] "new messages, possibly none"
+// @Failure 400 {object} utils.Problem "Invalid poll parameters"
+// @Failure 500 {object} utils.Problem "Internal server error"
+// @Router /messages/poll [get]
+func (h *MessageHandler) PollMessages(w http.ResponseWriter, r *http.Request) {
+	since, timeout, fieldErrors := parsePollQuery(r.URL.Query())
+	if len(fieldErrors) > 0 {
+		utils.WriteProblem(w, http.StatusBadRequest, utils.CodeInvalidQuery, "Invalid poll parameters.", fieldErrors...)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	messages, err := h.waitForMessages(ctx, roomID(r), since)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if r.Context().Err() != nil {
+		// The client went away; nobody is listening for a reply.
+		return
+	}
+
+	if len(messages) > 0 {
+		since = messages[len(messages)-1].ID
+	}
+	respond(w, http.StatusOK, utils.Response[[]store.Message]{
+		Data:  nonNil(messages),
+		Meta:  utils.ListMeta(r, len(messages)),
+		Links: utils.PollLinks(r, since),
+	})
+}
+
+// waitForMessages returns the messages in roomID after since, waiting for the store
+// to create some if there are none yet. It returns no messages once ctx
+// ends or the handler is closed.
+func (h *MessageHandler) waitForMessages(ctx context.Context, roomID, since string) ([]store.Message, error) {
+	for {
+		// Take the channel first so a message created between ListPage
+		// and the select still wakes us.
+		created := h.Store.Created()
+
+		page, err := h.Store.ListPage(ctx, roomID, store.PageQuery{Limit: maxPageLimit, After: since})
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, nil
+			}
+			return nil, err
+		}
+		if len(page.Messages) > 0 {
+			return page.Messages, nil
+		}
+
+		select {
+		case <-created:
+		case <-ctx.Done():
+			return nil, nil
+		case <-h.closed:
+			return nil, nil
+		}
+	}
+}
+
+// parsePollQuery reads since and timeout from the query string, reporting
+// every invalid parameter.
+func parsePollQuery(query url.Values) (string, time.Duration, []utils.FieldError) {
+	var fieldErrors []utils.FieldError
+
+	timeout := defaultPollTimeout
+	if raw := query.Get("timeout"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			// Allow a bare number of seconds as well.
+			seconds, atoiErr := strconv.Atoi(raw)
+			d, err = time.Duration(seconds)*time.Second, atoiErr
+		}
+		if err != nil || d < 0 || d > maxPollTimeout {
+			fieldErrors = append(fieldErrors, utils.FieldError{
+				Field:   "timeout",
+				Code:    utils.FieldOutOfRange,
+				Message: "timeout must be a duration between 0s and " + maxPollTimeout.String(),
+			})
+		}
+		timeout = d
+	}
+
+	return query.Get("since"), timeout, fieldErrors
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"node-week-02-with-chi/store"
+	"node-week-02-with-chi/utils"
+)
+
+// poll runs PollMessages for url and decodes the response.
+func poll(t *testing.T, handler *MessageHandler, url string) (int, utils.Response[[]store.Message]) {
+	t.Helper()
+	req, _ := http.NewRequest("GET", url, nil)
+	rr := httptest.NewRecorder()
+
+	handler.PollMessages(rr, req)
+
+	var response utils.Response[[]store.Message]
+	if rr.Code == http.StatusOK {
+		if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+	}
+	return rr.Code, response
+}
+
+// Testing PollMessages
+func TestPollMessages(t *testing.T) {
+	handler := setupTestHandler()
+
+	t.Run("Return newer messages immediately", func(t *testing.T) {
+		start := time.Now()
+		status, response := poll(t, handler, "/api/v1/messages/poll?since=0")
+
+		if status != http.StatusOK || len(response.Data) != 1 || response.Data[0].ID != "1" {
+			t.Fatalf("Expected message 1, got %v %+v", status, response.Data)
+		}
+		if time.Since(start) > time.Second {
+			t.Errorf("Expected no wait, took %v", time.Since(start))
+		}
+		if response.Links.Next != "/api/v1/messages/poll?since=1" {
+			t.Errorf("Expected the next link to poll since 1, got %q", response.Links.Next)
+		}
+	})
+
+	t.Run("Wait for a new message", func(t *testing.T) {
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			handler.Store.Create(context.Background(), store.CreateMessageRequest{From: "Tom", Text: "Late"})
+		}()
+
+		status, response := poll(t, handler, "/api/v1/messages/poll?since=1&timeout=10s")
+		if status != http.StatusOK || len(response.Data) != 1 || response.Data[0].Text != "Late" {
+			t.Errorf("Expected the late message, got %v %+v", status, response.Data)
+		}
+	})
+
+	t.Run("Return nothing when the timeout elapses", func(t *testing.T) {
+		status, response := poll(t, handler, "/api/v1/messages/poll?since=2&timeout=50ms")
+		if status != http.StatusOK || response.Data == nil || len(response.Data) != 0 {
+			t.Errorf("Expected an empty list, got %v %+v", status, response.Data)
+		}
+		if response.Links.Next != "/api/v1/messages/poll?since=2&timeout=50ms" {
+			t.Errorf("Expected the next link to keep since, got %q", response.Links.Next)
+		}
+	})
+
+	t.Run("Closing the handler ends the poll", func(t *testing.T) {
+		handler := setupTestHandler()
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			handler.Close()
+		}()
+
+		start := time.Now()
+		status, response := poll(t, handler, "/api/v1/messages/poll?since=1&timeout=1m")
+		if status != http.StatusOK || len(response.Data) != 0 || time.Since(start) > 5*time.Second {
+			t.Errorf("Expected an early empty response, got %v %+v after %v", status, response.Data, time.Since(start))
+		}
+	})
+
+	t.Run("Invalid parameters", func(t *testing.T) {
+		for _, query := range []string{"timeout=soon", "timeout=-1s", "timeout=2m", "timeout=61"} {
+			status, _ := poll(t, handler, "/api/v1/messages/poll?"+query)
+			if status != http.StatusBadRequest {
+				t.Errorf("%s: expected status 400, got %v", query, status)
+			}
+		}
+	})
+}
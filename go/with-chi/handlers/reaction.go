@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"unicode"
+	"unicode/utf8"
+
+	"node-week-02-with-chi/store"
+	"node-week-02-with-chi/utils"
+	"node-week-02-with-chi/validate"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// maxEmojiRunes bounds the code points in one emoji; the longest standard
+// sequences, such as families and subdivision flags, stay well under it.
+const maxEmojiRunes = 16
+
+// AddReaction godoc
+// @Summary React to a message
+// @Description Add a user's emoji reaction to a message. Each user can add each emoji once: repeating a
+// @Description reaction changes nothing and answers 200 instead of 201. The emoji is URL-encoded in the
+// @Description path and must be a single emoji, including skin tone, keycap and ZWJ sequences.
+// @Tags messages
+// @Accept json
+// @Produce json
+// @Param messageId path string true "Message ID"
+// @Param emoji path string true "Emoji"
+// @Param reaction body store.ReactionRequest true "Reacting user"
+// @Success 201 {object} utils.Response[store.Message] "the message with its new reaction counts"
+// @Success 200 {object} utils.Response[store.Message] "the user had already reacted with this emoji"
+// @Failure 400 {object} utils.Problem "Invalid emoji or user"
+// @Failure 404 {object} utils.Problem "No matching message found"
+// @Failure 413 {object} utils.Problem "Request body too large"
+// @Failure 415 {object} utils.Problem "Content-Type is not application/json"
+// @Failure 500 {object} utils.Problem "Internal server error"
+// @Router /messages/{messageId}/reactions/{emoji} [post]
+func (h *MessageHandler) AddReaction(w http.ResponseWriter, r *http.Request) {
+	messageId := chi.URLParam(r, "messageId")
+
+	var req store.ReactionRequest
+
+	if err := utils.ParseJSON(w, r, &req); err != nil {
+		utils.WriteBodyError(w, err)
+		return
+	}
+
+	emoji, fieldErrors := emojiParam(r)
+	fieldErrors = append(fieldErrors, validate.Struct(&req, nil)...)
+	if len(fieldErrors) > 0 {
+		utils.WriteProblem(w, http.StatusBadRequest, utils.CodeValidationFailed, "The reaction is invalid.", fieldErrors...)
+		return
+	}
+
+	if _, err := h.getInRoom(r, messageId); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	message, added, err := h.Store.React(r.Context(), messageId, emoji, req.User)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	status := http.StatusOK
+	if added {
+		status = http.StatusCreated
+	}
+	respondJSON(w, status, message)
+}
+
+// RemoveReaction godoc
+// @Summary Remove a reaction from a message
+// @Description Remove a user's emoji reaction from a message
+// @Tags messages
+// @Param messageId path string true "Message ID"
+// @Param emoji path string true "Emoji"
+// @Param user query string true "Reacting user"
+// @Success 204 "No Content - Reaction successfully removed"
+// @Failure 400 {object} utils.Problem "Invalid emoji or user"
+// @Failure 404 {object} utils.Problem "No matching message or reaction found"
+// @Failure 500 {object} utils.Problem "Internal server error"
+// @Router /messages/{messageId}/reactions/{emoji} [delete]
+func (h *MessageHandler) RemoveReaction(w http.ResponseWriter, r *http.Request) {
+	messageId := chi.URLParam(r, "messageId")
+
+	req := store.ReactionRequest{User: r.URL.Query().Get("user")}
+	emoji, fieldErrors := emojiParam(r)
+	fieldErrors = append(fieldErrors, validate.Struct(&req, nil)...)
+	if len(fieldErrors) > 0 {
+		utils.WriteProblem(w, http.StatusBadRequest, utils.CodeInvalidQuery, "Invalid reaction parameters.", fieldErrors...)
+		return
+	}
+
+	if _, err := h.getInRoom(r, messageId); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	if err := h.Store.Unreact(r.Context(), messageId, emoji, req.User); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// emojiParam reads the emoji path parameter, which chi leaves escaped when
+// the client's encoding differs from Go's.
+func emojiParam(r *http.Request) (string, []utils.FieldError) {
+	emoji, err := url.PathUnescape(chi.URLParam(r, "emoji"))
+	if err != nil || !validEmoji(emoji) {
+		return "", []utils.FieldError{{Field: "emoji", Code: utils.FieldInvalid, Message: "emoji must be a single emoji"}}
+	}
+	return emoji, nil
+}
+
+// validEmoji reports whether s is made of the code points emoji are built
+// from: symbols, plus the joiners, selectors, modifiers and tags that
+// combine them.
+func validEmoji(s string) bool {
+	if s == "" || !utf8.ValidString(s) || utf8.RuneCountInString(s) > maxEmojiRunes {
+		return false
+	}
+
+	var symbol, keycap bool
+	for _, r := range s {
+		switch {
+		case unicode.Is(unicode.So, r):
+			symbol = true
+		case r == '\u20e3': // combining enclosing keycap
+			keycap = true
+		case r == '\u200d', // zero width joiner
+			r == '\ufe0e', r == '\ufe0f', // text and emoji presentation selectors
+			r >= 0x1F3FB && r <= 0x1F3FF,             // skin tone modifiers
+			r >= 0xE0020 && r <= 0xE007F,             // tags of subdivision flags
+			r == '#', r == '*', r >= '0' && r <= '9': // keycap bases
+		default:
+			return false
+		}
+	}
+	return symbol || keycap
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"node-week-02-with-chi/store"
+	"node-week-02-with-chi/utils"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Testing AddReaction and RemoveReaction
+func TestReactions(t *testing.T) {
+	handler := setupTestHandler()
+	router := chi.NewRouter()
+	router.Get("/messages", handler.GetAllMessages)
+	router.Get("/messages/latest", handler.GetLatestMessages)
+	router.Get("/messages/{messageId}", handler.GetMessage)
+	router.Post("/messages/{messageId}/reactions/{emoji}", handler.AddReaction)
+	router.Delete("/messages/{messageId}/reactions/{emoji}", handler.RemoveReaction)
+
+	thumbsUp := "/messages/0/reactions/" + url.PathEscape("👍🏽")
+
+	t.Run("add reactions", func(t *testing.T) {
+		for _, c := range []struct {
+			body string
+			want int
+		}{
+			{`{"user":"Ann"}`, http.StatusCreated},
+			{`{"user":" Ann "}`, http.StatusOK},
+			{`{"user":"Bob"}`, http.StatusCreated},
+		} {
+			rr := serve(router, "POST", thumbsUp, c.body)
+			if rr.Code != c.want {
+				t.Errorf("%s: expected status %v, got %v: %s", c.body, c.want, rr.Code, rr.Body)
+			}
+		}
+
+		for _, url := range []string{"/messages/0", "/messages", "/messages/latest"} {
+			rr := serve(router, "GET", url, "")
+			var got store.Message
+			if url == "/messages/0" {
+				got = decodeData[store.Message](t, rr.Body.Bytes())
+			} else {
+				got = decodeData[[]store.Message](t, rr.Body.Bytes())[0]
+			}
+			if got.Reactions["👍🏽"] != 2 {
+				t.Errorf("%s: expected 2 reactions, got %v", url, got.Reactions)
+			}
+		}
+	})
+
+	t.Run("invalid reactions", func(t *testing.T) {
+		for _, emoji := range []string{"a", url.PathEscape("👍 "), "%25zz", "12", url.PathEscape("1️⃣👍" + "👍👍👍👍👍👍👍👍👍👍👍👍👍👍👍")} {
+			rr := serve(router, "POST", "/messages/0/reactions/"+emoji, `{"user":"Ann"}`)
+			var problem utils.Problem
+			json.Unmarshal(rr.Body.Bytes(), &problem)
+			if rr.Code != http.StatusBadRequest || len(problem.Errors) != 1 || problem.Errors[0].Field != "emoji" {
+				t.Errorf("%q: expected an emoji error, got %v %+v", emoji, rr.Code, problem)
+			}
+		}
+		for _, emoji := range []string{"1️⃣", "🇳🇱", "👩‍👩‍👧"} {
+			if rr := serve(router, "POST", "/messages/1/reactions/"+url.PathEscape(emoji), `{"user":"Ann"}`); rr.Code != http.StatusCreated {
+				t.Errorf("%q: expected status 201, got %v: %s", emoji, rr.Code, rr.Body)
+			}
+		}
+		if rr := serve(router, "POST", thumbsUp, `{"user":""}`); rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 without a user, got %v", rr.Code)
+		}
+		if rr := serve(router, "POST", "/messages/99/reactions/"+url.PathEscape("👍"), `{"user":"Ann"}`); rr.Code != http.StatusNotFound {
+			t.Errorf("Expected status 404 for a missing message, got %v", rr.Code)
+		}
+	})
+
+	t.Run("remove reactions", func(t *testing.T) {
+		if rr := serve(router, "DELETE", thumbsUp+"?user=Ann", ""); rr.Code != http.StatusNoContent {
+			t.Errorf("Expected status 204, got %v: %s", rr.Code, rr.Body)
+		}
+		if rr := serve(router, "DELETE", thumbsUp+"?user=Ann", ""); rr.Code != http.StatusNotFound {
+			t.Errorf("Expected status 404 removing twice, got %v", rr.Code)
+		}
+		if rr := serve(router, "DELETE", thumbsUp, ""); rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 without a user, got %v", rr.Code)
+		}
+
+		rr := serve(router, "GET", "/messages/0", "")
+		if got := decodeData[store.Message](t, rr.Body.Bytes()); len(got.Reactions) != 1 || got.Reactions["👍🏽"] != 1 {
+			t.Errorf("Expected Bob's reaction left, got %v", got.Reactions)
+		}
+	})
+}
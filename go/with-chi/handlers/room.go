@@ -0,0 +1,425 @@
+package handlers
+
+import (
+	"net/http"
+
+	"node-week-02-with-chi/store"
+	"node-week-02-with-chi/utils"
+	"node-week-02-with-chi/validate"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type RoomHandler struct {
+	Store store.RoomStore
+}
+
+func NewRoomHandler(s store.RoomStore) *RoomHandler {
+	return &RoomHandler{
+		Store: s,
+	}
+}
+
+// CreateRoom godoc
+// @Summary Create a room
+// @Description Create a new room; post messages to it under /rooms/{roomId}/messages
+// @Tags rooms
+// @Accept json
+// @Produce json
+// @Param room body store.CreateRoomRequest true "Room"
+// @Success 201 {object} utils.Response[store.Room] "Successful creation of room"
+// @Failure 400 {object} utils.Problem "Invalid request"
+// @Failure 413 {object} utils.Problem "Request body too large"
+// @Failure 415 {object} utils.Problem "Content-Type is not application/json"
+// @Failure 500 {object} utils.Problem "Internal server error"
+// @Router /rooms [post]
+func (h *RoomHandler) CreateRoom(w http.ResponseWriter, r *http.Request) {
+	var req store.CreateRoomRequest
+
+	if err := utils.ParseJSON(w, r, &req); err != nil {
+		utils.WriteBodyError(w, err)
+		return
+	}
+
+	if fieldErrors := validate.Struct(&req, nil); len(fieldErrors) > 0 {
+		utils.WriteProblem(w, http.StatusBadRequest, utils.CodeValidationFailed, "The room is invalid.", fieldErrors...)
+		return
+	}
+
+	room, err := h.Store.CreateRoom(r.Context(), req)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, room)
+}
+
+// ListRooms godoc
+// @Summary List rooms
+// @Description Return every room, the default "general" room first, then oldest first
+// @Tags rooms
+// @Produce json
+// @Param If-None-Match header string false "ETag of a previous response; 304 if the list is unchanged"
+// @Success 200 {object} utils.Response[[]store.Room] "room list"
+// @Header 200 {string} ETag "Tag of this list, for If-None-Match"
+// @Success 304 "Not Modified - the list still matches If-None-Match"
+// @Failure 500 {object} utils.Problem "Internal server error"
+// @Router /rooms [get]
+func (h *RoomHandler) ListRooms(w http.ResponseWriter, r *http.Request) {
+	rooms, err := h.Store.ListRooms(r.Context())
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	respondList(w, r, utils.Response[[]store.Room]{
+		Data: nonNil(rooms),
+		Meta: utils.ListMeta(r, len(rooms)),
+	})
+}
+
+// GetRoom godoc
+// @Summary Get a room by ID
+// @Description Return a room by ID
+// @Tags rooms
+// @Produce json
+// @Param roomId path string true "Room ID"
+// @Success 200 {object} utils.Response[store.Room] "the room"
+// @Failure 404 {object} utils.Problem "No matching room found"
+// @Failure 500 {object} utils.Problem "Internal server error"
+// @Router /rooms/{roomId} [get]
+func (h *RoomHandler) GetRoom(w http.ResponseWriter, r *http.Request) {
+	room, err := h.Store.GetRoom(r.Context(), chi.URLParam(r, "roomId"))
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, room)
+}
+
+// UpdateRoom godoc
+// @Summary Update a room by ID
+// @Description Rename a room or change its topic
+// @Tags rooms
+// @Accept json
+// @Produce json
+// @Param roomId path string true "Room ID"
+// @Param room body store.CreateRoomRequest true "Updated room"
+// @Success 200 {object} utils.Response[store.Room] "the updated room"
+// @Failure 400 {object} utils.Problem "Invalid request"
+// @Failure 404 {object} utils.Problem "No matching room found"
+// @Failure 413 {object} utils.Problem "Request body too large"
+// @Failure 415 {object} utils.Problem "Content-Type is not application/json"
+// @Failure 500 {object} utils.Problem "Internal server error"
+// @Router /rooms/{roomId} [put]
+func (h *RoomHandler) UpdateRoom(w http.ResponseWriter, r *http.Request) {
+	var req store.CreateRoomRequest
+
+	if err := utils.ParseJSON(w, r, &req); err != nil {
+		utils.WriteBodyError(w, err)
+		return
+	}
+
+	if fieldErrors := validate.Struct(&req, nil); len(fieldErrors) > 0 {
+		utils.WriteProblem(w, http.StatusBadRequest, utils.CodeValidationFailed, "The room is invalid.", fieldErrors...)
+		return
+	}
+
+	room, err := h.Store.UpdateRoom(r.Context(), chi.URLParam(r, "roomId"), req)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, room)
+}
+
+// DeleteRoom godoc
+// @Summary Delete a room by ID
+// @Description Delete a room and every message in it. The default "general" room cannot be deleted.
+// @Tags rooms
+// @Param roomId path string true "Room ID"
+// @Success 204 "No Content - Room successfully deleted"
+// @Failure 404 {object} utils.Problem "No matching room found"
+// @Failure 409 {object} utils.Problem "The default room cannot be deleted"
+// @Failure 500 {object} utils.Problem "Internal server error"
+// @Router /rooms/{roomId} [delete]
+func (h *RoomHandler) DeleteRoom(w http.ResponseWriter, r *http.Request) {
+	if err := h.Store.DeleteRoom(r.Context(), chi.URLParam(r, "roomId")); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// The handlers below serve /rooms/{roomId}/messages with the same code as
+// the top-level /messages routes, which act on the default room. They only
+// exist to document the nested routes.
+
+// ListRoomMessages godoc
+// @Summary Get a room's messages
+// @Description Return a page of a room's messages, oldest first unless sort says otherwise; see
+// @Description GET /messages for the cursors and filters
+// @Tags rooms
+// @Produce json
+// @Param roomId path string true "Room ID"
+// @Param limit query int false "Page size" minimum(1) maximum(200) default(50)
+// @Param after query string false "Cursor: return messages after this position"
+// @Param before query string false "Cursor: return messages before this position"
+// @Param from query string false "Only messages from this sender"
+// @Param since query string false "Only messages sent at or after this date or RFC 3339 time"
+// @Param until query string false "Only messages sent before this date or RFC 3339 time"
+// @Param sort query string false "Order of the messages" Enums(id, time_sent, -time_sent) default(id)
+// @Param fields query string false "Comma-separated message fields to return, e.g. id,from,text"
+// @Param If-None-Match header string false "ETag of a previous response; 304 if the list is unchanged"
+// @Success 200 {object} utils.Response[[]store.Message] "message list"
+// @Header 200 {string} ETag "Tag of this list, for If-None-Match"
+// @Success 304 "Not Modified - the list still matches If-None-Match"
+// @Failure 400 {object} utils.Problem "Invalid query parameters"
+// @Failure 404 {object} utils.Problem "No matching room found"
+// @Failure 500 {object} utils.Problem "Internal server error"
+// @Router /rooms/{roomId}/messages [get]
+func (h *MessageHandler) ListRoomMessages(w http.ResponseWriter, r *http.Request) {
+	h.GetAllMessages(w, r)
+}
+
+// CreateRoomMessage godoc
+// @Summary Post a message to a room
+// @Description Create a new message in a room
+// @Tags rooms
+// @Accept json
+// @Produce json
+// @Param roomId path string true "Room ID"
+// @Param message body store.CreateMessageRequest true "Message content"
+// @Success 201 {object} utils.Response[store.Message] "Successful creation of message"
+// @Header 201 {string} ETag "Tag of the message's version, reactions and replies, for If-Match"
+// @Failure 400 {object} utils.Problem "Invalid request"
+// @Failure 404 {object} utils.Problem "No matching room found"
+// @Failure 413 {object} utils.Problem "Request body too large"
+// @Failure 415 {object} utils.Problem "Content-Type is not application/json"
+// @Failure 500 {object} utils.Problem "Internal server error"
+// @Router /rooms/{roomId}/messages [post]
+func (h *MessageHandler) CreateRoomMessage(w http.ResponseWriter, r *http.Request) {
+	h.CreateMessage(w, r)
+}
+
+// GetLatestRoomMessages godoc
+// @Summary Get a room's latest messages
+// @Description Return the latest messages in a room; see GET /messages/latest
+// @Tags rooms
+// @Produce json
+// @Param roomId path string true "Room ID"
+// @Param limit query int false "How many messages to return" minimum(1) maximum(200) default(10)
+// @Param order query string false "asc for oldest first, desc for newest first" Enums(asc, desc) default(asc)
+// @Param If-None-Match header string false "ETag of a previous response; 304 if the list is unchanged"
+// @Success 200 {object} utils.Response[[]store.Message] "the latest messages"
+// @Header 200 {string} ETag "Tag of this list, for If-None-Match"
+// @Success 304 "Not Modified - the list still matches If-None-Match"
+// @Failure 400 {object} utils.Problem "Invalid limit or order"
+// @Failure 404 {object} utils.Problem "No matching room found"
+// @Failure 500 {object} utils.Problem "Internal server error"
+// @Router /rooms/{roomId}/messages/latest [get]
+func (h *MessageHandler) GetLatestRoomMessages(w http.ResponseWriter, r *http.Request) {
+	h.GetLatestMessages(w, r)
+}
+
+// SearchRoomMessages godoc
+// @Summary Search a room's messages
+// @Description Return a page of the messages in a room matching the search, most relevant first; see
+// @Description GET /messages/search
+// @Tags rooms
+// @Produce json
+// @Param roomId path string true "Room ID"
+// @Param text query string true "What to search for, e.g. green tea OR coffee -milk from:ann"
+// @Param limit query int false "Page size" minimum(1) maximum(200) default(50)
+// @Param after query string false "Cursor: return the results after this position"
+// @Param before query string false "Cursor: return the results before this position"
+// @Param If-None-Match header string false "ETag of a previous response; 304 if the results are unchanged"
+// @Success 200 {object} utils.Response[[]store.SearchResult] "the matching messages"
+// @Header 200 {string} ETag "Tag of these results, for If-None-Match"
+// @Success 304 "Not Modified - the results still match If-None-Match"
+// @Failure 400 {object} utils.Problem "Missing or malformed text, or invalid pagination parameters"
+// @Failure 404 {object} utils.Problem "No matching room found"
+// @Failure 500 {object} utils.Problem "Internal server error"
+// @Router /rooms/{roomId}/messages/search [get]
+func (h *MessageHandler) SearchRoomMessages(w http.ResponseWriter, r *http.Request) {
+	h.GetSearchedMessages(w, r)
+}
+
+// PollRoomMessages godoc
+// @Summary Long-poll for new messages in a room
+// @Description Wait until a room has messages newer than since; see GET /messages/poll
+// @Tags rooms
+// @Produce json
+// @Param roomId path string true "Room ID"
+// @Param since query string false "ID of the newest message the client already has"
+// @Param timeout query string false "How long to wait, as a duration like 30s or a number of seconds" default(30s)
+// @Success 200 {object} utils.Response[[]store.Message] "new messages, possibly none"
+// @Failure 400 {object} utils.Problem "Invalid poll parameters"
+// @Failure 404 {object} utils.Problem "No matching room found"
+// @Failure 500 {object} utils.Problem "Internal server error"
+// @Router /rooms/{roomId}/messages/poll [get]
+func (h *MessageHandler) PollRoomMessages(w http.ResponseWriter, r *http.Request) {
+	h.PollMessages(w, r)
+}
+
+// GetRoomMessage godoc
+// @Summary Get a message in a room by ID
+// @Description Return a message by ID if it was posted in the room
+// @Tags rooms
+// @Produce json
+// @Param roomId path string true "Room ID"
+// @Param messageId path string true "Message ID"
+// @Success 200 {object} utils.Response[store.Message] "the message if matched"
+// @Header 200 {string} ETag "Tag of the message's version, reactions and replies, for If-Match"
+// @Failure 404 {object} utils.Problem "No matching message found"
+// @Failure 500 {object} utils.Problem "Internal server error"
+// @Router /rooms/{roomId}/messages/{messageId} [get]
+func (h *MessageHandler) GetRoomMessage(w http.ResponseWriter, r *http.Request) {
+	h.GetMessage(w, r)
+}
+
+// UpdateRoomMessage godoc
+// @Summary Update a message in a room by ID
+// @Description Return an updated message by ID; messages cannot move between rooms
+// @Tags rooms
+// @Accept json
+// @Produce json
+// @Param roomId path string true "Room ID"
+// @Param messageId path string true "Message ID"
+// @Param message body store.CreateMessageRequest true "Updated message content"
+// @Param If-Match header string false "ETag the message must still have"
+// @Success 200 {object} utils.Response[store.Message] "the updated message"
+// @Header 200 {string} ETag "Tag of the updated message"
+// @Failure 400 {object} utils.Problem "Invalid request"
+// @Failure 404 {object} utils.Problem "No matching message found"
+// @Failure 412 {object} utils.Problem "The message no longer matches If-Match"
+// @Failure 413 {object} utils.Problem "Request body too large"
+// @Failure 415 {object} utils.Problem "Content-Type is not application/json"
+// @Failure 500 {object} utils.Problem "Internal server error"
+// @Router /rooms/{roomId}/messages/{messageId} [put]
+func (h *MessageHandler) UpdateRoomMessage(w http.ResponseWriter, r *http.Request) {
+	h.UpdateMessage(w, r)
+}
+
+// GetRoomMessageReplies godoc
+// @Summary Get the replies to a message in a room
+// @Description Return a page of the direct replies to a message in a room, oldest first
+// @Tags rooms
+// @Produce json
+// @Param roomId path string true "Room ID"
+// @Param messageId path string true "Message ID"
+// @Param limit query int false "Page size" minimum(1) maximum(200) default(50)
+// @Param after query string false "Cursor: return replies after this position"
+// @Param before query string false "Cursor: return replies before this position"
+// @Param If-None-Match header string false "ETag of a previous response; 304 if the list is unchanged"
+// @Success 200 {object} utils.Response[[]store.Message] "reply list"
+// @Header 200 {string} ETag "Tag of this list, for If-None-Match"
+// @Success 304 "Not Modified - the list still matches If-None-Match"
+// @Failure 400 {object} utils.Problem "Invalid pagination parameters"
+// @Failure 404 {object} utils.Problem "No matching message found"
+// @Failure 500 {object} utils.Problem "Internal server error"
+// @Router /rooms/{roomId}/messages/{messageId}/replies [get]
+func (h *MessageHandler) GetRoomMessageReplies(w http.ResponseWriter, r *http.Request) {
+	h.GetReplies(w, r)
+}
+
+// GetRoomMessageRevisions godoc
+// @Summary Get the edit history of a message in a room
+// @Description Return every edit of a message in a room, oldest first
+// @Tags rooms
+// @Produce json
+// @Param roomId path string true "Room ID"
+// @Param messageId path string true "Message ID"
+// @Param If-None-Match header string false "ETag of a previous response; 304 if the list is unchanged"
+// @Success 200 {object} utils.Response[[]store.Revision] "revision list"
+// @Header 200 {string} ETag "Tag of this list, for If-None-Match"
+// @Success 304 "Not Modified - the list still matches If-None-Match"
+// @Failure 404 {object} utils.Problem "No matching message found"
+// @Failure 500 {object} utils.Problem "Internal server error"
+// @Router /rooms/{roomId}/messages/{messageId}/revisions [get]
+func (h *MessageHandler) GetRoomMessageRevisions(w http.ResponseWriter, r *http.Request) {
+	h.GetRevisions(w, r)
+}
+
+// AddRoomMessageReaction godoc
+// @Summary React to a message in a room
+// @Description Add a user's emoji reaction to a message in a room; see POST /messages/{messageId}/reactions/{emoji}
+// @Tags rooms
+// @Accept json
+// @Produce json
+// @Param roomId path string true "Room ID"
+// @Param messageId path string true "Message ID"
+// @Param emoji path string true "Emoji"
+// @Param reaction body store.ReactionRequest true "Reacting user"
+// @Success 201 {object} utils.Response[store.Message] "the message with its new reaction counts"
+// @Success 200 {object} utils.Response[store.Message] "the user had already reacted with this emoji"
+// @Failure 400 {object} utils.Problem "Invalid emoji or user"
+// @Failure 404 {object} utils.Problem "No matching message found"
+// @Failure 413 {object} utils.Problem "Request body too large"
+// @Failure 415 {object} utils.Problem "Content-Type is not application/json"
+// @Failure 500 {object} utils.Problem "Internal server error"
+// @Router /rooms/{roomId}/messages/{messageId}/reactions/{emoji} [post]
+func (h *MessageHandler) AddRoomMessageReaction(w http.ResponseWriter, r *http.Request) {
+	h.AddReaction(w, r)
+}
+
+// RemoveRoomMessageReaction godoc
+// @Summary Remove a reaction from a message in a room
+// @Description Remove a user's emoji reaction from a message in a room
+// @Tags rooms
+// @Param roomId path string true "Room ID"
+// @Param messageId path string true "Message ID"
+// @Param emoji path string true "Emoji"
+// @Param user query string true "Reacting user"
+// @Success 204 "No Content - Reaction successfully removed"
+// @Failure 400 {object} utils.Problem "Invalid emoji or user"
+// @Failure 404 {object} utils.Problem "No matching message or reaction found"
+// @Failure 500 {object} utils.Problem "Internal server error"
+// @Router /rooms/{roomId}/messages/{messageId}/reactions/{emoji} [delete]
+func (h *MessageHandler) RemoveRoomMessageReaction(w http.ResponseWriter, r *http.Request) {
+	h.RemoveReaction(w, r)
+}
+
+// PatchRoomMessage godoc
+// @Summary Partially update a message in a room by ID
+// @Description Change only some of a message's fields; see PATCH /messages/{messageId}
+// @Tags rooms
+// @Accept application/merge-patch+json
+// @Accept application/json-patch+json
+// @Produce json
+// @Param roomId path string true "Room ID"
+// @Param messageId path string true "Message ID"
+// @Param patch body handlers.messagePatch true "Merge patch or JSON Patch array"
+// @Param If-Match header string false "ETag the message must still have"
+// @Success 200 {object} utils.Response[store.Message] "the updated message"
+// @Header 200 {string} ETag "Tag of the updated message"
+// @Failure 400 {object} utils.Problem "Malformed patch, or the patched message is invalid"
+// @Failure 404 {object} utils.Problem "No matching message found"
+// @Failure 409 {object} utils.Problem "A JSON Patch operation could not be applied"
+// @Failure 412 {object} utils.Problem "The message no longer matches If-Match"
+// @Failure 415 {object} utils.Problem "Content-Type is not a supported patch format"
+// @Failure 500 {object} utils.Problem "Internal server error"
+// @Router /rooms/{roomId}/messages/{messageId} [patch]
+func (h *MessageHandler) PatchRoomMessage(w http.ResponseWriter, r *http.Request) {
+	h.PatchMessage(w, r)
+}
+
+// DeleteRoomMessage godoc
+// @Summary Delete a message in a room by ID
+// @Description Deletes a message with the specified ID from the room and returns no content on success
+// @Tags rooms
+// @Param roomId path string true "Room ID"
+// @Param messageId path string true "Message ID"
+// @Param If-Match header string false "ETag the message must still have"
+// @Success 204 "No Content - Message successfully deleted"
+// @Failure 404 {object} utils.Problem "No matching message found"
+// @Failure 412 {object} utils.Problem "The message no longer matches If-Match"
+// @Failure 500 {object} utils.Problem "Internal server error"
+// @Router /rooms/{roomId}/messages/{messageId} [delete]
+func (h *MessageHandler) DeleteRoomMessage(w http.ResponseWriter, r *http.Request) {
+	h.DeleteMessage(w, r)
+}
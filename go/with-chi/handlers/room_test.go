@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"node-week-02-with-chi/store"
+	"node-week-02-with-chi/utils"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func setupRoomRouter() http.Handler {
+	messageHandler := setupTestHandler()
+	roomHandler := NewRoomHandler(messageHandler.Store)
+
+	r := chi.NewRouter()
+	r.Get("/messages", messageHandler.GetAllMessages)
+	r.Get("/messages/{messageId}", messageHandler.GetMessage)
+	r.Get("/rooms", roomHandler.ListRooms)
+	r.Post("/rooms", roomHandler.CreateRoom)
+	r.Route("/rooms/{roomId}", func(r chi.Router) {
+		r.Get("/", roomHandler.GetRoom)
+		r.Put("/", roomHandler.UpdateRoom)
+		r.Delete("/", roomHandler.DeleteRoom)
+		r.Get("/messages", messageHandler.ListRoomMessages)
+		r.Post("/messages", messageHandler.CreateRoomMessage)
+		r.Get("/messages/latest", messageHandler.GetLatestRoomMessages)
+		r.Get("/messages/search", messageHandler.SearchRoomMessages)
+		r.Get("/messages/{messageId}", messageHandler.GetRoomMessage)
+		r.Put("/messages/{messageId}", messageHandler.UpdateRoomMessage)
+		r.Delete("/messages/{messageId}", messageHandler.DeleteRoomMessage)
+	})
+	return r
+}
+
+func decodeData[T any](t *testing.T, body []byte) T {
+	t.Helper()
+	var response utils.Response[T]
+	if err := json.Unmarshal(body, &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	return response.Data
+}
+
+// Testing rooms and the messages nested under them
+func TestRooms(t *testing.T) {
+	router := setupRoomRouter()
+
+	rr := serve(router, "POST", "/rooms", `{"name":" Random ","topic":"Anything goes"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %v: %s", rr.Code, rr.Body)
+	}
+	room := decodeData[store.Room](t, rr.Body.Bytes())
+	if room.Name != "Random" {
+		t.Errorf("Expected a trimmed name, got %q", room.Name)
+	}
+	roomURL := "/rooms/" + room.ID
+
+	rr = serve(router, "POST", roomURL+"/messages", `{"from":"Tom","text":"Hello random"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %v: %s", rr.Code, rr.Body)
+	}
+	message := decodeData[store.Message](t, rr.Body.Bytes())
+	if message.RoomID != room.ID {
+		t.Errorf("Expected the message in %s, got %s", room.ID, message.RoomID)
+	}
+
+	t.Run("Room messages are kept apart from the default room", func(t *testing.T) {
+		for url, want := range map[string]int{
+			roomURL + "/messages":                   1,
+			roomURL + "/messages/latest":            1,
+			roomURL + "/messages/search?text=hello": 1,
+			"/messages":                             2,
+			"/rooms/general/messages":               2,
+		} {
+			rr := serve(router, "GET", url, "")
+			if got := decodeData[[]store.Message](t, rr.Body.Bytes()); rr.Code != http.StatusOK || len(got) != want {
+				t.Errorf("%s: expected %d messages, got %v %+v", url, want, rr.Code, got)
+			}
+		}
+	})
+
+	t.Run("Messages are only reachable through their own room", func(t *testing.T) {
+		for _, req := range [][3]string{
+			{"GET", "/messages/" + message.ID, ""},
+			{"GET", "/rooms/general/messages/" + message.ID, ""},
+			{"GET", roomURL + "/messages/0", ""},
+			{"PUT", roomURL + "/messages/0", `{"from":"Tom","text":"Moved?"}`},
+			{"DELETE", roomURL + "/messages/0", ""},
+		} {
+			if rr := serve(router, req[0], req[1], req[2]); rr.Code != http.StatusNotFound {
+				t.Errorf("%s %s: expected status 404, got %v", req[0], req[1], rr.Code)
+			}
+		}
+		if rr := serve(router, "GET", roomURL+"/messages/"+message.ID, ""); rr.Code != http.StatusOK {
+			t.Errorf("Expected status 200, got %v", rr.Code)
+		}
+	})
+
+	t.Run("Update and list rooms", func(t *testing.T) {
+		rr := serve(router, "PUT", roomURL, `{"name":"Renamed"}`)
+		if got := decodeData[store.Room](t, rr.Body.Bytes()); rr.Code != http.StatusOK || got.Name != "Renamed" {
+			t.Errorf("Expected the renamed room, got %v %+v", rr.Code, got)
+		}
+		if rr := serve(router, "PUT", roomURL, `{"name":""}`); rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for an empty name, got %v", rr.Code)
+		}
+
+		rr = serve(router, "GET", "/rooms", "")
+		rooms := decodeData[[]store.Room](t, rr.Body.Bytes())
+		if len(rooms) != 2 || rooms[0].ID != store.DefaultRoomID || rooms[1].ID != room.ID {
+			t.Errorf("Expected general then %s, got %+v", room.ID, rooms)
+		}
+	})
+
+	t.Run("Delete rooms", func(t *testing.T) {
+		if rr := serve(router, "DELETE", "/rooms/general", ""); rr.Code != http.StatusConflict {
+			t.Errorf("Expected status 409 for the default room, got %v", rr.Code)
+		}
+		if rr := serve(router, "DELETE", roomURL, ""); rr.Code != http.StatusNoContent {
+			t.Errorf("Expected status 204, got %v", rr.Code)
+		}
+		for _, req := range [][3]string{
+			{"GET", roomURL, ""},
+			{"DELETE", roomURL, ""},
+			{"GET", roomURL + "/messages", ""},
+			{"GET", roomURL + "/messages/latest", ""},
+			{"POST", roomURL + "/messages", `{"from":"Tom","text":"Anyone?"}`},
+		} {
+			rr := serve(router, req[0], req[1], req[2])
+			var problem utils.Problem
+			json.Unmarshal(rr.Body.Bytes(), &problem)
+			if rr.Code != http.StatusNotFound || problem.Detail != "Room not found" {
+				t.Errorf("%s %s: expected room not found, got %v %+v", req[0], req[1], rr.Code, problem)
+			}
+		}
+	})
+}
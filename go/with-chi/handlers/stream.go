@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"node-week-02-with-chi/store"
+	"node-week-02-with-chi/utils"
+)
+
+const (
+	// streamBuffer is how many events a slow client may lag behind before
+	// it is disconnected and has to resume with Last-Event-ID.
+	streamBuffer = 64
+
+	defaultHeartbeatInterval = 15 * time.Second
+)
+
+// StreamMessages godoc
+// @Summary Stream message events
+// @Description Push message.created, message.updated, message.deleted and message.restored events as Server-Sent Events.
+// @Description Each event's id is the stream's epoch and a sequence number, such as "3f9a0c2b71de-42"; reconnect
+// @Description with the Last-Event-ID header to receive the events missed in between. Only the most recent
+// @Description events are retained, in memory, so resuming is best effort: after a longer gap, or with an id
+// @Description from before a server restart, a "resync" event is sent and the client should reload the list.
+// @Description Comment lines are sent as heartbeats.
+// @Description Events from every room are streamed; filter on message.room_id.
+// @Tags messages
+// @Produce text/event-stream
+// @Param Last-Event-ID header string false "ID of the last event received"
+// @Success 200 {object} store.Event "Stream of events"
+// @Failure 400 {object} utils.Problem "Invalid Last-Event-ID"
+// @Failure 500 {object} utils.Problem "Internal server error"
+// @Router /messages/stream [get]
+func (h *MessageHandler) StreamMessages(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok || h.Events == nil {
+		utils.WriteProblem(w, http.StatusInternalServerError, utils.CodeInternal, "Streaming is not supported.")
+		return
+	}
+
+	var (
+		resumeFrom uint64
+		current    bool
+	)
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID != "" {
+		var err error
+		resumeFrom, current, err = h.Events.ParseEventID(lastEventID)
+		if err != nil {
+			utils.WriteProblem(w, http.StatusBadRequest, utils.CodeInvalidQuery, "Last-Event-ID must be the id of an event.",
+				utils.FieldError{Field: "Last-Event-ID", Code: utils.FieldInvalid, Message: "Last-Event-ID must be an event id"})
+			return
+		}
+	}
+
+	// Subscribe before reading history so nothing published in between is lost.
+	sub := h.Events.Subscribe(streamBuffer)
+	defer sub.Unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	var sent uint64
+	if lastEventID != "" {
+		var missed []store.Event
+		ok := false
+		if current {
+			missed, ok = h.Events.Since(resumeFrom)
+		}
+		if !ok {
+			fmt.Fprintf(w, "event: resync\ndata: {}\n\n")
+		}
+		for _, event := range missed {
+			h.writeEvent(w, event)
+			sent = event.Seq
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(h.heartbeatInterval())
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, open := <-sub.C:
+			if !open {
+				return
+			}
+			if event.Seq <= sent {
+				continue
+			}
+			h.writeEvent(w, event)
+			flusher.Flush()
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+func (h *MessageHandler) writeEvent(w http.ResponseWriter, event store.Event) {
+	data, _ := json.Marshal(event)
+	fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", h.Events.EventID(event.Seq), event.Type, data)
+}
+
+func (h *MessageHandler) heartbeatInterval() time.Duration {
+	if h.HeartbeatInterval > 0 {
+		return h.HeartbeatInterval
+	}
+	return defaultHeartbeatInterval
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"node-week-02-with-chi/store"
+)
+
+func setupStreamHandler() (*MessageHandler, *store.Broker) {
+	events := store.NewBroker(16)
+	handler := New(store.NewNotifyingStore(store.NewMemoryStore(), events))
+	handler.Events = events
+	return handler, events
+}
+
+// readEvent reads one SSE event block and returns its fields.
+func readEvent(t *testing.T, reader *bufio.Reader) map[string]string {
+	t.Helper()
+	fields := map[string]string{}
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Reading stream: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			if len(fields) > 0 {
+				return fields
+			}
+			continue
+		}
+		name, value, _ := strings.Cut(line, ": ")
+		fields[name] = value
+	}
+}
+
+func openStream(t *testing.T, url, lastEventID string) (*http.Response, *bufio.Reader) {
+	t.Helper()
+	req, _ := http.NewRequest("GET", url, nil)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Opening stream: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp, bufio.NewReader(resp.Body)
+}
+
+// Testing StreamMessages
+func TestStreamMessages(t *testing.T) {
+	handler, events := setupStreamHandler()
+	ts := httptest.NewServer(http.HandlerFunc(handler.StreamMessages))
+	defer ts.Close()
+	ctx := context.Background()
+
+	t.Run("Receive events as they happen", func(t *testing.T) {
+		resp, reader := openStream(t, ts.URL, "")
+		if contentType := resp.Header.Get("Content-Type"); contentType != "text/event-stream" {
+			t.Errorf("Expected text/event-stream, got %q", contentType)
+		}
+
+		m, _ := handler.Store.Create(ctx, store.CreateMessageRequest{From: "Bart", Text: "Hi"})
+		handler.Store.Delete(ctx, m.ID, 0)
+
+		for _, want := range []store.EventType{store.MessageCreated, store.MessageDeleted} {
+			event := readEvent(t, reader)
+			if event["event"] != string(want) || !strings.Contains(event["data"], `"id":"`+m.ID+`"`) {
+				t.Errorf("Expected %s for message %s, got %v", want, m.ID, event)
+			}
+		}
+	})
+
+	t.Run("Resume with Last-Event-ID", func(t *testing.T) {
+		_, reader := openStream(t, ts.URL, events.EventID(1))
+
+		event := readEvent(t, reader)
+		if event["id"] != events.EventID(2) || event["event"] != string(store.MessageDeleted) {
+			t.Errorf("Expected to resume at event 2, got %v", event)
+		}
+	})
+
+	t.Run("Resync when events were discarded", func(t *testing.T) {
+		_, reader := openStream(t, ts.URL, events.EventID(999))
+
+		if event := readEvent(t, reader); event["event"] != "resync" {
+			t.Errorf("Expected a resync event, got %v", event)
+		}
+	})
+
+	t.Run("Resync after a restart", func(t *testing.T) {
+		_, reader := openStream(t, ts.URL, store.NewBroker(16).EventID(1))
+
+		if event := readEvent(t, reader); event["event"] != "resync" {
+			t.Errorf("Expected a resync event for an id from another epoch, got %v", event)
+		}
+	})
+
+	t.Run("Invalid Last-Event-ID", func(t *testing.T) {
+		resp, _ := openStream(t, ts.URL, "2")
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected status code %v, got %v", http.StatusBadRequest, resp.StatusCode)
+		}
+	})
+
+	t.Run("Heartbeats", func(t *testing.T) {
+		handler, _ := setupStreamHandler()
+		handler.HeartbeatInterval = 10 * time.Millisecond
+		ts := httptest.NewServer(http.HandlerFunc(handler.StreamMessages))
+		t.Cleanup(ts.Close)
+
+		_, reader := openStream(t, ts.URL, "")
+		line, err := reader.ReadString('\n')
+		if err != nil || line != ": heartbeat\n" {
+			t.Errorf("Expected a heartbeat comment, got %q (%v)", line, err)
+		}
+	})
+
+	t.Run("Closing the broker ends the stream", func(t *testing.T) {
+		_, reader := openStream(t, ts.URL, "")
+		events.Close()
+
+		done := make(chan error)
+		go func() {
+			_, err := reader.ReadString('\n')
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			if err == nil {
+				t.Errorf("Expected the stream to end")
+			}
+		case <-time.After(2 * time.Second):
+			t.Errorf("Stream stayed open after the broker closed")
+		}
+	})
+}
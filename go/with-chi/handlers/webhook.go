@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"node-week-02-with-chi/utils"
+	"node-week-02-with-chi/validate"
+	"node-week-02-with-chi/webhook"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type WebhookHandler struct {
+	Webhooks *webhook.Dispatcher
+}
+
+func NewWebhookHandler(d *webhook.Dispatcher) *WebhookHandler {
+	return &WebhookHandler{
+		Webhooks: d,
+	}
+}
+
+// CreateWebhook godoc
+// @Summary Subscribe to message events
+// @Description Register a URL to receive a signed JSON POST of every message.created, message.updated,
+// @Description message.deleted and message.restored event, or only the listed ones. Each delivery carries Webhook-Id,
+// @Description Webhook-Event, Webhook-Timestamp and Webhook-Signature headers; the signature is
+// @Description "sha256=" followed by the hex HMAC-SHA256 of "<timestamp>.<body>" keyed with the secret.
+// @Description The secret is only returned here. The URL may not point to localhost or a private or
+// @Description link-local address unless the server allowlists it with -webhook-allow; every delivery
+// @Description checks the address it connects to as well, and redirects are not followed. Like every
+// @Description webhook endpoint, this requires the server's admin token.
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Security AdminToken
+// @Param webhook body webhook.CreateSubscriptionRequest true "Subscription"
+// @Success 201 {object} utils.Response[webhook.Subscription] "the new subscription, with its secret"
+// @Failure 400 {object} utils.Problem "Invalid request"
+// @Failure 401 {object} utils.Problem "Missing or wrong admin token"
+// @Failure 403 {object} utils.Problem "The server has no admin token configured"
+// @Failure 413 {object} utils.Problem "Request body too large"
+// @Failure 415 {object} utils.Problem "Content-Type is not application/json"
+// @Failure 500 {object} utils.Problem "Internal server error"
+// @Router /webhooks [post]
+func (h *WebhookHandler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var req webhook.CreateSubscriptionRequest
+
+	if err := utils.ParseJSON(w, r, &req); err != nil {
+		utils.WriteBodyError(w, err)
+		return
+	}
+
+	fieldErrors := validate.Struct(&req, nil)
+	for i, event := range req.Events {
+		if !webhook.ValidEvent(event) {
+			fieldErrors = append(fieldErrors, utils.FieldError{
+				Field:   fmt.Sprintf("events[%d]", i),
+				Code:    utils.FieldInvalid,
+				Message: fmt.Sprintf("%q is not a message event", event),
+			})
+		}
+	}
+	if len(fieldErrors) == 0 {
+		if err := h.Webhooks.CheckTarget(r.Context(), req.URL); err != nil {
+			fieldErrors = append(fieldErrors, utils.FieldError{
+				Field:   "url",
+				Code:    utils.FieldInvalid,
+				Message: "url must not point to localhost or a private or link-local address that is not allowlisted",
+			})
+		}
+	}
+	if len(fieldErrors) > 0 {
+		utils.WriteProblem(w, http.StatusBadRequest, utils.CodeValidationFailed, "The webhook is invalid.", fieldErrors...)
+		return
+	}
+
+	sub, err := h.Webhooks.Subscribe(req)
+	if err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, sub)
+}
+
+// ListWebhooks godoc
+// @Summary List webhook subscriptions
+// @Description Return every webhook subscription, oldest first
+// @Tags webhooks
+// @Produce json
+// @Security AdminToken
+// @Success 200 {object} utils.Response[[]webhook.Subscription] "subscription list"
+// @Failure 401 {object} utils.Problem "Missing or wrong admin token"
+// @Failure 403 {object} utils.Problem "The server has no admin token configured"
+// @Router /webhooks [get]
+func (h *WebhookHandler) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	subs := h.Webhooks.Subscriptions()
+
+	respond(w, http.StatusOK, utils.Response[[]webhook.Subscription]{
+		Data: subs,
+		Meta: utils.ListMeta(r, len(subs)),
+	})
+}
+
+// GetWebhook godoc
+// @Summary Get a webhook subscription by ID
+// @Description Return a webhook subscription by ID, without its secret
+// @Tags webhooks
+// @Produce json
+// @Security AdminToken
+// @Param webhookId path string true "Subscription ID"
+// @Success 200 {object} utils.Response[webhook.Subscription] "the subscription"
+// @Failure 401 {object} utils.Problem "Missing or wrong admin token"
+// @Failure 403 {object} utils.Problem "The server has no admin token configured"
+// @Failure 404 {object} utils.Problem "No matching subscription found"
+// @Router /webhooks/{webhookId} [get]
+func (h *WebhookHandler) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	sub, err := h.Webhooks.Subscription(chi.URLParam(r, "webhookId"))
+	if err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, sub)
+}
+
+// DeleteWebhook godoc
+// @Summary Delete a webhook subscription by ID
+// @Description Stop deliveries to a subscription and cancel its pending retries
+// @Tags webhooks
+// @Security AdminToken
+// @Param webhookId path string true "Subscription ID"
+// @Success 204 "No Content - Subscription successfully deleted"
+// @Failure 401 {object} utils.Problem "Missing or wrong admin token"
+// @Failure 403 {object} utils.Problem "The server has no admin token configured"
+// @Failure 404 {object} utils.Problem "No matching subscription found"
+// @Router /webhooks/{webhookId} [delete]
+func (h *WebhookHandler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	if err := h.Webhooks.Unsubscribe(chi.URLParam(r, "webhookId")); err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListWebhookDeliveries godoc
+// @Summary List a subscription's deliveries
+// @Description Return the delivery log of a subscription, oldest first, with every attempt's status
+// @Description code, error and duration. Only the most recent deliveries are kept.
+// @Tags webhooks
+// @Produce json
+// @Security AdminToken
+// @Param webhookId path string true "Subscription ID"
+// @Success 200 {object} utils.Response[[]webhook.Delivery] "delivery log"
+// @Failure 401 {object} utils.Problem "Missing or wrong admin token"
+// @Failure 403 {object} utils.Problem "The server has no admin token configured"
+// @Failure 404 {object} utils.Problem "No matching subscription found"
+// @Router /webhooks/{webhookId}/deliveries [get]
+func (h *WebhookHandler) ListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	deliveries, err := h.Webhooks.Deliveries(chi.URLParam(r, "webhookId"))
+	if err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+
+	respond(w, http.StatusOK, utils.Response[[]webhook.Delivery]{
+		Data: deliveries,
+		Meta: utils.ListMeta(r, len(deliveries)),
+	})
+}
+
+// ListDeadLetters godoc
+// @Summary List dead-lettered deliveries
+// @Description Return the deliveries that failed every attempt, oldest first
+// @Tags webhooks
+// @Produce json
+// @Security AdminToken
+// @Success 200 {object} utils.Response[[]webhook.Delivery] "dead letters"
+// @Failure 401 {object} utils.Problem "Missing or wrong admin token"
+// @Failure 403 {object} utils.Problem "The server has no admin token configured"
+// @Router /webhooks/dead-letters [get]
+func (h *WebhookHandler) ListDeadLetters(w http.ResponseWriter, r *http.Request) {
+	deliveries := h.Webhooks.DeadLetters()
+
+	respond(w, http.StatusOK, utils.Response[[]webhook.Delivery]{
+		Data: deliveries,
+		Meta: utils.ListMeta(r, len(deliveries)),
+	})
+}
+
+// RetryDeadLetter godoc
+// @Summary Retry a dead-lettered delivery
+// @Description Take a delivery off the dead-letter list and send it again with a fresh set of attempts
+// @Tags webhooks
+// @Produce json
+// @Security AdminToken
+// @Param deliveryId path string true "Delivery ID"
+// @Success 202 {object} utils.Response[webhook.Delivery] "the delivery, pending again"
+// @Failure 401 {object} utils.Problem "Missing or wrong admin token"
+// @Failure 403 {object} utils.Problem "The server has no admin token configured"
+// @Failure 404 {object} utils.Problem "No matching dead letter, or its subscription was deleted"
+// @Router /webhooks/dead-letters/{deliveryId}/retry [post]
+func (h *WebhookHandler) RetryDeadLetter(w http.ResponseWriter, r *http.Request) {
+	delivery, err := h.Webhooks.Redeliver(chi.URLParam(r, "deliveryId"))
+	if err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusAccepted, delivery)
+}
+
+func writeWebhookError(w http.ResponseWriter, err error) {
+	if errors.Is(err, webhook.ErrNotFound) {
+		utils.WriteProblem(w, http.StatusNotFound, utils.CodeNotFound, "Webhook subscription or delivery not found")
+		return
+	}
+	log.Printf("webhook error: %v", err)
+	utils.WriteProblem(w, http.StatusInternalServerError, utils.CodeInternal, "The webhook could not be saved.")
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"node-week-02-with-chi/utils"
+	"node-week-02-with-chi/webhook"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// stubResolver answers lookups from a map instead of DNS.
+type stubResolver map[string][]netip.Addr
+
+func (r stubResolver) LookupNetIP(_ context.Context, _, host string) ([]netip.Addr, error) {
+	if addrs, ok := r[host]; ok {
+		return addrs, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+func setupWebhookRouter(t *testing.T) http.Handler {
+	d := webhook.NewDispatcher(webhook.Options{Resolver: stubResolver{
+		"example.com":    {netip.MustParseAddr("203.0.113.10")},
+		"intranet.test":  {netip.MustParseAddr("10.1.2.3")},
+		"rebinding.test": {netip.MustParseAddr("203.0.113.11"), netip.MustParseAddr("127.0.0.1")},
+		"hooks.test":     {netip.MustParseAddr("10.20.0.5")},
+	}})
+	d.Allow(webhook.Allowlist{Networks: []netip.Prefix{netip.MustParsePrefix("10.20.0.0/16")}})
+	t.Cleanup(d.Close)
+	handler := NewWebhookHandler(d)
+
+	r := chi.NewRouter()
+	r.Get("/webhooks", handler.ListWebhooks)
+	r.Post("/webhooks", handler.CreateWebhook)
+	r.Get("/webhooks/dead-letters", handler.ListDeadLetters)
+	r.Post("/webhooks/dead-letters/{deliveryId}/retry", handler.RetryDeadLetter)
+	r.Get("/webhooks/{webhookId}", handler.GetWebhook)
+	r.Delete("/webhooks/{webhookId}", handler.DeleteWebhook)
+	r.Get("/webhooks/{webhookId}/deliveries", handler.ListWebhookDeliveries)
+	return r
+}
+
+func serve(router http.Handler, method, url, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, url, bytes.NewBufferString(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+// Testing the webhook subscription endpoints
+func TestWebhookHandler(t *testing.T) {
+	router := setupWebhookRouter(t)
+
+	var created utils.Response[webhook.Subscription]
+	t.Run("Create a subscription", func(t *testing.T) {
+		rr := serve(router, "POST", "/webhooks", `{"url":" https://example.com/hook ","events":["message.created"]}`)
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("Expected status 201, got %v: %s", rr.Code, rr.Body)
+		}
+		json.Unmarshal(rr.Body.Bytes(), &created)
+		if created.Data.URL != "https://example.com/hook" || created.Data.Secret == "" {
+			t.Errorf("Expected a trimmed URL and a generated secret, got %+v", created.Data)
+		}
+	})
+
+	t.Run("Invalid subscriptions", func(t *testing.T) {
+		rr := serve(router, "POST", "/webhooks", `{"url":"not a url","events":["message.read"],"secret":"short"}`)
+		if rr.Code != http.StatusBadRequest {
+			t.Fatalf("Expected status 400, got %v", rr.Code)
+		}
+		var problem utils.Problem
+		json.Unmarshal(rr.Body.Bytes(), &problem)
+		got := map[string]string{}
+		for _, fieldError := range problem.Errors {
+			got[fieldError.Field] = fieldError.Code
+		}
+		want := map[string]string{"url": utils.FieldInvalid, "events[0]": utils.FieldInvalid, "secret": utils.FieldTooShort}
+		if len(got) != len(want) {
+			t.Fatalf("Expected errors %v, got %v", want, got)
+		}
+		for field, code := range want {
+			if got[field] != code {
+				t.Errorf("%s: expected %q, got %q", field, code, got[field])
+			}
+		}
+	})
+
+	t.Run("Internal targets are refused", func(t *testing.T) {
+		for _, target := range []string{
+			"http://localhost:8080/hook",
+			"http://api.localhost/hook",
+			"http://127.0.0.1/hook",
+			"http://[::1]/hook",
+			"http://10.1.2.3/hook",
+			"http://192.168.0.10/hook",
+			"http://169.254.169.254/latest/meta-data",
+			"http://[fe80::1]/hook",
+			"http://0.0.0.0/hook",
+			"http://intranet.test/hook",
+			"http://rebinding.test/hook",
+		} {
+			rr := serve(router, "POST", "/webhooks", `{"url":"`+target+`"}`)
+			var problem utils.Problem
+			json.Unmarshal(rr.Body.Bytes(), &problem)
+			if rr.Code != http.StatusBadRequest || len(problem.Errors) != 1 || problem.Errors[0].Field != "url" {
+				t.Errorf("%s: expected a 400 on url, got %v %s", target, rr.Code, rr.Body)
+			}
+		}
+	})
+
+	t.Run("Allowlisted and unresolved targets are accepted", func(t *testing.T) {
+		for _, target := range []string{"http://hooks.test/hook", "http://10.20.1.1/hook", "https://not-yet.test/hook"} {
+			rr := serve(router, "POST", "/webhooks", `{"url":"`+target+`"}`)
+			if rr.Code != http.StatusCreated {
+				t.Errorf("%s: expected status 201, got %v %s", target, rr.Code, rr.Body)
+				continue
+			}
+			var sub utils.Response[webhook.Subscription]
+			json.Unmarshal(rr.Body.Bytes(), &sub)
+			serve(router, "DELETE", "/webhooks/"+sub.Data.ID, "")
+		}
+	})
+
+	t.Run("Get and list hide the secret", func(t *testing.T) {
+		rr := serve(router, "GET", "/webhooks/"+created.Data.ID, "")
+		var got utils.Response[webhook.Subscription]
+		json.Unmarshal(rr.Body.Bytes(), &got)
+		if rr.Code != http.StatusOK || got.Data.ID != created.Data.ID || got.Data.Secret != "" {
+			t.Errorf("Expected the subscription without its secret, got %v %+v", rr.Code, got.Data)
+		}
+
+		rr = serve(router, "GET", "/webhooks", "")
+		var list utils.Response[[]webhook.Subscription]
+		json.Unmarshal(rr.Body.Bytes(), &list)
+		if len(list.Data) != 1 || list.Data[0].Secret != "" {
+			t.Errorf("Expected one subscription without its secret, got %+v", list.Data)
+		}
+	})
+
+	t.Run("Deliveries and dead letters start empty", func(t *testing.T) {
+		for _, url := range []string{"/webhooks/" + created.Data.ID + "/deliveries", "/webhooks/dead-letters"} {
+			rr := serve(router, "GET", url, "")
+			if rr.Code != http.StatusOK || !bytes.Contains(rr.Body.Bytes(), []byte(`"data":[]`)) {
+				t.Errorf("%s: expected an empty list, got %v %s", url, rr.Code, rr.Body)
+			}
+		}
+	})
+
+	t.Run("Delete a subscription", func(t *testing.T) {
+		if rr := serve(router, "DELETE", "/webhooks/"+created.Data.ID, ""); rr.Code != http.StatusNoContent {
+			t.Errorf("Expected status 204, got %v", rr.Code)
+		}
+		for _, req := range [][2]string{
+			{"GET", "/webhooks/" + created.Data.ID},
+			{"DELETE", "/webhooks/" + created.Data.ID},
+			{"GET", "/webhooks/" + created.Data.ID + "/deliveries"},
+			{"POST", "/webhooks/dead-letters/missing/retry"},
+		} {
+			if rr := serve(router, req[0], req[1], ""); rr.Code != http.StatusNotFound {
+				t.Errorf("%s %s: expected status 404, got %v", req[0], req[1], rr.Code)
+			}
+		}
+	})
+}
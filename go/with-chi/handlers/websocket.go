@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"node-week-02-with-chi/store"
+	"node-week-02-with-chi/utils"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// socketSendBuffer bounds the replies waiting for the writer; a client
+	// that stops reading is disconnected rather than buffered without end.
+	socketSendBuffer = 16
+	socketWriteWait  = 10 * time.Second
+)
+
+// Frames a client may send.
+const socketCreateMessage = "message.create"
+
+// Frames the server sends besides store.Event broadcasts.
+const (
+	socketAck   = "ack"
+	socketError = "error"
+)
+
+type socketRequest struct {
+	Type string `json:"type" example:"message.create"`
+	Ref  string `json:"ref,omitempty" example:"client-42"`
+	// Room to post in; empty means the default room.
+	Room string          `json:"room,omitempty" example:"general"`
+	Data json.RawMessage `json:"data" swaggertype:"object"`
+}
+
+type socketReply struct {
+	Type    string         `json:"type"`
+	Ref     string         `json:"ref,omitempty"`
+	Message *store.Message `json:"message,omitempty"`
+	Error   *utils.Problem `json:"error,omitempty"`
+}
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// ChatSocket godoc
+// @Summary Chat over WebSocket
+// @Description Upgrade to a WebSocket that broadcasts the same events as /messages/stream and accepts
+// @Description {"type": "message.create", "ref": "...", "room": "...", "data": {"from": "...", "text": "..."}}
+// @Description frames, where room defaults to the "general" room. Events from every room are broadcast.
+// @Description Each frame is validated like POST /messages and answered with an "ack" carrying the new
+// @Description message or an "error" carrying a problem document, echoing ref. The server pings
+// @Description periodically and closes clients that stop answering or fall behind.
+// @Tags messages
+// @Success 101 "Switching Protocols"
+// @Failure 400 {string} string "Not a WebSocket handshake"
+// @Router /messages/ws [get]
+func (h *MessageHandler) ChatSocket(w http.ResponseWriter, r *http.Request) {
+	if h.Events == nil {
+		utils.WriteProblem(w, http.StatusInternalServerError, utils.CodeInternal, "Streaming is not supported.")
+		return
+	}
+
+	// The upgrader writes its own plain-text error response on failure.
+	w.Header().Del("Content-Type")
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	h.sockets.Add(1)
+	defer h.sockets.Done()
+
+	c := &socketConn{
+		handler: h,
+		ctx:     r.Context(),
+		conn:    conn,
+		sub:     h.Events.Subscribe(streamBuffer),
+		replies: make(chan socketReply, socketSendBuffer),
+		done:    make(chan struct{}),
+	}
+	go c.readLoop()
+	c.writeLoop()
+}
+
+// WaitForSockets blocks until every WebSocket connection has been closed
+// or ctx ends. Connections close once the Events broker is closed.
+func (h *MessageHandler) WaitForSockets(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		h.sockets.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type socketConn struct {
+	handler *MessageHandler
+	ctx     context.Context
+	conn    *websocket.Conn
+	sub     *store.Subscription
+	replies chan socketReply
+	// done is closed when the read loop exits.
+	done chan struct{}
+}
+
+func (c *socketConn) pongWait() time.Duration {
+	return c.handler.heartbeatInterval() * 2
+}
+
+// readLoop handles client frames until the connection fails or closes.
+func (c *socketConn) readLoop() {
+	defer close(c.done)
+
+	c.conn.SetReadLimit(utils.MaxBodyBytes)
+	c.conn.SetReadDeadline(time.Now().Add(c.pongWait()))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(c.pongWait()))
+	})
+
+	for {
+		_, frame, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		reply := c.handle(frame)
+		select {
+		case c.replies <- reply:
+		default:
+			// The client is not reading our replies; give up on it.
+			c.conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too many pending replies"),
+				time.Now().Add(socketWriteWait))
+			return
+		}
+	}
+}
+
+func (c *socketConn) handle(frame []byte) socketReply {
+	var req socketRequest
+	if err := utils.DecodeJSON(frame, &req); err != nil {
+		return bodyErrorReply("", err)
+	}
+	if req.Type != socketCreateMessage {
+		problem := utils.NewProblem(http.StatusBadRequest, utils.CodeInvalidBody, "Unknown frame type.",
+			utils.FieldError{Field: "type", Code: utils.FieldInvalid, Message: "type must be " + socketCreateMessage})
+		return socketReply{Type: socketError, Ref: req.Ref, Error: &problem}
+	}
+
+	var create store.CreateMessageRequest
+	if err := utils.DecodeJSON(req.Data, &create); err != nil {
+		return bodyErrorReply(req.Ref, err)
+	}
+	create.RoomID = req.Room
+	if fieldErrors := c.handler.validateRequest(&create); len(fieldErrors) > 0 {
+		problem := utils.NewProblem(http.StatusBadRequest, utils.CodeValidationFailed, "The message is invalid.", fieldErrors...)
+		return socketReply{Type: socketError, Ref: req.Ref, Error: &problem}
+	}
+
+	newMessage, err := c.handler.Store.Create(c.ctx, create)
+	if err != nil {
+		problem := storeProblem(err)
+		return socketReply{Type: socketError, Ref: req.Ref, Error: &problem}
+	}
+	return socketReply{Type: socketAck, Ref: req.Ref, Message: &newMessage}
+}
+
+func bodyErrorReply(ref string, err error) socketReply {
+	var bodyErr *utils.BodyError
+	problem := utils.NewProblem(http.StatusBadRequest, utils.CodeInvalidBody, err.Error())
+	if errors.As(err, &bodyErr) {
+		problem = utils.NewProblem(bodyErr.Status, bodyErr.Code, bodyErr.Detail, bodyErr.Errors...)
+	}
+	return socketReply{Type: socketError, Ref: ref, Error: &problem}
+}
+
+// writeLoop is the connection's only writer: it forwards broadcasts and
+// replies, pings the client and closes the connection on the way out.
+func (c *socketConn) writeLoop() {
+	ping := time.NewTicker(c.handler.heartbeatInterval())
+	defer func() {
+		ping.Stop()
+		c.sub.Unsubscribe()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case event, open := <-c.sub.C:
+			if !open {
+				// Either the server is shutting down or we fell behind.
+				c.closeWith(websocket.CloseGoingAway, "server closing or client too slow")
+				return
+			}
+			if !c.write(event) {
+				return
+			}
+		case reply := <-c.replies:
+			if !c.write(reply) {
+				return
+			}
+		case <-ping.C:
+			c.conn.SetWriteDeadline(time.Now().Add(socketWriteWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (c *socketConn) write(v any) bool {
+	c.conn.SetWriteDeadline(time.Now().Add(socketWriteWait))
+	return c.conn.WriteJSON(v) == nil
+}
+
+func (c *socketConn) closeWith(code int, reason string) {
+	c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(socketWriteWait))
+	// Give the client a moment to answer the close frame.
+	select {
+	case <-c.done:
+	case <-time.After(time.Second):
+	}
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"node-week-02-with-chi/store"
+	"node-week-02-with-chi/utils"
+
+	"github.com/gorilla/websocket"
+)
+
+// socketFrame holds the fields of any frame the server sends.
+type socketFrame struct {
+	Type    string         `json:"type"`
+	Ref     string         `json:"ref"`
+	Message *store.Message `json:"message"`
+	Error   *utils.Problem `json:"error"`
+}
+
+func dialSocket(t *testing.T, url string) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(url, "http"), nil)
+	if err != nil {
+		t.Fatalf("Dialing socket: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func readFrame(t *testing.T, conn *websocket.Conn) socketFrame {
+	t.Helper()
+	var frame socketFrame
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if err := conn.ReadJSON(&frame); err != nil {
+		t.Fatalf("Reading frame: %v", err)
+	}
+	return frame
+}
+
+// Testing ChatSocket
+func TestChatSocket(t *testing.T) {
+	handler, events := setupStreamHandler()
+	ts := httptest.NewServer(http.HandlerFunc(handler.ChatSocket))
+	t.Cleanup(ts.Close)
+
+	t.Run("Send a message and receive the ack and broadcast", func(t *testing.T) {
+		sender := dialSocket(t, ts.URL)
+		listener := dialSocket(t, ts.URL)
+
+		sender.WriteJSON(map[string]any{
+			"type": "message.create",
+			"ref":  "r1",
+			"data": map[string]string{"from": " Bart ", "text": "Hi"},
+		})
+
+		// The ack and the broadcast may arrive in either order.
+		frames := map[string]socketFrame{}
+		for range 2 {
+			frame := readFrame(t, sender)
+			frames[frame.Type] = frame
+		}
+		ack := frames["ack"]
+		if ack.Ref != "r1" || ack.Message == nil || ack.Message.From != "Bart" {
+			t.Fatalf("Expected an ack for r1 with a trimmed sender, got %+v", ack)
+		}
+		if created := frames[string(store.MessageCreated)]; created.Message == nil || created.Message.ID != ack.Message.ID {
+			t.Errorf("Expected the sender to see the broadcast, got %+v", frames)
+		}
+
+		broadcast := readFrame(t, listener)
+		if broadcast.Type != string(store.MessageCreated) || broadcast.Message.ID != ack.Message.ID {
+			t.Errorf("Expected the listener to see message %s created, got %+v", ack.Message.ID, broadcast)
+		}
+	})
+
+	t.Run("Invalid frames are answered with a problem", func(t *testing.T) {
+		conn := dialSocket(t, ts.URL)
+
+		tests := []struct {
+			frame string
+			code  utils.ProblemCode
+		}{
+			{`{"type":"message.create","ref":"r2","data":{"from":"","text":"Hi"}}`, utils.CodeValidationFailed},
+			{`{"type":"message.create","ref":"r2","data":{"from":"Bart","text":"Hi","extra":1}}`, utils.CodeInvalidBody},
+			{`{"type":"message.delete","ref":"r2","data":{}}`, utils.CodeInvalidBody},
+			{`not json`, utils.CodeInvalidBody},
+			{`{"type":"message.create","ref":"r2","room":"missing","data":{"from":"Bart","text":"Hi"}}`, utils.CodeNotFound},
+		}
+		for _, tt := range tests {
+			conn.WriteMessage(websocket.TextMessage, []byte(tt.frame))
+			frame := readFrame(t, conn)
+			if frame.Type != "error" || frame.Error == nil || frame.Error.Code != tt.code {
+				t.Errorf("Frame %s: expected an error with code %s, got %+v", tt.frame, tt.code, frame)
+			}
+		}
+	})
+
+	t.Run("Plain requests are rejected", func(t *testing.T) {
+		resp, err := http.Get(ts.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected status 400, got %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("Closing the broker closes the socket", func(t *testing.T) {
+		conn := dialSocket(t, ts.URL)
+		// Make sure the connection is subscribed before closing.
+		conn.WriteMessage(websocket.TextMessage, []byte(`{}`))
+		readFrame(t, conn)
+
+		events.Close()
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		_, _, err := conn.ReadMessage()
+		if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+			t.Errorf("Expected a going-away close, got %v", err)
+		}
+	})
+}
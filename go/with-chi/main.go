@@ -1,21 +1,198 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
 	"log"
 	"node-week-02-with-chi/api"
+	"node-week-02-with-chi/store"
+	"node-week-02-with-chi/validate"
+	"node-week-02-with-chi/webhook"
+	"os"
+	"strconv"
+	"time"
+
+	_ "modernc.org/sqlite"
 )
 
+var welcomeMessage = store.CreateMessageRequest{
+	From: "Bart",
+	Text: "Welcome to CYF chat system!",
+}
+
 // @title CYF Chat Application API
 // @version 1.0
 // @description This is a RESTful API for the CYF chat application, providing message management capabilities.
 // @host localhost:4001
 // @BasePath /api/v1
+// @securityDefinitions.apikey AdminToken
+// @in header
+// @name Authorization
+// @description "Bearer " followed by the token given to -admin-token.
 func main() {
-	server := api.NewAPIServer(":4001")
+	storeKind := flag.String("store", "memory", "message store backend: memory, file or sqlite")
+	dataDir := flag.String("data-dir", "data", "directory for the file store's snapshot and journal")
+	compactInterval := flag.Duration("compact-interval", 5*time.Minute, "how often the file store compacts its journal")
+	dbPath := flag.String("db", "chat.db", "SQLite database file for the sqlite store")
+	idKind := flag.String("ids", "counter", "message ID generator: counter, ulid or snowflake")
+	nodeID := flag.Int64("node", 0, "node number embedded in snowflake IDs (0-1023)")
+	maxFromLength := flag.Int("max-from-length", 0, "maximum length of a sender name (0 keeps the default)")
+	maxTextLength := flag.Int("max-text-length", 0, "maximum length of a message text (0 keeps the default)")
+	retention := flag.Duration("retention", 30*24*time.Hour, "how long deleted messages can be restored before they are purged (0 keeps them forever)")
+	purgeInterval := flag.Duration("purge-interval", time.Hour, "how often deleted messages past the retention window are purged")
+	adminToken := flag.String("admin-token", os.Getenv("ADMIN_TOKEN"), "bearer token for admin endpoints such as restore and webhooks; empty disables them (default $ADMIN_TOKEN)")
+	webhookAllow := flag.String("webhook-allow", "", "comma-separated CIDR ranges, addresses and host names of internal services that webhooks may call")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [migrate up|down [steps]|status]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.Arg(0) == "migrate" {
+		if err := runMigrate(*dbPath, flag.Args()[1:]); err != nil {
+			log.Fatalf("Migrate error:%v", err)
+		}
+		return
+	}
+
+	allowlist, err := webhook.ParseAllowlist(*webhookAllow)
+	if err != nil {
+		log.Fatalf("Webhook error:%v", err)
+	}
+
+	ids, err := store.NewIDGenerator(*idKind, *nodeID)
+	if err != nil {
+		log.Fatalf("Store error:%v", err)
+	}
 
-	err := server.Run()
+	messageStore, closeStore, err := openStore(*storeKind, ids, *dataDir, *compactInterval, *dbPath)
+	if err != nil {
+		log.Fatalf("Store error:%v", err)
+	}
+
+	if err := seedStore(messageStore); err != nil {
+		log.Fatalf("Store error:%v", err)
+	}
+
+	server := api.NewAPIServer(":4001", messageStore)
+	server.Handler.Limits = messageLimits(*maxFromLength, *maxTextLength)
+	server.AdminToken = *adminToken
+	server.Webhooks.Allow(allowlist)
+
+	purger := store.StartPurger(messageStore, *retention, *purgeInterval)
+	err = server.Run()
+	purger.Close()
+	if closeErr := closeStore(); closeErr != nil {
+		log.Printf("Store close error:%v", closeErr)
+	}
 	if err != nil {
 		log.Fatalf("Server error:%v", err)
 	}
 
 }
+
+func openStore(kind string, ids store.IDGenerator, dataDir string, compactInterval time.Duration, dbPath string) (store.MessageStore, func() error, error) {
+	switch kind {
+	case "memory":
+		return store.NewMemoryStoreWithIDs(ids), func() error { return nil }, nil
+	case "file":
+		fileStore, err := store.OpenFileStore(dataDir, store.FileStoreOptions{
+			IDs:             ids,
+			CompactInterval: compactInterval,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		return fileStore, fileStore.Close, nil
+	case "sqlite":
+		db, err := openDB(dbPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := store.MigrateUp(context.Background(), db); err != nil {
+			db.Close()
+			return nil, nil, err
+		}
+		return store.NewSQLStore(db, ids), db.Close, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown store %q", kind)
+	}
+}
+
+func openDB(path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows a single writer; serialising connections avoids SQLITE_BUSY.
+	db.SetMaxOpenConns(1)
+	return db, nil
+}
+
+func runMigrate(dbPath string, args []string) error {
+	db, err := openDB(dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	switch command {
+	case "up":
+		return store.MigrateUp(ctx, db)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				return fmt.Errorf("invalid step count %q", args[1])
+			}
+		}
+		return store.MigrateDown(ctx, db, steps)
+	case "status":
+		statuses, err := store.MigrationStatuses(ctx, db)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			applied := "pending"
+			if status.AppliedAt != nil {
+				applied = "applied " + status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d_%s\t%s\n", status.Version, status.Name, applied)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate command %q", command)
+	}
+}
+
+func messageLimits(maxFromLength, maxTextLength int) validate.Limits {
+	limits := validate.Limits{}
+	if maxFromLength > 0 {
+		limits["from"] = maxFromLength
+	}
+	if maxTextLength > 0 {
+		limits["text"] = maxTextLength
+	}
+	return limits
+}
+
+// seedStore posts the welcome message into an empty store.
+func seedStore(messageStore store.MessageStore) error {
+	ctx := context.Background()
+
+	existing, err := messageStore.List(ctx, store.DefaultRoomID)
+	if err != nil || len(existing) > 0 {
+		return err
+	}
+
+	_, err = messageStore.Create(ctx, welcomeMessage)
+	return err
+}
@@ -0,0 +1,80 @@
+// Package search is a full-text index over message text. Text is split
+// into words that are case folded and stripped of accents, so "Café",
+// "CAFE" and "café" all match; queries are ranked with BM25.
+package search
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Token is one word of a text.
+type Token struct {
+	// Term is the word as it is indexed; see Fold.
+	Term string
+	// Start and End are the byte offsets of the word in the text.
+	Start, End int
+}
+
+// Tokenize splits text into words: runs of letters, digits and the marks
+// that combine with them. Everything else separates words.
+func Tokenize(text string) []Token {
+	var tokens []Token
+	start := -1
+	for i, r := range text {
+		if isWordRune(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			tokens = appendToken(tokens, text, start, i)
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = appendToken(tokens, text, start, len(text))
+	}
+	return tokens
+}
+
+func appendToken(tokens []Token, text string, start, end int) []Token {
+	if term := Fold(text[start:end]); term != "" {
+		tokens = append(tokens, Token{Term: term, Start: start, End: end})
+	}
+	return tokens
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r) || unicode.In(r, unicode.Mn, unicode.Mc)
+}
+
+// Fold returns the form of word that is indexed and searched for: case
+// folded, with accents and other combining marks removed.
+func Fold(word string) string {
+	if isASCII(word) {
+		return strings.ToLower(word)
+	}
+	// Transformers keep state, so they cannot be shared between goroutines.
+	stripped, _, err := transform.String(transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC), word)
+	if err != nil {
+		stripped = word
+	}
+	return cases.Fold().String(stripped)
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,104 @@
+package search
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"testing"
+)
+
+var corpusSizes = []int{10_000, 100_000, 1_000_000}
+
+// corpus is an index of generated messages drawn from a Zipf-distributed
+// vocabulary of 50,000 words, with "needle" planted in exactly 100 of
+// them however large the corpus is.
+type corpus struct {
+	index *Index
+	texts []string
+}
+
+var (
+	corporaMu sync.Mutex
+	corpora   = map[int]*corpus{}
+)
+
+func benchCorpus(b *testing.B, n int) *corpus {
+	b.Helper()
+	corporaMu.Lock()
+	defer corporaMu.Unlock()
+	if c := corpora[n]; c != nil {
+		return c
+	}
+
+	r := rand.New(rand.NewSource(1))
+	zipf := rand.NewZipf(r, 1.1, 1, 49_999)
+	c := &corpus{index: NewIndex(compareIDs), texts: make([]string, n)}
+	var text strings.Builder
+	for i := range n {
+		text.Reset()
+		for j := range 8 + r.Intn(5) {
+			if j > 0 {
+				text.WriteByte(' ')
+			}
+			fmt.Fprintf(&text, "w%d", zipf.Uint64())
+		}
+		if i%(n/100) == 0 {
+			text.WriteString(" Needle")
+		}
+		c.texts[i] = text.String()
+		c.index.Add(Document{ID: fmt.Sprint(i), Room: "general", Text: c.texts[i]})
+	}
+	corpora[n] = c
+	return c
+}
+
+// BenchmarkSearch shows lookups costing about the same at every corpus
+// size when the query has a rare word, since only its 100 postings are
+// visited. Queries of common words cost in proportion to how many
+// messages contain them.
+func BenchmarkSearch(b *testing.B) {
+	for _, query := range []string{"needle", "needle w1", "needle OR w5000", "w100 w200"} {
+		q, err := Parse(query)
+		if err != nil {
+			b.Fatal(err)
+		}
+		for _, n := range corpusSizes {
+			b.Run(fmt.Sprintf("%s/%d", strings.ReplaceAll(query, " ", "_"), n), func(b *testing.B) {
+				c := benchCorpus(b, n)
+				b.ResetTimer()
+				for range b.N {
+					c.index.Search("general", q)
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkLinearScan is the lowercased substring scan the index replaced,
+// for comparison.
+func BenchmarkLinearScan(b *testing.B) {
+	for _, n := range corpusSizes {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			c := benchCorpus(b, n)
+			b.ResetTimer()
+			for range b.N {
+				var hits int
+				for _, text := range c.texts {
+					if strings.Contains(strings.ToLower(text), "needle") {
+						hits++
+					}
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkAdd measures indexing one message into a large index.
+func BenchmarkAdd(b *testing.B) {
+	c := benchCorpus(b, 1_000_000)
+	b.ResetTimer()
+	for i := range b.N {
+		c.index.Add(Document{ID: fmt.Sprint("new", i), Room: "general", Text: "A new message about the café and its Needle"})
+	}
+}
@@ -0,0 +1,32 @@
+package search
+
+import (
+	"cmp"
+	"html"
+	"slices"
+	"strings"
+)
+
+// Highlight returns text, HTML-escaped, with the words and phrases q looks
+// for wrapped in <mark> tags.
+func Highlight(text string, q Query) string {
+	spans := q.spans(Tokenize(text), nil)
+	slices.SortFunc(spans, func(a, b [2]int) int { return cmp.Compare(a[0], b[0]) })
+
+	var out strings.Builder
+	last := 0
+	for i := 0; i < len(spans); {
+		start, end := spans[i][0], spans[i][1]
+		// Overlapping matches, such as a word inside a phrase, share a mark.
+		for i++; i < len(spans) && spans[i][0] < end; i++ {
+			end = max(end, spans[i][1])
+		}
+		out.WriteString(html.EscapeString(text[last:start]))
+		out.WriteString("<mark>")
+		out.WriteString(html.EscapeString(text[start:end]))
+		out.WriteString("</mark>")
+		last = end
+	}
+	out.WriteString(html.EscapeString(text[last:]))
+	return out.String()
+}
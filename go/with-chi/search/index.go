@@ -0,0 +1,416 @@
+package search
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"sort"
+	"sync"
+)
+
+// BM25 parameters: k1 limits how much repeating a word raises a score and
+// b how much long texts are penalised.
+const (
+	k1 = 1.2
+	b  = 0.75
+)
+
+// Document is a text to index. Room scopes searches; ID identifies the
+// document within the index.
+type Document struct {
+	ID   string
+	Room string
+	Text string
+}
+
+// Hit is a document that matched a query.
+type Hit struct {
+	ID    string
+	Score float64
+}
+
+// Index is an inverted index from terms to the documents containing them.
+// Lookups only visit the documents that contain the query's terms, so
+// their cost depends on how common the terms are rather than on the size
+// of the index. It is safe for concurrent use.
+type Index struct {
+	mu sync.RWMutex
+	// compare orders document IDs from oldest to newest, to break ties
+	// between equal scores.
+	compare func(a, b string) int
+	docs    []doc
+	// byID maps document IDs to their slot in docs. Slots are never
+	// reused until compact renumbers them, so posting lists stay sorted
+	// by simply appending.
+	byID     map[string]uint32
+	postings map[string]*postingList
+	// live and length count the indexed documents and their terms.
+	live   int
+	length int
+}
+
+type doc struct {
+	id, room, text string
+	length         int
+	live           bool
+}
+
+type posting struct {
+	doc  uint32
+	freq uint32
+}
+
+type postingList struct {
+	postings []posting
+	// live is the number of live documents in postings: the term's
+	// document frequency.
+	live int
+}
+
+// NewIndex returns an empty index whose document IDs are ordered from
+// oldest to newest by compare.
+func NewIndex(compare func(a, b string) int) *Index {
+	return &Index{compare: compare, byID: map[string]uint32{}, postings: map[string]*postingList{}}
+}
+
+// Add indexes d, replacing any document with the same ID.
+func (ix *Index) Add(d Document) {
+	tokens := Tokenize(d.Text)
+	freqs := make(map[string]uint32, len(tokens))
+	for _, t := range tokens {
+		freqs[t.Term]++
+	}
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	ix.removeLocked(d.ID)
+	n := uint32(len(ix.docs))
+	ix.docs = append(ix.docs, doc{id: d.ID, room: d.Room, text: d.Text, length: len(tokens), live: true})
+	ix.byID[d.ID] = n
+	for term, freq := range freqs {
+		list := ix.postings[term]
+		if list == nil {
+			list = &postingList{}
+			ix.postings[term] = list
+		}
+		list.postings = append(list.postings, posting{n, freq})
+		list.live++
+	}
+	ix.live++
+	ix.length += len(tokens)
+}
+
+// Remove drops document id from the index, if it is there.
+func (ix *Index) Remove(id string) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	ix.removeLocked(id)
+	if dead := len(ix.docs) - ix.live; dead > 1024 && dead > ix.live {
+		ix.compact()
+	}
+}
+
+// RemoveRoom drops every document in room.
+func (ix *Index) RemoveRoom(room string) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	for _, d := range ix.docs {
+		if d.live && d.room == room {
+			ix.removeLocked(d.id)
+		}
+	}
+	ix.compact()
+}
+
+// Len returns the number of documents in the index.
+func (ix *Index) Len() int {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return ix.live
+}
+
+func (ix *Index) removeLocked(id string) {
+	n, ok := ix.byID[id]
+	if !ok {
+		return
+	}
+	d := &ix.docs[n]
+	seen := map[string]bool{}
+	for _, t := range Tokenize(d.text) {
+		if seen[t.Term] {
+			continue
+		}
+		seen[t.Term] = true
+		if list := ix.postings[t.Term]; list != nil {
+			if list.live--; list.live == 0 {
+				delete(ix.postings, t.Term)
+			}
+		}
+	}
+	ix.live--
+	ix.length -= d.length
+	*d = doc{}
+	delete(ix.byID, id)
+}
+
+// compact renumbers the live documents to drop the dead slots left by
+// Remove. Numbers keep their order, so posting lists stay sorted.
+func (ix *Index) compact() {
+	renumbered := make([]uint32, len(ix.docs))
+	docs := make([]doc, 0, ix.live)
+	for i, d := range ix.docs {
+		if d.live {
+			renumbered[i] = uint32(len(docs))
+			ix.byID[d.id] = uint32(len(docs))
+			docs = append(docs, d)
+		}
+	}
+	for _, list := range ix.postings {
+		postings := list.postings[:0]
+		for _, p := range list.postings {
+			if ix.docs[p.doc].live {
+				postings = append(postings, posting{renumbered[p.doc], p.freq})
+			}
+		}
+		list.postings = slices.Clip(postings)
+	}
+	ix.docs = docs
+}
+
+// Search returns the documents in room whose text matches q, best first
+// by BM25 score and then newest first by ID, so that editing a document
+// does not move it among equally good hits. Filters in q are left to the
+// caller; see MatchFilters.
+func (ix *Index) Search(room string, q Query) []Hit {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	matches := ix.eval(q)
+	slices.SortFunc(matches, func(a, b match) int {
+		return cmp.Or(cmp.Compare(b.score, a.score), ix.compare(ix.docs[b.doc].id, ix.docs[a.doc].id))
+	})
+	var hits []Hit
+	for _, m := range matches {
+		if d := ix.docs[m.doc]; d.room == room {
+			hits = append(hits, Hit{ID: d.id, Score: m.score})
+		}
+	}
+	return hits
+}
+
+// match is a live document matching part of a query, with its score so far.
+type match struct {
+	doc   uint32
+	score float64
+}
+
+// eval returns the documents matching q in document order.
+func (ix *Index) eval(q Query) []match {
+	switch q := q.(type) {
+	case Term:
+		list := ix.postings[string(q)]
+		if list == nil {
+			return nil
+		}
+		return ix.termMatches(list)
+	case Phrase:
+		return ix.phrase(q)
+	case And:
+		return ix.and(q)
+	case Or:
+		var all []match
+		for _, child := range q {
+			all = append(all, ix.eval(child)...)
+		}
+		return mergeScores(all)
+	default:
+		return nil
+	}
+}
+
+func (ix *Index) termMatches(list *postingList) []match {
+	idf := ix.idf(list)
+	matches := make([]match, 0, list.live)
+	for _, p := range list.postings {
+		if d := ix.docs[p.doc]; d.live {
+			matches = append(matches, match{p.doc, ix.score(idf, p.freq, d.length)})
+		}
+	}
+	return matches
+}
+
+// and intersects the children of q and drops the documents its Not
+// children match. The rarest term or subquery picks the candidates and the
+// other terms are looked up in their posting lists, so a rare word keeps a
+// query cheap however common the others are.
+func (ix *Index) and(q And) []match {
+	var (
+		terms    []*postingList
+		results  [][]match
+		excluded []Query
+	)
+	for _, child := range q {
+		switch child := child.(type) {
+		case Term:
+			list := ix.postings[string(child)]
+			if list == nil {
+				return nil
+			}
+			terms = append(terms, list)
+		case Not:
+			excluded = append(excluded, child.Query)
+		case Filter:
+			// Checked by the caller.
+		default:
+			results = append(results, ix.eval(child))
+		}
+	}
+	if len(terms) == 0 && len(results) == 0 {
+		return nil
+	}
+	slices.SortFunc(terms, func(a, b *postingList) int { return cmp.Compare(len(a.postings), len(b.postings)) })
+	slices.SortFunc(results, func(a, b []match) int { return cmp.Compare(len(a), len(b)) })
+
+	var candidates []match
+	switch {
+	case len(terms) > 0 && (len(results) == 0 || len(terms[0].postings) <= len(results[0])):
+		candidates = ix.termMatches(terms[0])
+		terms = terms[1:]
+	case len(results) > 0:
+		candidates, results = results[0], results[1:]
+	}
+
+	for _, list := range terms {
+		candidates = ix.probe(candidates, list)
+	}
+	for _, other := range results {
+		candidates = intersect(candidates, other)
+	}
+	for _, q := range excluded {
+		switch q := q.(type) {
+		case Term:
+			if list := ix.postings[string(q)]; list != nil {
+				candidates = ix.exclude(candidates, list)
+			}
+		case Filter:
+			// Checked by the caller.
+		default:
+			candidates = subtract(candidates, ix.eval(q))
+		}
+	}
+	return candidates
+}
+
+// phrase finds the documents with every word of p and keeps those that
+// have them in order.
+func (ix *Index) phrase(p Phrase) []match {
+	terms := make(And, len(p))
+	for i, term := range p {
+		terms[i] = Term(term)
+	}
+	candidates := ix.and(terms)
+	kept := candidates[:0]
+	for _, c := range candidates {
+		if p.find(Tokenize(ix.docs[c.doc].text), 0) >= 0 {
+			kept = append(kept, c)
+		}
+	}
+	return kept
+}
+
+// probe keeps the candidates that appear in list, adding its score.
+func (ix *Index) probe(candidates []match, list *postingList) []match {
+	idf := ix.idf(list)
+	kept := candidates[:0]
+	postings := list.postings
+	for _, c := range candidates {
+		i := sort.Search(len(postings), func(i int) bool { return postings[i].doc >= c.doc })
+		postings = postings[i:]
+		if len(postings) == 0 {
+			break
+		}
+		if postings[0].doc == c.doc {
+			c.score += ix.score(idf, postings[0].freq, ix.docs[c.doc].length)
+			kept = append(kept, c)
+		}
+	}
+	return kept
+}
+
+// exclude drops the candidates that appear in list.
+func (ix *Index) exclude(candidates []match, list *postingList) []match {
+	kept := candidates[:0]
+	postings := list.postings
+	for _, c := range candidates {
+		i := sort.Search(len(postings), func(i int) bool { return postings[i].doc >= c.doc })
+		postings = postings[i:]
+		if len(postings) == 0 || postings[0].doc != c.doc {
+			kept = append(kept, c)
+		}
+	}
+	return kept
+}
+
+// subtract keeps the matches in a that are not in b.
+func subtract(a, b []match) []match {
+	kept := a[:0]
+	j := 0
+	for _, m := range a {
+		for j < len(b) && b[j].doc < m.doc {
+			j++
+		}
+		if j == len(b) || b[j].doc != m.doc {
+			kept = append(kept, m)
+		}
+	}
+	return kept
+}
+
+// intersect keeps the matches in both a and b, adding their scores.
+func intersect(a, b []match) []match {
+	kept := a[:0]
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i].doc < b[j].doc:
+			i++
+		case a[i].doc > b[j].doc:
+			j++
+		default:
+			kept = append(kept, match{a[i].doc, a[i].score + b[j].score})
+			i++
+			j++
+		}
+	}
+	return kept
+}
+
+// mergeScores sorts matches by document, adding up the scores of repeats.
+func mergeScores(matches []match) []match {
+	slices.SortFunc(matches, func(a, b match) int { return cmp.Compare(a.doc, b.doc) })
+	merged := matches[:0]
+	for _, m := range matches {
+		if n := len(merged); n > 0 && merged[n-1].doc == m.doc {
+			merged[n-1].score += m.score
+		} else {
+			merged = append(merged, m)
+		}
+	}
+	return merged
+}
+
+// idf is the BM25 inverse document frequency of a term.
+func (ix *Index) idf(list *postingList) float64 {
+	n, df := float64(ix.live), float64(list.live)
+	return math.Log(1 + (n-df+0.5)/(df+0.5))
+}
+
+// score is the BM25 score of a term found freq times in a document of
+// length terms.
+func (ix *Index) score(idf float64, freq uint32, length int) float64 {
+	avg := float64(ix.length) / float64(ix.live)
+	f := float64(freq)
+	return idf * f * (k1 + 1) / (f + k1*(1-b+b*float64(length)/avg))
+}
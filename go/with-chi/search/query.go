@@ -0,0 +1,474 @@
+package search
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Query is a parsed search query: a tree of Term, Phrase, And, Or and Not
+// nodes over the text, with From, Before, After and Has filters on the
+// other fields of a message.
+type Query interface {
+	// spans appends the byte ranges of tokens that the query marks in a
+	// text, for highlighting.
+	spans(tokens []Token, dst [][2]int) [][2]int
+}
+
+// Term matches messages containing a folded word.
+type Term string
+
+// Phrase matches messages containing its folded words next to each other
+// and in order.
+type Phrase []string
+
+// And matches messages that match every one of its queries.
+type And []Query
+
+// Or matches messages that match any of its queries.
+type Or []Query
+
+// Not matches messages that do not match Query. It only appears inside an
+// And alongside something to search for.
+type Not struct {
+	Query Query
+}
+
+// Filter is a query on the fields of a message rather than its text. The
+// index leaves filters to its callers; see MatchFilters.
+type Filter interface {
+	Query
+	match(f Fields) bool
+}
+
+// From matches messages whose sender folds to the same string.
+type From string
+
+// Before matches messages sent before a time.
+type Before time.Time
+
+// After matches messages sent at or after a time.
+type After time.Time
+
+// Has matches messages with replies or reactions.
+type Has string
+
+const (
+	HasReply    Has = "reply"
+	HasReaction Has = "reaction"
+)
+
+// Fields are the parts of a message that filters look at.
+type Fields struct {
+	From      string
+	TimeSent  time.Time
+	Replies   int
+	Reactions int
+}
+
+func (t Term) spans(tokens []Token, dst [][2]int) [][2]int {
+	for _, token := range tokens {
+		if token.Term == string(t) {
+			dst = append(dst, [2]int{token.Start, token.End})
+		}
+	}
+	return dst
+}
+
+func (p Phrase) spans(tokens []Token, dst [][2]int) [][2]int {
+	for i := p.find(tokens, 0); i >= 0; i = p.find(tokens, i+1) {
+		dst = append(dst, [2]int{tokens[i].Start, tokens[i+len(p)-1].End})
+	}
+	return dst
+}
+
+// find returns the index of the first occurrence of p in tokens at or
+// after from, or -1.
+func (p Phrase) find(tokens []Token, from int) int {
+	for i := from; i+len(p) <= len(tokens); i++ {
+		j := 0
+		for j < len(p) && tokens[i+j].Term == p[j] {
+			j++
+		}
+		if j == len(p) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (q And) spans(tokens []Token, dst [][2]int) [][2]int {
+	for _, child := range q {
+		dst = child.spans(tokens, dst)
+	}
+	return dst
+}
+
+func (q Or) spans(tokens []Token, dst [][2]int) [][2]int { return And(q).spans(tokens, dst) }
+
+// Excluded words are not what the reader is looking for, and filters do
+// not match text.
+func (Not) spans(_ []Token, dst [][2]int) [][2]int    { return dst }
+func (From) spans(_ []Token, dst [][2]int) [][2]int   { return dst }
+func (Before) spans(_ []Token, dst [][2]int) [][2]int { return dst }
+func (After) spans(_ []Token, dst [][2]int) [][2]int  { return dst }
+func (Has) spans(_ []Token, dst [][2]int) [][2]int    { return dst }
+
+func (q From) match(f Fields) bool   { return Fold(strings.TrimSpace(f.From)) == string(q) }
+func (q Before) match(f Fields) bool { return f.TimeSent.Before(time.Time(q)) }
+func (q After) match(f Fields) bool  { return !f.TimeSent.Before(time.Time(q)) }
+
+func (q Has) match(f Fields) bool {
+	switch q {
+	case HasReply:
+		return f.Replies > 0
+	case HasReaction:
+		return f.Reactions > 0
+	}
+	return false
+}
+
+// MatchFilters reports whether a message with fields f passes the filters
+// of q, including excluded ones such as -from:ann. Index.Search only looks
+// at text, so callers check its hits with MatchFilters.
+func MatchFilters(q Query, f Fields) bool {
+	parts, ok := q.(And)
+	if !ok {
+		parts = And{q}
+	}
+	for _, part := range parts {
+		switch part := part.(type) {
+		case Filter:
+			if !part.match(f) {
+				return false
+			}
+		case Not:
+			if filter, ok := part.Query.(Filter); ok && filter.match(f) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// SyntaxError reports a query that cannot be parsed.
+type SyntaxError struct {
+	// Offset is the byte offset in the query where the problem was found.
+	Offset int
+	Msg    string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%s (at character %d)", e.Msg, e.Offset+1)
+}
+
+// Parse reads a query of space-separated parts, all of which must match:
+//
+//	tea               the word tea, in any case and with or without accents
+//	"green tea"       the words green and tea, next to each other
+//	tea OR coffee     either word; OR binds tighter than the spaces around it
+//	-milk             not the word milk; also -"oat milk" and -from:ann
+//	from:ann          sent by ann; quote names with spaces, from:"Ann Lee"
+//	before:2026-01-01 sent before a date or RFC 3339 time; after: is the
+//	                  other way, and includes the time itself
+//	has:reply         with at least one reply; has:reaction likewise
+//
+// Words are tokenized like indexed text, so e-mail is the phrase "e mail".
+// A query needs at least one word or phrase to search for; filters and
+// exclusions can only narrow it down, and cannot be joined with OR.
+func Parse(text string) (Query, error) {
+	items, err := lex(text)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		all      And
+		positive bool
+		pending  = -1 // offset of an OR still waiting for its right side
+	)
+	for _, it := range items {
+		if it.operator() {
+			if it.text == "AND" {
+				continue
+			}
+			if len(all) == 0 || pending >= 0 {
+				return nil, &SyntaxError{it.offset, "OR must come between two words"}
+			}
+			if err := orOperand(all[len(all)-1], it.offset); err != nil {
+				return nil, err
+			}
+			pending = it.offset
+			continue
+		}
+
+		q, err := it.query()
+		if err != nil {
+			return nil, err
+		}
+		if q == nil {
+			continue
+		}
+		if pending >= 0 {
+			if err := orOperand(q, it.offset); err != nil {
+				return nil, err
+			}
+			all[len(all)-1] = joinOr(all[len(all)-1], q)
+			pending = -1
+			continue
+		}
+		all = append(all, q)
+		positive = positive || searchable(q)
+	}
+	if pending >= 0 {
+		return nil, &SyntaxError{pending, "OR must come between two words"}
+	}
+	if len(all) == 0 {
+		return nil, &SyntaxError{0, "the query has no words to search for"}
+	}
+	if !positive {
+		return nil, &SyntaxError{0, "add a word or phrase to search for; filters and exclusions only narrow a search down"}
+	}
+	if len(all) == 1 {
+		return all[0], nil
+	}
+	return all, nil
+}
+
+// searchable reports whether q finds messages by their text, rather than
+// only narrowing down what other parts find.
+func searchable(q Query) bool {
+	switch q.(type) {
+	case Not, Filter:
+		return false
+	}
+	return true
+}
+
+// orOperand checks that q can be one side of the OR at offset.
+func orOperand(q Query, offset int) error {
+	switch q := q.(type) {
+	case Not:
+		return &SyntaxError{offset, "an excluded word cannot be joined with OR"}
+	case Filter:
+		return &SyntaxError{offset, operatorName(q) + ": cannot be joined with OR"}
+	}
+	return nil
+}
+
+func operatorName(f Filter) string {
+	switch f.(type) {
+	case From:
+		return "from"
+	case Before:
+		return "before"
+	case After:
+		return "after"
+	default:
+		return "has"
+	}
+}
+
+func joinOr(left, right Query) Query {
+	if or, ok := left.(Or); ok {
+		return append(or, right)
+	}
+	return Or{left, right}
+}
+
+// item is one space-separated part of a query.
+type item struct {
+	text   string
+	offset int
+	// negated is set by a leading minus sign, quoted by double quotes
+	// around text and field by an operator such as from: before it.
+	negated bool
+	quoted  bool
+	field   string
+}
+
+var fields = []string{"from", "before", "after", "has"}
+
+// operator reports whether the item is OR or AND rather than a word.
+func (it item) operator() bool {
+	return !it.negated && !it.quoted && it.field == "" && (it.text == "OR" || it.text == "AND")
+}
+
+// query returns the item as a query, or nil if it has no words.
+func (it item) query() (Query, error) {
+	var q Query
+	if it.field != "" {
+		filter, err := it.filter()
+		if err != nil {
+			return nil, err
+		}
+		q = filter
+	} else {
+		q = textQuery(it.text)
+		if q == nil {
+			if it.quoted {
+				return nil, &SyntaxError{it.offset, "the quoted phrase has no words"}
+			}
+			return nil, nil
+		}
+	}
+	if it.negated {
+		q = Not{q}
+	}
+	return q, nil
+}
+
+func (it item) filter() (Filter, error) {
+	value := strings.TrimSpace(it.text)
+	if value == "" {
+		return nil, &SyntaxError{it.offset, it.field + ": needs a value right after the colon, like " + example(it.field)}
+	}
+	switch it.field {
+	case "from":
+		return From(Fold(value)), nil
+	case "before", "after":
+		t, err := ParseTime(value)
+		if err != nil {
+			return nil, &SyntaxError{it.offset, it.field + ": needs a date like 2026-01-01 or an RFC 3339 time"}
+		}
+		if it.field == "before" {
+			return Before(t), nil
+		}
+		return After(t), nil
+	default:
+		switch has := Has(strings.ToLower(value)); has {
+		case HasReply, HasReaction:
+			return has, nil
+		}
+		return nil, &SyntaxError{it.offset, "has: can only be has:reply or has:reaction"}
+	}
+}
+
+func example(field string) string {
+	switch field {
+	case "from":
+		return "from:ann"
+	case "has":
+		return "has:reply"
+	default:
+		return field + ":2026-01-01"
+	}
+}
+
+// ParseTime reads an RFC 3339 time, or a date meaning midnight UTC, as
+// before: and after: take them.
+func ParseTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	return t.UTC(), err
+}
+
+// textQuery matches the words of text, or returns nil if it has none.
+func textQuery(text string) Query {
+	tokens := Tokenize(text)
+	switch len(tokens) {
+	case 0:
+		return nil
+	case 1:
+		return Term(tokens[0].Term)
+	}
+	p := make(Phrase, len(tokens))
+	for i, t := range tokens {
+		p[i] = t.Term
+	}
+	return p
+}
+
+// lex splits text into items at white space outside double quotes.
+func lex(text string) ([]item, error) {
+	var items []item
+	for i := 0; i < len(text); {
+		if r, size := utf8.DecodeRuneInString(text[i:]); unicode.IsSpace(r) {
+			i += size
+			continue
+		}
+
+		it := item{offset: i}
+		end := wordEnd(text, i)
+		if text[i] == '-' && i+1 < end {
+			it.negated = true
+			i++
+		}
+		if field, ok := fieldPrefix(text[i:end]); ok {
+			it.field = field
+			i += len(field) + 1
+		}
+		if i < len(text) && text[i] == '"' {
+			closing := strings.IndexByte(text[i+1:], '"')
+			if closing < 0 {
+				return nil, &SyntaxError{i, "the quote has no closing quote"}
+			}
+			it.text, it.quoted = text[i+1:i+1+closing], true
+			i += closing + 2
+		} else {
+			it.text = text[i:end]
+			i = end
+		}
+		items = append(items, it)
+	}
+	return items, nil
+}
+
+// wordEnd returns the offset of the first white space at or after start.
+func wordEnd(text string, start int) int {
+	if i := strings.IndexFunc(text[start:], unicode.IsSpace); i >= 0 {
+		return start + i
+	}
+	return len(text)
+}
+
+// fieldPrefix returns the operator that word starts with, if any. Other
+// words with colons, like 10:30, are searched for as text.
+func fieldPrefix(word string) (string, bool) {
+	name, _, ok := strings.Cut(word, ":")
+	if !ok {
+		return "", false
+	}
+	name = strings.ToLower(name)
+	return name, slices.Contains(fields, name)
+}
+
+// String returns a compact form of q, with parentheses showing how it was
+// grouped, for logs and tests.
+func String(q Query) string {
+	switch q := q.(type) {
+	case Term:
+		return string(q)
+	case Phrase:
+		return `"` + strings.Join(q, " ") + `"`
+	case And:
+		return "(" + join(q, " ") + ")"
+	case Or:
+		return "(" + join(q, " OR ") + ")"
+	case Not:
+		return "-" + String(q.Query)
+	case From:
+		return "from:" + string(q)
+	case Before:
+		return "before:" + time.Time(q).Format(time.RFC3339Nano)
+	case After:
+		return "after:" + time.Time(q).Format(time.RFC3339Nano)
+	case Has:
+		return "has:" + string(q)
+	default:
+		return fmt.Sprint(q)
+	}
+}
+
+func join(queries []Query, sep string) string {
+	parts := make([]string, len(queries))
+	for i, q := range queries {
+		parts[i] = String(q)
+	}
+	return strings.Join(parts, sep)
+}
@@ -0,0 +1,241 @@
+package search
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Testing words are split, case folded and stripped of accents
+func TestTokenize(t *testing.T) {
+	for _, tc := range []struct {
+		text string
+		want []string
+	}{
+		{"Hello, World!", []string{"hello", "world"}},
+		{"Café CAFÉ café", []string{"cafe", "cafe", "cafe"}},
+		{"Straße İstanbul ÅNGSTRÖM", []string{"strasse", "istanbul", "angstrom"}},
+		{"e-mail don't 3.14", []string{"e", "mail", "don", "t", "3", "14"}},
+		{"日本語 テキスト", []string{"日本語", "テキスト"}},
+		{"  ...  ", nil},
+	} {
+		var got []string
+		for _, token := range Tokenize(tc.text) {
+			got = append(got, token.Term)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+			t.Errorf("Tokenize(%q) = %q, expected %q", tc.text, got, tc.want)
+		}
+	}
+
+	t.Run("offsets point into the original text", func(t *testing.T) {
+		text := "Ünïcode café"
+		for _, token := range Tokenize(text) {
+			if Fold(text[token.Start:token.End]) != token.Term {
+				t.Errorf("Token %+v does not match %q", token, text[token.Start:token.End])
+			}
+		}
+	})
+}
+
+// Testing queries are parsed into trees, with errors that point at the mistake
+func TestParse(t *testing.T) {
+	for _, tc := range []struct{ query, want string }{
+		{"Hello", "hello"},
+		{"hello world", "(hello world)"},
+		{"tea OR coffee cake", "((tea OR coffee) cake)"},
+		{"tea OR coffee OR juice", "(tea OR coffee OR juice)"},
+		{"e-mail AND Café", `("e mail" cafe)`},
+		{"hello !!!", "hello"},
+		{`"Green  TEA" -milk -"oat milk"`, `("green tea" -milk -"oat milk")`},
+		{`tea From:Ann -from:"Bob Lee" has:REPLY`, "(tea from:ann -from:bob lee has:reply)"},
+		{"tea before:2026-01-01 after:2025-06-01T12:00:00+02:00", "(tea before:2026-01-01T00:00:00Z after:2025-06-01T10:00:00Z)"},
+		{"meet at 10:30 re:lunch", "(meet at \"10 30\" \"re lunch\")"},
+		{`"tea" OR "hot chocolate"`, `(tea OR "hot chocolate")`},
+	} {
+		q, err := Parse(tc.query)
+		if err != nil {
+			t.Errorf("Parse(%q) returned error: %v", tc.query, err)
+			continue
+		}
+		if got := String(q); got != tc.want {
+			t.Errorf("Parse(%q) = %s, expected %s", tc.query, got, tc.want)
+		}
+	}
+
+	for _, tc := range []struct {
+		query  string
+		offset int
+	}{
+		{"", 0},
+		{"  !!! ", 0},
+		{"OR tea", 0},
+		{"tea OR", 4},
+		{"tea OR OR coffee", 7},
+		{`tea "green`, 4},
+		{`tea ""`, 4},
+		{"tea from:", 4},
+		{"tea before:yesterday", 4},
+		{"tea has:cake", 4},
+		{"tea OR -milk", 7},
+		{"from:ann OR tea", 9},
+		{"-milk from:ann", 0},
+	} {
+		_, err := Parse(tc.query)
+		var syntaxErr *SyntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Errorf("Parse(%q) returned %v, expected a syntax error", tc.query, err)
+			continue
+		}
+		if syntaxErr.Offset != tc.offset {
+			t.Errorf("Parse(%q) reported %q at %d, expected %d", tc.query, syntaxErr.Msg, syntaxErr.Offset, tc.offset)
+		}
+	}
+}
+
+// Testing filters are checked against message fields
+func TestMatchFilters(t *testing.T) {
+	sent := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	fields := Fields{From: "Ánn ", TimeSent: sent, Replies: 2}
+	for query, want := range map[string]bool{
+		"tea":                                    true,
+		"tea from:ann":                           true,
+		"tea -from:ann":                          false,
+		"tea from:bob":                           false,
+		"tea before:2026-03-01T12:00:00Z":        false,
+		"tea after:2026-03-01T12:00:00Z":         true,
+		"tea after:2026-01-01 before:2026-04-01": true,
+		"tea has:reply":                          true,
+		"tea has:reaction":                       false,
+		"tea -has:reaction -milk":                true,
+	} {
+		q, err := Parse(query)
+		if err != nil {
+			t.Fatalf("Parse(%q) returned error: %v", query, err)
+		}
+		if got := MatchFilters(q, fields); got != want {
+			t.Errorf("MatchFilters(%q) = %v, expected %v", query, got, want)
+		}
+	}
+}
+
+// Testing lookups, ranking and updates of the index
+func TestIndex(t *testing.T) {
+	ix := NewIndex(compareIDs)
+	for _, d := range []Document{
+		{ID: "1", Room: "general", Text: "Tea is ready"},
+		{ID: "2", Room: "general", Text: "Coffee or tea? Tea, tea, tea!"},
+		{ID: "3", Room: "general", Text: "Coffee and cake in the kitchen, come and get it while it lasts"},
+		{ID: "4", Room: "random", Text: "tea"},
+	} {
+		ix.Add(d)
+	}
+	search := func(query string) string {
+		q, err := Parse(query)
+		if err != nil {
+			t.Fatalf("Parse(%q) returned error: %v", query, err)
+		}
+		var ids []string
+		for _, hit := range ix.Search("general", q) {
+			ids = append(ids, hit.ID)
+		}
+		return strings.Join(ids, ",")
+	}
+
+	t.Run("ranked by BM25", func(t *testing.T) {
+		if got := search("tea"); got != "2,1" {
+			t.Errorf("Expected the message repeating tea first, got %s", got)
+		}
+		if got := search("TÉA coffee"); got != "2" {
+			t.Errorf("Expected only the message with both words, got %s", got)
+		}
+		if got := search("cake OR ready"); got != "1,3" {
+			t.Errorf("Expected the shorter message first, got %s", got)
+		}
+		if got := search("missing"); got != "" {
+			t.Errorf("Expected no hits, got %s", got)
+		}
+	})
+
+	t.Run("phrases and exclusions", func(t *testing.T) {
+		if got := search(`"or tea"`); got != "2" {
+			t.Errorf("Expected only the message with the phrase, got %s", got)
+		}
+		if got := search(`"tea or"`); got != "" {
+			t.Errorf("Expected word order to matter, got %s", got)
+		}
+		if got := search("tea -coffee"); got != "1" {
+			t.Errorf("Expected the message with coffee to be excluded, got %s", got)
+		}
+		if got := search(`coffee OR tea -"come and get" -missing from:ann`); got != "2,1" {
+			t.Errorf("Expected the phrase to be excluded and filters ignored, got %s", got)
+		}
+	})
+
+	t.Run("updates and removals", func(t *testing.T) {
+		ix.Add(Document{ID: "1", Room: "general", Text: "Coffee is ready"})
+		if got := search("tea"); got != "2" {
+			t.Errorf("Expected the edited message to drop out, got %s", got)
+		}
+		if got := search("coffee ready"); got != "1" {
+			t.Errorf("Expected the edited message to match, got %s", got)
+		}
+		ix.Remove("2")
+		ix.Remove("2")
+		if got := search("tea OR coffee"); got != "1,3" {
+			t.Errorf("Expected the removed message to drop out, got %s", got)
+		}
+		ix.RemoveRoom("general")
+		if ix.Len() != 1 || search("coffee") != "" {
+			t.Errorf("Expected only the random room to remain, got %d documents", ix.Len())
+		}
+	})
+
+	t.Run("ties stay in ID order after edits", func(t *testing.T) {
+		ix.Add(Document{ID: "5", Room: "general", Text: "Lunch at noon"})
+		ix.Add(Document{ID: "6", Room: "general", Text: "Lunch at one"})
+		ix.Add(Document{ID: "5", Room: "general", Text: "Lunch at two"})
+		if got := search("lunch"); got != "6,5" {
+			t.Errorf("Expected the newer message first, got %s", got)
+		}
+	})
+
+	t.Run("compaction keeps lookups intact", func(t *testing.T) {
+		ix := NewIndex(compareIDs)
+		for i := range 3000 {
+			ix.Add(Document{ID: fmt.Sprint(i), Room: "general", Text: fmt.Sprintf("word%d common", i%10)})
+		}
+		for i := range 2500 {
+			ix.Remove(fmt.Sprint(i))
+		}
+		q, _ := Parse("word7 common")
+		if hits := ix.Search("general", q); len(hits) != 50 || len(ix.docs) >= 3000 {
+			t.Errorf("Expected 50 hits after compacting, got %d with %d slots", len(hits), len(ix.docs))
+		}
+	})
+}
+
+// Testing matches are marked and the rest escaped
+func TestHighlight(t *testing.T) {
+	q, _ := Parse("cafe OR tea")
+	got := Highlight("<b>Café</b> & TEA, teapot", q)
+	want := "&lt;b&gt;<mark>Café</mark>&lt;/b&gt; &amp; <mark>TEA</mark>, teapot"
+	if got != want {
+		t.Errorf("Highlight returned %q, expected %q", got, want)
+	}
+
+	q, _ = Parse(`"green tea" green -milk`)
+	got = Highlight("Green tea, no milk, green TEA!", q)
+	want = "<mark>Green tea</mark>, no milk, <mark>green TEA</mark>!"
+	if got != want {
+		t.Errorf("Highlight returned %q, expected %q", got, want)
+	}
+}
+
+// compareIDs orders the numeric IDs used in these tests.
+func compareIDs(a, b string) int {
+	return cmp.Or(cmp.Compare(len(a), len(b)), strings.Compare(a, b))
+}
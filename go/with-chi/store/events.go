@@ -0,0 +1,319 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type EventType string
+
+const (
+	MessageCreated  EventType = "message.created"
+	MessageUpdated  EventType = "message.updated"
+	MessageDeleted  EventType = "message.deleted"
+	MessageRestored EventType = "message.restored"
+)
+
+// ErrInvalidEventID is returned by ParseEventID for IDs not made by
+// EventID.
+var ErrInvalidEventID = errors.New("invalid event ID")
+
+// Event records one successful change to the store. Seq increases by one
+// per event for the lifetime of the Broker, and starts again from 1 with a
+// new Broker after a restart.
+type Event struct {
+	Seq     uint64    `json:"seq"`
+	Type    EventType `json:"type"`
+	Message Message   `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+// Broker fans store events out to subscribers and keeps the most recent
+// ones so that clients can catch up after a reconnect. Catching up is best
+// effort: history is bounded and in memory, so a client that was away for
+// longer is told by Since to reload instead. The IDs clients resume from
+// carry an epoch that is new for every Broker, so that an ID from before a
+// restart is not taken for one of the new sequence numbers.
+type Broker struct {
+	epoch   string
+	mu      sync.Mutex
+	seq     uint64
+	history []Event
+	limit   int
+	subs    map[*Subscription]struct{}
+	closed  bool
+}
+
+// Subscription receives events published after it was created. Its
+// channel is closed when the subscriber falls too far behind, when
+// Unsubscribe is called or when the Broker is closed.
+type Subscription struct {
+	C      <-chan Event
+	ch     chan Event
+	broker *Broker
+}
+
+// NewBroker keeps up to historySize past events for Since.
+func NewBroker(historySize int) *Broker {
+	return &Broker{
+		epoch: newEpoch(),
+		limit: historySize,
+		subs:  map[*Subscription]struct{}{},
+	}
+}
+
+// Publish records an event and delivers it to every subscriber without
+// blocking. Subscribers whose buffer is full are dropped; they can resume
+// with Since.
+func (b *Broker) Publish(eventType EventType, m Message) Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+	event := Event{Seq: b.seq, Type: eventType, Message: m, Time: time.Now().UTC()}
+
+	if b.limit > 0 {
+		if len(b.history) == b.limit {
+			b.history = append(b.history[:0], b.history[1:]...)
+		}
+		b.history = append(b.history, event)
+	}
+
+	for sub := range b.subs {
+		select {
+		case sub.ch <- event:
+		default:
+			b.drop(sub)
+		}
+	}
+	return event
+}
+
+// newEpoch returns a random epoch, short enough to keep event IDs short.
+func newEpoch() string {
+	raw := make([]byte, 6)
+	rand.Read(raw)
+	return hex.EncodeToString(raw)
+}
+
+// Subscribe returns a subscription buffering up to buffer events. On a
+// closed Broker the subscription's channel is already closed.
+func (b *Broker) Subscribe(buffer int) *Subscription {
+	ch := make(chan Event, buffer)
+	sub := &Subscription{C: ch, ch: ch, broker: b}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		close(ch)
+		return sub
+	}
+	b.subs[sub] = struct{}{}
+	return sub
+}
+
+// Unsubscribe stops delivery and closes the subscription's channel.
+func (s *Subscription) Unsubscribe() {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	s.broker.drop(s)
+}
+
+// Since returns the retained events with Seq greater than seq. ok is false
+// when events after seq have already been discarded, or seq is from the
+// future, so the caller cannot resume without a gap.
+func (b *Broker) Since(seq uint64) (events []Event, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if seq > b.seq {
+		return nil, false
+	}
+	if seq == b.seq {
+		return nil, true
+	}
+	if len(b.history) == 0 || b.history[0].Seq > seq+1 {
+		return nil, false
+	}
+	start := int(seq + 1 - b.history[0].Seq)
+	return append([]Event(nil), b.history[start:]...), true
+}
+
+// EventID returns the ID that clients resume from after the event with
+// sequence number seq: the Broker's epoch and seq, joined by a dash.
+func (b *Broker) EventID(seq uint64) string {
+	return b.epoch + "-" + strconv.FormatUint(seq, 10)
+}
+
+// ParseEventID reads an ID made by EventID. current is false for the IDs
+// of another Broker, such as one from before a restart, whose sequence
+// numbers mean nothing to Since.
+func (b *Broker) ParseEventID(id string) (seq uint64, current bool, err error) {
+	epoch, n, found := strings.Cut(id, "-")
+	if !found || epoch == "" {
+		return 0, false, ErrInvalidEventID
+	}
+	seq, err = strconv.ParseUint(n, 10, 64)
+	if err != nil {
+		return 0, false, ErrInvalidEventID
+	}
+	return seq, epoch == b.epoch, nil
+}
+
+// LastSeq returns the sequence number of the latest event.
+func (b *Broker) LastSeq() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.seq
+}
+
+// Close ends every subscription; later subscriptions are closed at once.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for sub := range b.subs {
+		b.drop(sub)
+	}
+}
+
+// Closed reports whether Close has been called.
+func (b *Broker) Closed() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.closed
+}
+
+func (b *Broker) drop(sub *Subscription) {
+	if _, ok := b.subs[sub]; ok {
+		delete(b.subs, sub)
+		close(sub.ch)
+	}
+}
+
+// NotifyingStore wraps a MessageStore and publishes an event to a Broker
+// after every successful create, update, delete and restore. Reactions are
+// published as updates carrying the new counts. Writes to one message are
+// serialised with their events, so each message's events come in the order
+// its changes were made, while writes to different messages run in
+// parallel; every write must go through the NotifyingStore for that to
+// hold.
+type NotifyingStore struct {
+	MessageStore
+	Broker *Broker
+	locks  messageLocks
+}
+
+func NewNotifyingStore(s MessageStore, broker *Broker) *NotifyingStore {
+	return &NotifyingStore{MessageStore: s, Broker: broker}
+}
+
+func (s *NotifyingStore) Create(ctx context.Context, req CreateMessageRequest) (Message, error) {
+	m, err := s.MessageStore.Create(ctx, req)
+	if err == nil {
+		s.Broker.Publish(MessageCreated, m)
+	}
+	return m, err
+}
+
+func (s *NotifyingStore) Update(ctx context.Context, id string, req CreateMessageRequest) (Message, error) {
+	defer s.locks.lock(id)()
+
+	m, err := s.MessageStore.Update(ctx, id, req)
+	if err == nil {
+		s.Broker.Publish(MessageUpdated, m)
+	}
+	return m, err
+}
+
+func (s *NotifyingStore) Delete(ctx context.Context, id string, version int) error {
+	defer s.locks.lock(id)()
+
+	// Best effort: include the message's last state in the event.
+	m, err := s.MessageStore.Get(ctx, id)
+	if err != nil {
+		m = Message{ID: id}
+	}
+	if err := s.MessageStore.Delete(ctx, id, version); err != nil {
+		return err
+	}
+	s.Broker.Publish(MessageDeleted, m)
+	return nil
+}
+
+func (s *NotifyingStore) React(ctx context.Context, id, emoji, user string) (Message, bool, error) {
+	defer s.locks.lock(id)()
+
+	m, added, err := s.MessageStore.React(ctx, id, emoji, user)
+	if err == nil && added {
+		s.Broker.Publish(MessageUpdated, m)
+	}
+	return m, added, err
+}
+
+func (s *NotifyingStore) Unreact(ctx context.Context, id, emoji, user string) error {
+	defer s.locks.lock(id)()
+
+	if err := s.MessageStore.Unreact(ctx, id, emoji, user); err != nil {
+		return err
+	}
+	if m, err := s.MessageStore.Get(ctx, id); err == nil {
+		s.Broker.Publish(MessageUpdated, m)
+	}
+	return nil
+}
+
+func (s *NotifyingStore) Restore(ctx context.Context, id string) (Message, bool, error) {
+	defer s.locks.lock(id)()
+
+	m, restored, err := s.MessageStore.Restore(ctx, id)
+	if err == nil && restored {
+		s.Broker.Publish(MessageRestored, m)
+	}
+	return m, restored, err
+}
+
+// messageLocks hands out a lock per message ID, kept only while someone
+// holds or waits for it.
+type messageLocks struct {
+	mu    sync.Mutex
+	locks map[string]*messageLock
+}
+
+type messageLock struct {
+	sync.Mutex
+	users int
+}
+
+// lock locks the message id and returns the function that unlocks it.
+func (l *messageLocks) lock(id string) (unlock func()) {
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = map[string]*messageLock{}
+	}
+	ml := l.locks[id]
+	if ml == nil {
+		ml = &messageLock{}
+		l.locks[id] = ml
+	}
+	ml.users++
+	l.mu.Unlock()
+
+	ml.Lock()
+	return func() {
+		ml.Unlock()
+		l.mu.Lock()
+		if ml.users--; ml.users == 0 {
+			delete(l.locks, id)
+		}
+		l.mu.Unlock()
+	}
+}
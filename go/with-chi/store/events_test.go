@@ -0,0 +1,173 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// Testing events reach subscribers and can be replayed from history
+func TestBroker(t *testing.T) {
+	b := NewBroker(3)
+	sub := b.Subscribe(10)
+
+	for i := 0; i < 5; i++ {
+		b.Publish(MessageCreated, Message{ID: string(rune('a' + i))})
+	}
+
+	for want := uint64(1); want <= 5; want++ {
+		if event := <-sub.C; event.Seq != want {
+			t.Errorf("Expected seq %d, got %d", want, event.Seq)
+		}
+	}
+
+	t.Run("Since returns retained events", func(t *testing.T) {
+		events, ok := b.Since(3)
+		if !ok || len(events) != 2 || events[0].Seq != 4 {
+			t.Errorf("Expected events 4 and 5, got %v (ok=%v)", events, ok)
+		}
+		if events, ok := b.Since(5); !ok || len(events) != 0 {
+			t.Errorf("Expected no events and ok, got %v (ok=%v)", events, ok)
+		}
+	})
+
+	t.Run("Since reports gaps", func(t *testing.T) {
+		if _, ok := b.Since(1); ok {
+			t.Errorf("Expected a gap: events 2 was discarded")
+		}
+		if _, ok := b.Since(99); ok {
+			t.Errorf("Expected a gap for a sequence number from the future")
+		}
+	})
+
+	t.Run("Event IDs carry the epoch", func(t *testing.T) {
+		if seq, current, err := b.ParseEventID(b.EventID(4)); seq != 4 || !current || err != nil {
+			t.Errorf("Expected seq 4 from the current epoch, got %d, %v, %v", seq, current, err)
+		}
+		if seq, current, err := b.ParseEventID(NewBroker(3).EventID(4)); seq != 4 || current || err != nil {
+			t.Errorf("Expected seq 4 from another epoch, got %d, %v, %v", seq, current, err)
+		}
+		for _, id := range []string{"4", "-4", b.EventID(4) + "x"} {
+			if _, _, err := b.ParseEventID(id); err != ErrInvalidEventID {
+				t.Errorf("ParseEventID(%q): expected ErrInvalidEventID, got %v", id, err)
+			}
+		}
+	})
+
+	t.Run("Slow subscribers are dropped", func(t *testing.T) {
+		slow := b.Subscribe(1)
+		b.Publish(MessageCreated, Message{})
+		b.Publish(MessageCreated, Message{})
+
+		<-slow.C
+		if _, open := <-slow.C; open {
+			t.Errorf("Expected the slow subscription to be closed")
+		}
+	})
+
+	t.Run("Close ends subscriptions", func(t *testing.T) {
+		b.Close()
+		for range sub.C {
+		}
+		if _, open := <-b.Subscribe(1).C; open {
+			t.Errorf("Expected subscriptions on a closed broker to be closed")
+		}
+	})
+}
+
+// Testing NotifyingStore publishes only successful changes
+func TestNotifyingStore(t *testing.T) {
+	ctx := context.Background()
+	b := NewBroker(10)
+	s := NewNotifyingStore(NewMemoryStore(), b)
+	sub := b.Subscribe(10)
+
+	m, _ := s.Create(ctx, CreateMessageRequest{From: "Bart", Text: "Hi"})
+	s.Update(ctx, m.ID, CreateMessageRequest{From: "Bart", Text: "Hello"})
+	s.React(ctx, m.ID, "👍", "Lisa")
+	s.React(ctx, m.ID, "👍", "Lisa")
+	s.Unreact(ctx, m.ID, "👍", "Lisa")
+	s.Unreact(ctx, m.ID, "👍", "Lisa")
+	s.Delete(ctx, m.ID, 0)
+	s.Delete(ctx, "missing", 0)
+	s.Restore(ctx, m.ID)
+	s.Restore(ctx, m.ID)
+
+	for _, want := range []EventType{MessageCreated, MessageUpdated, MessageUpdated, MessageUpdated, MessageDeleted, MessageRestored} {
+		event := <-sub.C
+		if event.Type != want || event.Message.ID != m.ID {
+			t.Errorf("Expected %s for %s, got %+v", want, m.ID, event)
+		}
+	}
+	if last := b.LastSeq(); last != 6 {
+		t.Errorf("Expected 6 events, got %d", last)
+	}
+}
+
+// Testing events from concurrent writers come in the order of the changes
+func TestNotifyingStoreOrder(t *testing.T) {
+	ctx := context.Background()
+	b := NewBroker(0)
+	s := NewNotifyingStore(NewMemoryStore(), b)
+	m, _ := s.Create(ctx, CreateMessageRequest{From: "Bart", Text: "Hi"})
+
+	const writers = 50
+	sub := b.Subscribe(writers)
+	var wg sync.WaitGroup
+	for i := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.Update(ctx, m.ID, CreateMessageRequest{From: "Bart", Text: fmt.Sprint("Edit ", i)})
+		}()
+	}
+	wg.Wait()
+
+	for i := range writers {
+		if event := <-sub.C; event.Message.Version != m.Version+i+1 {
+			t.Fatalf("Expected version %d in event %d, got %d", m.Version+i+1, event.Seq, event.Message.Version)
+		}
+	}
+}
+
+// blockingStore holds up updates of one message, signalling entered,
+// until release is closed.
+type blockingStore struct {
+	MessageStore
+	blocked          string
+	entered, release chan struct{}
+}
+
+func (s *blockingStore) Update(ctx context.Context, id string, req CreateMessageRequest) (Message, error) {
+	if id == s.blocked {
+		close(s.entered)
+		<-s.release
+	}
+	return s.MessageStore.Update(ctx, id, req)
+}
+
+// Testing a slow write to one message does not hold up the others
+func TestNotifyingStoreParallel(t *testing.T) {
+	ctx := context.Background()
+	inner := &blockingStore{MessageStore: NewMemoryStore(), entered: make(chan struct{}), release: make(chan struct{})}
+	s := NewNotifyingStore(inner, NewBroker(0))
+	slow, _ := s.Create(ctx, CreateMessageRequest{From: "Bart", Text: "Hi"})
+	fast, _ := s.Create(ctx, CreateMessageRequest{From: "Lisa", Text: "Hi"})
+	inner.blocked = slow.ID
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Update(ctx, slow.ID, CreateMessageRequest{From: "Bart", Text: "Hello"})
+	}()
+	<-inner.entered
+	if _, err := s.Update(ctx, fast.ID, CreateMessageRequest{From: "Lisa", Text: "Hello"}); err != nil {
+		t.Errorf("Update returned error: %v", err)
+	}
+	close(inner.release)
+	<-done
+	if len(s.locks.locks) != 0 {
+		t.Errorf("Expected no locks left, got %d", len(s.locks.locks))
+	}
+}
@@ -0,0 +1,520 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	snapshotFile = "snapshot.json"
+	journalFile  = "journal.jsonl"
+)
+
+// FileStore is a MessageStore that survives restarts. Messages are served
+// from an in-memory copy; every mutation is appended to a JSON-lines journal
+// which is replayed on open and periodically folded into a snapshot.
+type FileStore struct {
+	// mu serialises journal appends with the in-memory mutation they
+	// record; reads only need the MemoryStore's own lock.
+	mu      sync.Mutex
+	mem     *MemoryStore
+	dir     string
+	journal *os.File
+	// created is notified once a new message is journaled, not when the
+	// MemoryStore first holds it.
+	created signal
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+type FileStoreOptions struct {
+	// IDs generates message IDs; nil means a CounterIDs.
+	IDs IDGenerator
+	// CompactInterval controls how often the journal is folded into the
+	// snapshot. Zero disables background compaction; Close always compacts.
+	CompactInterval time.Duration
+}
+
+type journalEntry struct {
+	Op       string    `json:"op"`
+	Message  *Message  `json:"message,omitempty"`
+	Room     *Room     `json:"room,omitempty"`
+	Reaction *Reaction `json:"reaction,omitempty"`
+	// Revision accompanies the put of an edited message.
+	Revision *Revision `json:"revision,omitempty"`
+	ID       string    `json:"id,omitempty"`
+}
+
+type snapshot struct {
+	Rooms     []Room     `json:"rooms,omitempty"`
+	Messages  []Message  `json:"messages"`
+	Reactions []Reaction `json:"reactions,omitempty"`
+	Revisions []Revision `json:"revisions,omitempty"`
+	// LastID is the last ID handed out, which may belong to a message that
+	// has since been deleted.
+	LastID string `json:"last_id,omitempty"`
+}
+
+const (
+	opPut        = "put"
+	opDelete     = "delete"
+	opPutRoom    = "put_room"
+	opDeleteRoom = "delete_room"
+	opReact      = "react"
+	opUnreact    = "unreact"
+)
+
+// OpenFileStore loads the snapshot and journal in dir, creating the
+// directory if needed.
+func OpenFileStore(dir string, opts FileStoreOptions) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	ids := opts.IDs
+	if ids == nil {
+		ids = NewCounterIDs()
+	}
+
+	s := &FileStore{
+		mem: NewMemoryStoreWithIDs(ids),
+		dir: dir,
+	}
+
+	if err := s.loadSnapshot(); err != nil {
+		return nil, err
+	}
+	validSize, err := s.replayJournal()
+	if err != nil {
+		return nil, err
+	}
+
+	journal, err := os.OpenFile(s.path(journalFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	// Drop any torn tail so new entries start on a fresh line.
+	if err := journal.Truncate(validSize); err != nil {
+		journal.Close()
+		return nil, err
+	}
+	s.journal = journal
+
+	if opts.CompactInterval > 0 {
+		s.stop = make(chan struct{})
+		s.done = make(chan struct{})
+		go s.compactLoop(opts.CompactInterval)
+	}
+
+	return s, nil
+}
+
+func (s *FileStore) Create(ctx context.Context, req CreateMessageRequest) (Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	newMessage, err := s.mem.Create(ctx, req)
+	if err != nil {
+		return Message{}, err
+	}
+	if err := s.append(journalEntry{Op: opPut, Message: &newMessage}); err != nil {
+		s.mem.remove(newMessage.ID)
+		return Message{}, err
+	}
+	s.created.notify()
+	return newMessage, nil
+}
+
+func (s *FileStore) Get(ctx context.Context, id string) (Message, error) {
+	return s.mem.Get(ctx, id)
+}
+
+func (s *FileStore) List(ctx context.Context, roomID string) ([]Message, error) {
+	return s.mem.List(ctx, roomID)
+}
+
+func (s *FileStore) ListPage(ctx context.Context, roomID string, q PageQuery) (Page, error) {
+	return s.mem.ListPage(ctx, roomID, q)
+}
+
+func (s *FileStore) Update(ctx context.Context, id string, req CreateMessageRequest) (Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, err := s.mem.Get(ctx, id)
+	if err != nil {
+		return Message{}, err
+	}
+	updatedMessage, revision, err := s.mem.update(id, req)
+	if err != nil {
+		return Message{}, err
+	}
+	if revision == nil {
+		return updatedMessage, nil
+	}
+	if err := s.append(journalEntry{Op: opPut, Message: &updatedMessage, Revision: revision}); err != nil {
+		s.mem.put(previous)
+		s.mem.removeRevision(*revision)
+		return Message{}, err
+	}
+	return updatedMessage, nil
+}
+
+func (s *FileStore) Delete(_ context.Context, id string, version int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, ok := s.mem.stored(id)
+	if !ok || m.DeletedAt != nil {
+		return ErrNotFound
+	}
+	if err := checkVersion(m, version); err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	m.DeletedAt = &now
+	m.Version++
+	if err := s.append(journalEntry{Op: opPut, Message: &m}); err != nil {
+		return err
+	}
+	s.mem.put(m)
+	return nil
+}
+
+func (s *FileStore) Restore(ctx context.Context, id string) (Message, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, ok := s.mem.stored(id)
+	if !ok {
+		return Message{}, false, ErrNotFound
+	}
+	deleted := m.DeletedAt != nil
+	if deleted {
+		m.DeletedAt = nil
+		m.Version++
+		if err := s.append(journalEntry{Op: opPut, Message: &m}); err != nil {
+			return Message{}, false, err
+		}
+		s.mem.put(m)
+	}
+	restored, err := s.mem.Get(ctx, id)
+	return restored, deleted, err
+}
+
+// Purge journals a delete for each tombstone before removing it, so an
+// append failure leaves the rest for the next run.
+func (s *FileStore) Purge(_ context.Context, cutoff time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.mem.mu.RLock()
+	ids := s.mem.purgeableLocked(cutoff)
+	s.mem.mu.RUnlock()
+
+	for i, id := range ids {
+		if err := s.append(journalEntry{Op: opDelete, ID: id}); err != nil {
+			return i, err
+		}
+		s.mem.remove(id)
+	}
+	return len(ids), nil
+}
+
+func (s *FileStore) Search(ctx context.Context, roomID string, q SearchQuery) (SearchPage, error) {
+	return s.mem.Search(ctx, roomID, q)
+}
+
+func (s *FileStore) Replies(ctx context.Context, id string, q PageQuery) (Page, error) {
+	return s.mem.Replies(ctx, id, q)
+}
+
+func (s *FileStore) Revisions(ctx context.Context, id string) ([]Revision, error) {
+	return s.mem.Revisions(ctx, id)
+}
+
+func (s *FileStore) React(ctx context.Context, id, emoji, user string) (Message, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, added, err := s.mem.React(ctx, id, emoji, user)
+	if err != nil || !added {
+		return m, added, err
+	}
+	reaction := Reaction{MessageID: id, Emoji: emoji, User: user}
+	if err := s.append(journalEntry{Op: opReact, Reaction: &reaction}); err != nil {
+		s.mem.removeReaction(reaction)
+		return Message{}, false, err
+	}
+	return m, true, nil
+}
+
+func (s *FileStore) Unreact(ctx context.Context, id, emoji, user string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.mem.Unreact(ctx, id, emoji, user); err != nil {
+		return err
+	}
+	reaction := Reaction{MessageID: id, Emoji: emoji, User: user}
+	if err := s.append(journalEntry{Op: opUnreact, Reaction: &reaction}); err != nil {
+		s.mem.putReaction(reaction)
+		return err
+	}
+	return nil
+}
+
+func (s *FileStore) Created() <-chan struct{} {
+	return s.created.wait()
+}
+
+func (s *FileStore) CreateRoom(ctx context.Context, req CreateRoomRequest) (Room, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	room, err := s.mem.CreateRoom(ctx, req)
+	if err != nil {
+		return Room{}, err
+	}
+	if err := s.append(journalEntry{Op: opPutRoom, Room: &room}); err != nil {
+		s.mem.removeRoom(room.ID)
+		return Room{}, err
+	}
+	return room, nil
+}
+
+func (s *FileStore) GetRoom(ctx context.Context, id string) (Room, error) {
+	return s.mem.GetRoom(ctx, id)
+}
+
+func (s *FileStore) ListRooms(ctx context.Context) ([]Room, error) {
+	return s.mem.ListRooms(ctx)
+}
+
+func (s *FileStore) UpdateRoom(ctx context.Context, id string, req CreateRoomRequest) (Room, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, err := s.mem.GetRoom(ctx, id)
+	if err != nil {
+		return Room{}, err
+	}
+	updatedRoom, err := s.mem.UpdateRoom(ctx, id, req)
+	if err != nil {
+		return Room{}, err
+	}
+	if err := s.append(journalEntry{Op: opPutRoom, Room: &updatedRoom}); err != nil {
+		s.mem.putRoom(previous)
+		return Room{}, err
+	}
+	return updatedRoom, nil
+}
+
+func (s *FileStore) DeleteRoom(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if id == DefaultRoomID {
+		return ErrDefaultRoom
+	}
+	if _, err := s.mem.GetRoom(ctx, id); err != nil {
+		return err
+	}
+	if err := s.append(journalEntry{Op: opDeleteRoom, ID: id}); err != nil {
+		return err
+	}
+	s.mem.removeRoom(id)
+	return nil
+}
+
+// Compact writes the current state to the snapshot and truncates the
+// journal. A crash between the two steps is harmless because replaying
+// journal entries on top of a newer snapshot is idempotent.
+func (s *FileStore) Compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.compact()
+}
+
+// Close stops background compaction, compacts one last time and closes
+// the journal.
+func (s *FileStore) Close() error {
+	if s.stop != nil {
+		close(s.stop)
+		<-s.done
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.compact()
+	return errors.Join(err, s.journal.Close())
+}
+
+func (s *FileStore) compactLoop(interval time.Duration) {
+	defer close(s.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			if err := s.Compact(); err != nil {
+				log.Printf("store: compaction failed: %v", err)
+			}
+		}
+	}
+}
+
+func (s *FileStore) compact() error {
+	data, err := json.Marshal(s.mem.snapshot())
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(s.path(snapshotFile), data); err != nil {
+		return err
+	}
+	if err := s.journal.Truncate(0); err != nil {
+		return err
+	}
+	return s.journal.Sync()
+}
+
+func (s *FileStore) append(entry journalEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if _, err := s.journal.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return s.journal.Sync()
+}
+
+func (s *FileStore) loadSnapshot() error {
+	data, err := os.ReadFile(s.path(snapshotFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return fmt.Errorf("store: reading %s: %w", snapshotFile, err)
+	}
+	s.mem.load(snap)
+	return nil
+}
+
+// replayJournal applies every journal entry and returns the size of the
+// valid prefix of the file.
+func (s *FileStore) replayJournal() (int64, error) {
+	f, err := os.Open(s.path(journalFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var offset int64
+	reader := bufio.NewReader(f)
+	for lineNo := 1; ; lineNo++ {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// An unterminated final line means we crashed mid-append; the
+			// write was never acknowledged so it is safe to drop.
+			return offset, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		if trimmed := bytes.TrimSpace(line); len(trimmed) > 0 {
+			var entry journalEntry
+			if err := json.Unmarshal(trimmed, &entry); err != nil {
+				return 0, fmt.Errorf("store: %s line %d: %w", journalFile, lineNo, err)
+			}
+			if err := s.apply(entry); err != nil {
+				return 0, fmt.Errorf("store: %s line %d: %w", journalFile, lineNo, err)
+			}
+		}
+		offset += int64(len(line))
+	}
+}
+
+func (s *FileStore) apply(entry journalEntry) error {
+	switch entry.Op {
+	case opPut:
+		if entry.Message == nil {
+			return errors.New("put entry without message")
+		}
+		s.mem.put(*entry.Message)
+		if entry.Revision != nil {
+			s.mem.putRevision(*entry.Revision)
+		}
+	case opDelete:
+		s.mem.remove(entry.ID)
+	case opPutRoom:
+		if entry.Room == nil {
+			return errors.New("put_room entry without room")
+		}
+		s.mem.putRoom(*entry.Room)
+	case opDeleteRoom:
+		s.mem.removeRoom(entry.ID)
+	case opReact, opUnreact:
+		if entry.Reaction == nil {
+			return fmt.Errorf("%s entry without reaction", entry.Op)
+		}
+		if entry.Op == opReact {
+			s.mem.putReaction(*entry.Reaction)
+		} else {
+			s.mem.removeReaction(*entry.Reaction)
+		}
+	default:
+		return fmt.Errorf("unknown op %q", entry.Op)
+	}
+	return nil
+}
+
+func (s *FileStore) path(name string) string {
+	return filepath.Join(s.dir, name)
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,291 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"node-week-02-with-chi/search"
+)
+
+func openTestFileStore(t *testing.T, dir string) *FileStore {
+	t.Helper()
+	s, err := OpenFileStore(dir, FileStoreOptions{})
+	if err != nil {
+		t.Fatalf("OpenFileStore returned error: %v", err)
+	}
+	return s
+}
+
+// Testing that FileStore survives a restart
+func TestFileStoreReplay(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s := openTestFileStore(t, dir)
+	first, _ := s.Create(ctx, CreateMessageRequest{From: "Bart", Text: "Welcome"})
+	second, _ := s.Create(ctx, CreateMessageRequest{From: "Lisa", Text: "Hello"})
+	s.Update(ctx, first.ID, CreateMessageRequest{From: "Marge", Text: "Edited"})
+	s.Delete(ctx, second.ID, 0)
+
+	// Simulate a crash: drop the store without Close so nothing is compacted.
+	s.journal.Close()
+
+	reopened := openTestFileStore(t, dir)
+	defer reopened.Close()
+
+	all, _ := reopened.List(ctx, DefaultRoomID)
+	if len(all) != 1 {
+		t.Fatalf("Expected 1 message after replay, got %v", len(all))
+	}
+	if all[0].From != "Marge" || all[0].Text != "Edited" {
+		t.Errorf("Replayed message is incorrect: %+v", all[0])
+	}
+	if _, err := reopened.Get(ctx, second.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Deleted message came back after replay: %v", err)
+	}
+}
+
+// Testing that Compact folds the journal into the snapshot
+func TestFileStoreCompact(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s := openTestFileStore(t, dir)
+	s.Create(ctx, CreateMessageRequest{From: "Bart", Text: "Welcome"})
+	s.Create(ctx, CreateMessageRequest{From: "Lisa", Text: "Hello"})
+
+	if err := s.Compact(); err != nil {
+		t.Fatalf("Compact returned error: %v", err)
+	}
+
+	info, err := os.Stat(filepath.Join(dir, journalFile))
+	if err != nil {
+		t.Fatalf("Stat journal: %v", err)
+	}
+	if info.Size() != 0 {
+		t.Errorf("Expected empty journal after compaction, got %d bytes", info.Size())
+	}
+
+	s.Create(ctx, CreateMessageRequest{From: "Homer", Text: "After compaction"})
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+
+	reopened := openTestFileStore(t, dir)
+	defer reopened.Close()
+
+	all, _ := reopened.List(ctx, DefaultRoomID)
+	if len(all) != 3 {
+		t.Errorf("Expected 3 messages after reopen, got %v", len(all))
+	}
+}
+
+// Testing that a half-written final journal line is ignored
+func TestFileStoreTornJournal(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s := openTestFileStore(t, dir)
+	s.Create(ctx, CreateMessageRequest{From: "Bart", Text: "Welcome"})
+	s.journal.WriteString(`{"op":"put","message":{"id":"1","fr`)
+	s.journal.Close()
+
+	reopened := openTestFileStore(t, dir)
+	all, _ := reopened.List(ctx, DefaultRoomID)
+	if len(all) != 1 {
+		t.Errorf("Expected 1 message, got %v", len(all))
+	}
+
+	// Appends after the torn line must still replay cleanly.
+	reopened.Create(ctx, CreateMessageRequest{From: "Lisa", Text: "Hello"})
+	reopened.journal.Close()
+
+	again := openTestFileStore(t, dir)
+	defer again.Close()
+
+	all, _ = again.List(ctx, DefaultRoomID)
+	if len(all) != 2 {
+		t.Errorf("Expected 2 messages, got %v", len(all))
+	}
+}
+
+// Testing that a deleted message's ID is not reissued after compaction
+func TestFileStoreIDsSurviveCompaction(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s := openTestFileStore(t, dir)
+	s.Create(ctx, CreateMessageRequest{From: "Bart", Text: "Welcome"})
+	last, _ := s.Create(ctx, CreateMessageRequest{From: "Lisa", Text: "Hello"})
+	s.Delete(ctx, last.ID, 0)
+	s.Close()
+
+	reopened := openTestFileStore(t, dir)
+	defer reopened.Close()
+
+	next, _ := reopened.Create(ctx, CreateMessageRequest{From: "Homer", Text: "Doh"})
+	if next.ID == last.ID {
+		t.Errorf("Deleted ID %q was reused after compaction", last.ID)
+	}
+}
+
+func TestFileStoreListPage(t *testing.T) {
+	s := openTestFileStore(t, t.TempDir())
+	defer s.Close()
+	testListPage(t, s)
+}
+
+func TestFileStoreCreated(t *testing.T) {
+	s := openTestFileStore(t, t.TempDir())
+	defer s.Close()
+	testCreated(t, s)
+}
+
+func TestFileStoreRooms(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestFileStore(t, dir)
+	testRooms(t, s)
+	s.Close()
+
+	// Rooms and their messages survive a restart.
+	reopened := openTestFileStore(t, dir)
+	defer reopened.Close()
+	rooms, _ := reopened.ListRooms(context.Background())
+	if len(rooms) != 2 || rooms[1].Name != "Second" {
+		t.Errorf("Expected general and Second after reopening, got %+v", rooms)
+	}
+}
+
+func TestFileStoreReplies(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestFileStore(t, dir)
+	testReplies(t, s)
+	s.Close()
+
+	// Threads, counts and tombstones survive a restart.
+	reopened := openTestFileStore(t, dir)
+	defer reopened.Close()
+	all, _ := reopened.List(context.Background(), DefaultRoomID)
+	if len(all) != 2 || all[0].ParentID == "" || all[1].ParentID != all[0].ParentID {
+		t.Errorf("Expected the 2 replies after reopening, got %+v", all)
+	}
+	parent, _ := reopened.Get(context.Background(), all[0].ParentID)
+	if parent.DeletedAt == nil || parent.ReplyCount != 2 {
+		t.Errorf("Expected the tombstone with 2 replies after reopening, got %+v", parent)
+	}
+}
+
+func TestFileStoreReactions(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestFileStore(t, dir)
+	testReactions(t, s)
+
+	// Reactions survive a restart, both from the journal and the snapshot.
+	all, _ := s.List(context.Background(), DefaultRoomID)
+	reply := all[len(all)-1]
+	s.React(context.Background(), reply.ID, "🎉", "Ann")
+	s.Compact()
+	s.Unreact(context.Background(), reply.ID, "👍", "Tom")
+	s.journal.Close()
+
+	reopened := openTestFileStore(t, dir)
+	defer reopened.Close()
+	got, _ := reopened.Get(context.Background(), reply.ID)
+	if len(got.Reactions) != 1 || got.Reactions["🎉"] != 1 {
+		t.Errorf("Expected only the party popper after reopening, got %v", got.Reactions)
+	}
+}
+
+func TestFileStoreRevisions(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestFileStore(t, dir)
+	testRevisions(t, s)
+
+	// Revisions survive a restart, both from the journal and the snapshot.
+	m, _ := s.Create(context.Background(), CreateMessageRequest{From: "Tom", Text: "One"})
+	s.Update(context.Background(), m.ID, CreateMessageRequest{From: "Tom", Text: "Two"})
+	s.Compact()
+	s.Update(context.Background(), m.ID, CreateMessageRequest{From: "Tom", Text: "Three"})
+	s.journal.Close()
+
+	reopened := openTestFileStore(t, dir)
+	defer reopened.Close()
+	revisions, _ := reopened.Revisions(context.Background(), m.ID)
+	if len(revisions) != 2 || revisions[0].Text != "One" || revisions[1].Text != "Two" {
+		t.Errorf("Expected both revisions after reopening, got %+v", revisions)
+	}
+	if got, _ := reopened.Get(context.Background(), m.ID); got.Text != "Three" || got.EditedAt == nil {
+		t.Errorf("Expected the latest edit after reopening, got %+v", got)
+	}
+}
+
+func TestFileStoreSoftDelete(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestFileStore(t, dir)
+	testSoftDelete(t, s)
+
+	// Tombstones, restores and purges survive a restart, both from the
+	// journal and the snapshot.
+	ctx := context.Background()
+	kept, _ := s.Create(ctx, CreateMessageRequest{From: "Tom", Text: "Kept"})
+	gone, _ := s.Create(ctx, CreateMessageRequest{From: "Tom", Text: "Gone"})
+	s.Delete(ctx, kept.ID, 0)
+	s.Delete(ctx, gone.ID, 0)
+	s.Compact()
+	s.Restore(ctx, kept.ID)
+	s.Purge(ctx, time.Now().Add(time.Second))
+	s.journal.Close()
+
+	reopened := openTestFileStore(t, dir)
+	defer reopened.Close()
+	if got, err := reopened.Get(ctx, kept.ID); err != nil || got.Text != "Kept" {
+		t.Errorf("Expected the restored message after reopening, got %+v, %v", got, err)
+	}
+	if _, _, err := reopened.Restore(ctx, gone.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected the purged message to stay gone, got %v", err)
+	}
+}
+
+func TestFileStoreVersions(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestFileStore(t, dir)
+	testVersions(t, s)
+
+	// Versions survive a restart.
+	ctx := context.Background()
+	m, _ := s.Create(ctx, CreateMessageRequest{From: "Tom", Text: "One"})
+	s.Update(ctx, m.ID, CreateMessageRequest{From: "Tom", Text: "Two"})
+	s.journal.Close()
+
+	reopened := openTestFileStore(t, dir)
+	defer reopened.Close()
+	if got, _ := reopened.Get(ctx, m.ID); got.Version != 2 {
+		t.Errorf("Expected version 2 after reopening, got %d", got.Version)
+	}
+}
+
+func TestFileStoreFilters(t *testing.T) {
+	s := openTestFileStore(t, t.TempDir())
+	defer s.Close()
+	testFilters(t, s)
+}
+
+func TestFileStoreSearch(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestFileStore(t, dir)
+	testSearch(t, s)
+	s.Compact()
+	s.Create(context.Background(), CreateMessageRequest{From: "Tom", Text: "More tea"})
+	s.journal.Close()
+
+	// The index is rebuilt from the snapshot and the journal.
+	reopened := openTestFileStore(t, dir)
+	defer reopened.Close()
+	if results, err := searchFor(reopened, DefaultRoomID, search.Term("tea")); err != nil || len(results) != 3 {
+		t.Errorf("Expected 3 results after reopening, got %+v, %v", results, err)
+	}
+}
@@ -0,0 +1,236 @@
+package store
+
+import (
+	"cmp"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IDGenerator hands out message IDs. IDs must never repeat for the lifetime
+// of a store's data, including IDs of messages that have since been deleted,
+// and must increase under CompareIDs.
+type IDGenerator interface {
+	// NewID returns a fresh ID for a message created at now.
+	NewID(now time.Time) string
+	// Observe records an ID that already exists in persisted data so that
+	// NewID never returns it or anything that sorts before it. IDs in a
+	// format the generator does not recognise are ignored.
+	Observe(id string)
+}
+
+// CompareIDs orders IDs by creation time: shorter IDs first, then
+// lexically. This is numeric order for counter IDs and plain string order
+// for the fixed-width ULID and Snowflake IDs.
+func CompareIDs(a, b string) int {
+	if len(a) != len(b) {
+		return cmp.Compare(len(a), len(b))
+	}
+	return strings.Compare(a, b)
+}
+
+// NewIDGenerator returns the generator registered under kind: "counter",
+// "ulid" or "snowflake". node is only used by snowflake.
+func NewIDGenerator(kind string, node int64) (IDGenerator, error) {
+	switch kind {
+	case "counter":
+		return NewCounterIDs(), nil
+	case "ulid":
+		return NewULIDs(), nil
+	case "snowflake":
+		return NewSnowflakeIDs(node)
+	default:
+		return nil, fmt.Errorf("unknown id generator %q", kind)
+	}
+}
+
+// CounterIDs issues "0", "1", "2", ... IDs sort by creation when compared
+// numerically.
+type CounterIDs struct {
+	mu   sync.Mutex
+	next uint64
+}
+
+func NewCounterIDs() *CounterIDs {
+	return &CounterIDs{}
+}
+
+func (c *CounterIDs) NewID(time.Time) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	id := c.next
+	c.next++
+	return strconv.FormatUint(id, 10)
+}
+
+func (c *CounterIDs) Observe(id string) {
+	n, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.next = max(c.next, n+1)
+}
+
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ULIDs issues 26-character ULIDs: a 48-bit millisecond timestamp followed
+// by 80 random bits, Crockford base32 encoded. IDs created in the same
+// millisecond increment the random part so they still sort lexically in
+// creation order.
+type ULIDs struct {
+	mu   sync.Mutex
+	last [16]byte
+}
+
+func NewULIDs() *ULIDs {
+	return &ULIDs{}
+}
+
+func (u *ULIDs) NewID(now time.Time) string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	var id [16]byte
+	ms := uint64(now.UnixMilli())
+	lastMs := binary.BigEndian.Uint64(append([]byte{0, 0}, u.last[:6]...))
+
+	if ms <= lastMs {
+		// Same (or earlier, if the clock stepped back) millisecond:
+		// keep the previous timestamp and bump the entropy.
+		id = u.last
+		for i := 15; i >= 6; i-- {
+			id[i]++
+			if id[i] != 0 {
+				break
+			}
+		}
+	} else {
+		binary.BigEndian.PutUint64(id[:8], ms<<16)
+		rand.Read(id[6:])
+	}
+
+	u.last = id
+	return encodeULID(id)
+}
+
+func (u *ULIDs) Observe(id string) {
+	decoded, ok := decodeULID(id)
+	if !ok {
+		return
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if encodeULID(decoded) > encodeULID(u.last) {
+		u.last = decoded
+	}
+}
+
+func encodeULID(id [16]byte) string {
+	// 128 bits in 26 base32 digits: the first digit carries 3 bits.
+	hi := binary.BigEndian.Uint64(id[:8])
+	lo := binary.BigEndian.Uint64(id[8:])
+
+	var out [26]byte
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:])
+}
+
+func decodeULID(s string) ([16]byte, bool) {
+	var id [16]byte
+	if len(s) != 26 || strings.IndexByte("01234567", s[0]) == -1 {
+		return id, false
+	}
+
+	var hi, lo uint64
+	for i := 0; i < len(s); i++ {
+		v := strings.IndexByte(crockford, s[i])
+		if v == -1 {
+			return id, false
+		}
+		hi = hi<<5 | lo>>59
+		lo = lo<<5 | uint64(v)
+	}
+	binary.BigEndian.PutUint64(id[:8], hi)
+	binary.BigEndian.PutUint64(id[8:], lo)
+	return id, true
+}
+
+const (
+	snowflakeNodeBits = 10
+	snowflakeSeqBits  = 12
+	snowflakeMaxNode  = 1<<snowflakeNodeBits - 1
+	snowflakeMaxSeq   = 1<<snowflakeSeqBits - 1
+)
+
+// snowflakeEpoch is 2024-01-01T00:00:00Z, giving 41 bits of milliseconds
+// roughly 69 years of range.
+var snowflakeEpoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// SnowflakeIDs issues 63-bit Snowflake IDs (milliseconds since
+// snowflakeEpoch, node, per-millisecond sequence) zero-padded to 19 digits
+// so they sort lexically as well as numerically.
+type SnowflakeIDs struct {
+	mu     sync.Mutex
+	node   int64
+	lastMs int64
+	seq    int64
+}
+
+func NewSnowflakeIDs(node int64) (*SnowflakeIDs, error) {
+	if node < 0 || node > snowflakeMaxNode {
+		return nil, fmt.Errorf("snowflake node must be between 0 and %d", snowflakeMaxNode)
+	}
+	return &SnowflakeIDs{node: node, lastMs: -1}, nil
+}
+
+func (s *SnowflakeIDs) NewID(now time.Time) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ms := now.Sub(snowflakeEpoch).Milliseconds()
+	if ms > s.lastMs {
+		s.lastMs, s.seq = ms, 0
+	} else {
+		// Same millisecond or the clock went backwards: keep counting
+		// from the last ID, borrowing the next millisecond once the
+		// sequence is exhausted.
+		s.seq++
+		if s.seq > snowflakeMaxSeq {
+			s.lastMs, s.seq = s.lastMs+1, 0
+		}
+	}
+
+	id := s.lastMs<<(snowflakeNodeBits+snowflakeSeqBits) | s.node<<snowflakeSeqBits | s.seq
+	return fmt.Sprintf("%019d", id)
+}
+
+func (s *SnowflakeIDs) Observe(id string) {
+	if len(id) != 19 {
+		return
+	}
+	n, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return
+	}
+	ms := n >> (snowflakeNodeBits + snowflakeSeqBits)
+	seq := n & snowflakeMaxSeq
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ms > s.lastMs || (ms == s.lastMs && seq > s.seq) {
+		s.lastMs, s.seq = ms, seq
+	}
+}
@@ -0,0 +1,84 @@
+package store
+
+import (
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// Testing every generator issues unique IDs that sort in creation order
+func TestIDGenerators(t *testing.T) {
+	for _, kind := range []string{"counter", "ulid", "snowflake"} {
+		t.Run(kind, func(t *testing.T) {
+			ids, err := NewIDGenerator(kind, 7)
+			if err != nil {
+				t.Fatalf("NewIDGenerator returned error: %v", err)
+			}
+
+			now := time.Now()
+			seen := map[string]bool{}
+			var issued []string
+			for i := 0; i < 5000; i++ {
+				// Several IDs per millisecond, and one clock step backwards.
+				at := now.Add(time.Duration(i/3) * time.Millisecond)
+				if i == 2500 {
+					at = now
+				}
+				id := ids.NewID(at)
+				if seen[id] {
+					t.Fatalf("Duplicate ID %q after %d IDs", id, i)
+				}
+				seen[id] = true
+				issued = append(issued, id)
+			}
+
+			less := func(a, b string) int {
+				if kind == "counter" {
+					x, _ := strconv.Atoi(a)
+					y, _ := strconv.Atoi(b)
+					return x - y
+				}
+				if a < b {
+					return -1
+				}
+				return 1
+			}
+			if !slices.IsSortedFunc(issued, less) {
+				t.Errorf("IDs are not sorted in creation order")
+			}
+		})
+	}
+}
+
+// Testing Observe moves a fresh generator past persisted IDs
+func TestIDGeneratorObserve(t *testing.T) {
+	now := time.Now()
+	for _, kind := range []string{"counter", "ulid", "snowflake"} {
+		t.Run(kind, func(t *testing.T) {
+			first, _ := NewIDGenerator(kind, 1)
+			var last string
+			for i := 0; i < 10; i++ {
+				last = first.NewID(now)
+			}
+
+			second, _ := NewIDGenerator(kind, 1)
+			second.Observe("not-an-id")
+			second.Observe(last)
+			next := second.NewID(now)
+
+			if next == last {
+				t.Errorf("Generator reissued observed ID %q", last)
+			}
+			if kind != "counter" && next < last {
+				t.Errorf("Expected %q to sort after %q", next, last)
+			}
+		})
+	}
+}
+
+func TestSnowflakeNodeRange(t *testing.T) {
+	if _, err := NewSnowflakeIDs(snowflakeMaxNode + 1); err == nil {
+		t.Errorf("Expected an error for an out-of-range node")
+	}
+}
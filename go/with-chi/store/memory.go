@@ -0,0 +1,759 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"node-week-02-with-chi/search"
+)
+
+// MemoryStore keeps each room's messages in a slice in ID order. It is safe
+// for concurrent use; every method returns copies so callers never alias
+// the underlying slices.
+type MemoryStore struct {
+	mu    sync.RWMutex
+	rooms map[string]*memoryRoom
+	// roomOf maps every message ID to its room.
+	roomOf map[string]string
+	// replyCounts and reactions are keyed by message ID. The stored
+	// messages' ReplyCount and Reactions are filled from them on the way out;
+	// replyCounts only counts replies that are not tombstones.
+	replyCounts map[string]int
+	reactions   map[string]reactionSet
+	revisions   map[string][]Revision
+	// index holds the live messages of every room.
+	index   *search.Index
+	ids     IDGenerator
+	roomIDs IDGenerator
+	// lastID is the most recently issued ID, kept so durable wrappers can
+	// persist the generator's position even after that message is deleted.
+	lastID string
+
+	created signal
+}
+
+type memoryRoom struct {
+	Room
+	messages []Message
+}
+
+// NewMemoryStore returns a store seeded with messages that hands out
+// counter IDs.
+func NewMemoryStore(seed ...Message) *MemoryStore {
+	return NewMemoryStoreWithIDs(NewCounterIDs(), seed...)
+}
+
+// NewMemoryStoreWithIDs returns a store seeded with messages. Seed messages
+// without a room go to DefaultRoomID; other rooms are created as needed.
+func NewMemoryStoreWithIDs(ids IDGenerator, seed ...Message) *MemoryStore {
+	s := &MemoryStore{
+		rooms:       map[string]*memoryRoom{},
+		roomOf:      map[string]string{},
+		replyCounts: map[string]int{},
+		reactions:   map[string]reactionSet{},
+		revisions:   map[string][]Revision{},
+		index:       search.NewIndex(CompareIDs),
+		ids:         ids,
+		roomIDs:     NewULIDs(),
+	}
+	s.rooms[DefaultRoomID] = &memoryRoom{Room: Room{
+		ID:        DefaultRoomID,
+		Name:      defaultRoomName,
+		CreatedAt: time.Now().UTC(),
+	}}
+	for _, m := range seed {
+		ids.Observe(m.ID)
+		s.insert(m)
+	}
+	return s
+}
+
+func (s *MemoryStore) Create(_ context.Context, req CreateMessageRequest) (Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	room := s.rooms[roomOrFallback(req.RoomID)]
+	if room == nil {
+		return Message{}, ErrRoomNotFound
+	}
+	if req.ParentID != "" {
+		parentRoom, index := s.locate(req.ParentID)
+		if parentRoom != room || parentRoom.messages[index].DeletedAt != nil {
+			return Message{}, ErrParentNotFound
+		}
+	}
+
+	now := time.Now().UTC()
+	newMessage := Message{
+		ID:       s.ids.NewID(now),
+		RoomID:   room.ID,
+		ParentID: req.ParentID,
+		From:     req.From,
+		Text:     req.Text,
+		TimeSent: now,
+		Version:  1,
+	}
+
+	room.messages = append(room.messages, newMessage)
+	s.roomOf[newMessage.ID] = room.ID
+	s.index.Add(document(newMessage))
+	if newMessage.ParentID != "" {
+		s.replyCounts[newMessage.ParentID]++
+	}
+	s.lastID = newMessage.ID
+	s.created.notify()
+
+	return s.decorate(newMessage), nil
+}
+
+func (s *MemoryStore) Get(_ context.Context, id string) (Message, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	room, index := s.locate(id)
+	if room == nil || !s.visible(room.messages[index]) {
+		return Message{}, ErrNotFound
+	}
+	return s.decorate(room.messages[index]), nil
+}
+
+func (s *MemoryStore) List(_ context.Context, roomID string) ([]Message, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	room := s.rooms[roomID]
+	if room == nil {
+		return nil, ErrRoomNotFound
+	}
+	return s.decorateAll(live(room.messages)), nil
+}
+
+func (s *MemoryStore) ListPage(_ context.Context, roomID string, q PageQuery) (Page, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	room := s.rooms[roomID]
+	if room == nil {
+		return Page{}, ErrRoomNotFound
+	}
+	messages := slices.DeleteFunc(live(room.messages), func(m Message) bool { return !q.matches(m) })
+	page, err := paginate(messages, q)
+	s.decorateAll(page.Messages)
+	return page, err
+}
+
+func (s *MemoryStore) Update(_ context.Context, id string, req CreateMessageRequest) (Message, error) {
+	m, _, err := s.update(id, req)
+	return m, err
+}
+
+// update edits message id and returns the revision it recorded, if any.
+func (s *MemoryStore) update(id string, req CreateMessageRequest) (Message, *Revision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	room, index := s.locate(id)
+	if room == nil || room.messages[index].DeletedAt != nil {
+		return Message{}, nil, ErrNotFound
+	}
+	if err := checkVersion(room.messages[index], req.Version); err != nil {
+		return Message{}, nil, err
+	}
+
+	edited, revision := edit(room.messages[index], req, time.Now().UTC(), len(s.revisions[id]))
+	room.messages[index] = edited
+	if revision != nil {
+		s.revisions[id] = append(s.revisions[id], *revision)
+		s.index.Add(document(edited))
+	}
+
+	return s.decorate(edited), revision, nil
+}
+
+func (s *MemoryStore) Delete(_ context.Context, id string, version int) error {
+	now := time.Now().UTC()
+	_, changed, err := s.setDeleted(id, &now, version)
+	if err == nil && !changed {
+		err = ErrNotFound
+	}
+	return err
+}
+
+func (s *MemoryStore) Restore(_ context.Context, id string) (Message, bool, error) {
+	m, changed, err := s.setDeleted(id, nil, 0)
+	if err != nil {
+		return Message{}, false, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.decorate(m), changed, nil
+}
+
+// setDeleted sets the DeletedAt of message id, reporting whether it
+// changed, and returns the stored message undecorated. A non-zero version
+// must match the message's.
+func (s *MemoryStore) setDeleted(id string, deletedAt *time.Time, version int) (Message, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	room, index := s.locate(id)
+	if room == nil {
+		return Message{}, false, ErrNotFound
+	}
+	m := room.messages[index]
+	if (m.DeletedAt == nil) == (deletedAt == nil) {
+		return m, false, nil
+	}
+	if err := checkVersion(m, version); err != nil {
+		return Message{}, false, err
+	}
+
+	m.DeletedAt = deletedAt
+	m.Version++
+	s.replace(room, index, m)
+	return m, true, nil
+}
+
+func (s *MemoryStore) Purge(_ context.Context, cutoff time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := s.purgeableLocked(cutoff)
+	for _, id := range ids {
+		if room, index := s.locate(id); room != nil {
+			s.removeAt(room, index)
+		}
+	}
+	return len(ids), nil
+}
+
+// purgeableLocked returns the tombstones Purge would remove, in order.
+// s.mu must be held.
+func (s *MemoryStore) purgeableLocked(cutoff time.Time) []string {
+	var tombstones []Message
+	children := map[string]int{}
+	for _, room := range s.rooms {
+		for _, m := range room.messages {
+			if m.DeletedAt != nil {
+				tombstones = append(tombstones, m)
+			}
+			if m.ParentID != "" {
+				children[m.ParentID]++
+			}
+		}
+	}
+	return purgeable(tombstones, children, cutoff)
+}
+
+func (s *MemoryStore) Search(_ context.Context, roomID string, q SearchQuery) (SearchPage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.rooms[roomID] == nil {
+		return SearchPage{}, ErrRoomNotFound
+	}
+
+	return searchPage(s.index.Search(roomID, q.Query), q, func(ids []string) (map[string]Message, error) {
+		found := make(map[string]Message, len(ids))
+		for _, id := range ids {
+			if room, index := s.locate(id); room != nil && room.messages[index].DeletedAt == nil {
+				found[id] = s.decorate(room.messages[index])
+			}
+		}
+		return found, nil
+	})
+}
+
+func (s *MemoryStore) Replies(_ context.Context, id string, q PageQuery) (Page, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	room, index := s.locate(id)
+	if room == nil || !s.visible(room.messages[index]) {
+		return Page{}, ErrNotFound
+	}
+
+	var replies []Message
+	for _, message := range room.messages[index+1:] {
+		if message.ParentID == id && s.visible(message) && q.matches(message) {
+			replies = append(replies, message)
+		}
+	}
+	page, err := paginate(replies, q)
+	s.decorateAll(page.Messages)
+	return page, err
+}
+
+func (s *MemoryStore) Revisions(_ context.Context, id string) ([]Revision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	room, index := s.locate(id)
+	if room == nil || !s.visible(room.messages[index]) {
+		return nil, ErrNotFound
+	}
+	if room.messages[index].DeletedAt != nil {
+		return nil, nil
+	}
+	return slices.Clone(s.revisions[id]), nil
+}
+
+func (s *MemoryStore) React(_ context.Context, id, emoji, user string) (Message, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	room, index := s.locate(id)
+	if room == nil || room.messages[index].DeletedAt != nil {
+		return Message{}, false, ErrNotFound
+	}
+
+	added := s.addReactionLocked(Reaction{MessageID: id, Emoji: emoji, User: user})
+	return s.decorate(room.messages[index]), added, nil
+}
+
+func (s *MemoryStore) Unreact(_ context.Context, id, emoji, user string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	room, index := s.locate(id)
+	if room == nil || room.messages[index].DeletedAt != nil {
+		return ErrNotFound
+	}
+
+	if !s.removeReactionLocked(Reaction{MessageID: id, Emoji: emoji, User: user}) {
+		return ErrReactionNotFound
+	}
+	return nil
+}
+
+func (s *MemoryStore) Created() <-chan struct{} {
+	return s.created.wait()
+}
+
+func (s *MemoryStore) CreateRoom(_ context.Context, req CreateRoomRequest) (Room, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	room := Room{
+		ID:        s.roomIDs.NewID(now),
+		Name:      req.Name,
+		Topic:     req.Topic,
+		CreatedAt: now,
+	}
+	s.rooms[room.ID] = &memoryRoom{Room: room}
+
+	return room, nil
+}
+
+func (s *MemoryStore) GetRoom(_ context.Context, id string) (Room, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	room := s.rooms[id]
+	if room == nil {
+		return Room{}, ErrRoomNotFound
+	}
+	return room.Room, nil
+}
+
+func (s *MemoryStore) ListRooms(_ context.Context) ([]Room, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.roomList(), nil
+}
+
+func (s *MemoryStore) UpdateRoom(_ context.Context, id string, req CreateRoomRequest) (Room, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	room := s.rooms[id]
+	if room == nil {
+		return Room{}, ErrRoomNotFound
+	}
+
+	room.Name = req.Name
+	room.Topic = req.Topic
+
+	return room.Room, nil
+}
+
+func (s *MemoryStore) DeleteRoom(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if id == DefaultRoomID {
+		return ErrDefaultRoom
+	}
+	if s.rooms[id] == nil {
+		return ErrRoomNotFound
+	}
+	s.removeRoomLocked(id)
+
+	return nil
+}
+
+// locate finds the room holding message id and the message's index in it,
+// returning a nil room if there is no such message.
+func (s *MemoryStore) locate(id string) (*memoryRoom, int) {
+	room := s.rooms[s.roomOf[id]]
+	if room == nil {
+		return nil, -1
+	}
+	index, found := slices.BinarySearchFunc(room.messages, id, byID)
+	if !found {
+		return nil, -1
+	}
+	return room, index
+}
+
+// insert adds m in ID order, creating its room if needed. s.mu must be
+// held or s not yet shared.
+func (s *MemoryStore) insert(m Message) {
+	m.RoomID = roomOrFallback(m.RoomID)
+	room := s.rooms[m.RoomID]
+	if room == nil {
+		room = &memoryRoom{Room: Room{ID: m.RoomID, Name: m.RoomID}}
+		s.rooms[m.RoomID] = room
+	}
+	m.ReplyCount, m.Reactions = 0, nil
+	if m.Version == 0 {
+		// Seeds and messages stored before versions existed.
+		m.Version = 1
+	}
+	index, _ := slices.BinarySearchFunc(room.messages, m.ID, byID)
+	room.messages = slices.Insert(room.messages, index, m)
+	s.roomOf[m.ID] = m.RoomID
+	s.countReply(m, 1)
+	if m.DeletedAt == nil {
+		s.index.Add(document(m))
+	}
+}
+
+// replace swaps the message at index in room for m, which must have the
+// same ID and parent. s.mu must be held.
+func (s *MemoryStore) replace(room *memoryRoom, index int, m Message) {
+	s.countReply(room.messages[index], -1)
+	room.messages[index] = m
+	s.countReply(m, 1)
+	if m.DeletedAt == nil {
+		s.index.Add(document(m))
+	} else {
+		s.index.Remove(m.ID)
+	}
+}
+
+// countReply adds delta to the reply count of m's parent if m is a live
+// reply. s.mu must be held.
+func (s *MemoryStore) countReply(m Message, delta int) {
+	if m.ParentID == "" || m.DeletedAt != nil {
+		return
+	}
+	if s.replyCounts[m.ParentID] += delta; s.replyCounts[m.ParentID] <= 0 {
+		delete(s.replyCounts, m.ParentID)
+	}
+}
+
+// removeAt deletes the message at index in room. s.mu must be held.
+func (s *MemoryStore) removeAt(room *memoryRoom, index int) {
+	m := room.messages[index]
+	room.messages = slices.Delete(room.messages, index, index+1)
+	delete(s.roomOf, m.ID)
+	delete(s.replyCounts, m.ID)
+	delete(s.reactions, m.ID)
+	delete(s.revisions, m.ID)
+	s.index.Remove(m.ID)
+	s.countReply(m, -1)
+}
+
+// decorate fills in the reply and reaction counts of m and redacts it if
+// it is a tombstone.
+func (s *MemoryStore) decorate(m Message) Message {
+	m.ReplyCount = s.replyCounts[m.ID]
+	m.Reactions = s.reactions[m.ID].counts()
+	if m.DeletedAt != nil {
+		m = redact(m)
+	}
+	return m
+}
+
+// visible reports whether m can be read: it is live or a tombstone with
+// live replies.
+func (s *MemoryStore) visible(m Message) bool {
+	return m.DeletedAt == nil || s.replyCounts[m.ID] > 0
+}
+
+// decorateAll decorates messages in place; they must not alias the stored
+// slices.
+func (s *MemoryStore) decorateAll(messages []Message) []Message {
+	for i := range messages {
+		messages[i] = s.decorate(messages[i])
+	}
+	return messages
+}
+
+// addReactionLocked records r and reports whether it is new. s.mu must be
+// held and r.MessageID must exist.
+func (s *MemoryStore) addReactionLocked(r Reaction) bool {
+	set := s.reactions[r.MessageID]
+	if set == nil {
+		set = reactionSet{}
+		s.reactions[r.MessageID] = set
+	}
+	users := set[r.Emoji]
+	if users == nil {
+		users = map[string]struct{}{}
+		set[r.Emoji] = users
+	}
+	if _, ok := users[r.User]; ok {
+		return false
+	}
+	users[r.User] = struct{}{}
+	return true
+}
+
+// removeReactionLocked deletes r and reports whether it existed. s.mu must
+// be held.
+func (s *MemoryStore) removeReactionLocked(r Reaction) bool {
+	users := s.reactions[r.MessageID][r.Emoji]
+	if _, ok := users[r.User]; !ok {
+		return false
+	}
+	delete(users, r.User)
+	if len(users) == 0 {
+		delete(s.reactions[r.MessageID], r.Emoji)
+	}
+	if len(s.reactions[r.MessageID]) == 0 {
+		delete(s.reactions, r.MessageID)
+	}
+	return true
+}
+
+func (s *MemoryStore) roomList() []Room {
+	rooms := make([]Room, 0, len(s.rooms))
+	for _, room := range s.rooms {
+		rooms = append(rooms, room.Room)
+	}
+	slices.SortFunc(rooms, compareRooms)
+	return rooms
+}
+
+func (s *MemoryStore) removeRoomLocked(id string) {
+	for _, m := range s.rooms[id].messages {
+		delete(s.roomOf, m.ID)
+		delete(s.replyCounts, m.ID)
+		delete(s.reactions, m.ID)
+		delete(s.revisions, m.ID)
+	}
+	delete(s.rooms, id)
+	s.index.RemoveRoom(id)
+}
+
+// stored returns message id as stored, tombstone or not, without its
+// reply and reaction counts.
+func (s *MemoryStore) stored(id string) (Message, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	room, index := s.locate(id)
+	if room == nil {
+		return Message{}, false
+	}
+	return room.messages[index], true
+}
+
+// put inserts m or replaces the message with the same ID.
+func (s *MemoryStore) put(m Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.ids.Observe(m.ID)
+	if room, index := s.locate(m.ID); room != nil {
+		m.RoomID = room.ID
+		m.ParentID = room.messages[index].ParentID
+		m.ReplyCount, m.Reactions = 0, nil
+		s.replace(room, index, m)
+		return
+	}
+	s.insert(m)
+	s.lastID = m.ID
+}
+
+func (s *MemoryStore) remove(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if room, index := s.locate(id); room != nil {
+		s.removeAt(room, index)
+	}
+}
+
+// putRoom inserts room or replaces the room with the same ID, keeping its
+// messages.
+func (s *MemoryStore) putRoom(room Room) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing := s.rooms[room.ID]; existing != nil {
+		existing.Room = room
+		return
+	}
+	s.rooms[room.ID] = &memoryRoom{Room: room}
+}
+
+func (s *MemoryStore) removeRoom(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.rooms[id] != nil && id != DefaultRoomID {
+		s.removeRoomLocked(id)
+	}
+}
+
+// putReaction records r if its message exists.
+func (s *MemoryStore) putReaction(r Reaction) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if room, _ := s.locate(r.MessageID); room != nil {
+		s.addReactionLocked(r)
+	}
+}
+
+func (s *MemoryStore) removeReaction(r Reaction) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.removeReactionLocked(r)
+}
+
+// putRevision appends r unless its message is gone or already has it.
+func (s *MemoryStore) putRevision(r Revision) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.putRevisionLocked(r)
+}
+
+func (s *MemoryStore) putRevisionLocked(r Revision) {
+	if room, _ := s.locate(r.MessageID); room != nil && r.Number == len(s.revisions[r.MessageID])+1 {
+		s.revisions[r.MessageID] = append(s.revisions[r.MessageID], r)
+	}
+}
+
+// removeRevision drops r if it is its message's latest revision.
+func (s *MemoryStore) removeRevision(r Revision) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if revisions := s.revisions[r.MessageID]; len(revisions) == r.Number {
+		s.revisions[r.MessageID] = revisions[:r.Number-1]
+	}
+}
+
+func (s *MemoryStore) snapshot() snapshot {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var messages []Message
+	for _, room := range s.rooms {
+		messages = append(messages, room.messages...)
+	}
+	slices.SortFunc(messages, func(a, b Message) int { return CompareIDs(a.ID, b.ID) })
+
+	var (
+		reactions []Reaction
+		revisions []Revision
+	)
+	for _, m := range messages {
+		reactions = append(reactions, s.reactions[m.ID].list(m.ID)...)
+		revisions = append(revisions, s.revisions[m.ID]...)
+	}
+
+	return snapshot{
+		Rooms:     s.roomList(),
+		Messages:  messages,
+		Reactions: reactions,
+		Revisions: revisions,
+		LastID:    s.lastID,
+	}
+}
+
+func (s *MemoryStore) load(snap snapshot) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, room := range snap.Rooms {
+		s.rooms[room.ID] = &memoryRoom{Room: room}
+	}
+	for _, m := range snap.Messages {
+		s.ids.Observe(m.ID)
+		s.insert(m)
+	}
+	for _, r := range snap.Reactions {
+		if room, _ := s.locate(r.MessageID); room != nil {
+			s.addReactionLocked(r)
+		}
+	}
+	for _, r := range snap.Revisions {
+		s.putRevisionLocked(r)
+	}
+	if snap.LastID != "" {
+		s.ids.Observe(snap.LastID)
+	}
+	s.lastID = snap.LastID
+}
+
+func byID(m Message, id string) int { return CompareIDs(m.ID, id) }
+
+// live returns a copy of messages without the tombstones.
+func live(messages []Message) []Message {
+	return slices.DeleteFunc(slices.Clone(messages), func(m Message) bool { return m.DeletedAt != nil })
+}
+
+// paginate sorts messages, which must be in CompareIDs order, by q.Sort
+// and cuts out the page described by q.
+func paginate(messages []Message, q PageQuery) (Page, error) {
+	q.Sort.sort(messages)
+	lo, hi := 0, len(messages)
+	if q.After != "" {
+		after, err := q.Sort.parse(q.After)
+		if err != nil {
+			return Page{}, err
+		}
+		i, found := slices.BinarySearchFunc(messages, after, q.Sort.compare)
+		if found {
+			i++
+		}
+		lo = i
+	}
+	if q.Before != "" {
+		before, err := q.Sort.parse(q.Before)
+		if err != nil {
+			return Page{}, err
+		}
+		hi, _ = slices.BinarySearchFunc(messages, before, q.Sort.compare)
+	}
+	hi = max(lo, hi)
+
+	start, end := lo, min(hi, lo+q.Limit)
+	if q.Before != "" && q.After == "" {
+		// Paging backwards: take the messages closest to Before.
+		start, end = max(lo, hi-q.Limit), hi
+	}
+
+	var page Page
+	page.Messages = slices.Clone(messages[start:end])
+	if start < end {
+		if end < len(messages) {
+			page.Next = q.Sort.cursor(messages[end-1])
+		}
+		if start > 0 {
+			page.Prev = q.Sort.cursor(messages[start])
+		}
+	}
+	return page, nil
+}
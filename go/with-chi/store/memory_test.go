@@ -0,0 +1,160 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"node-week-02-with-chi/search"
+)
+
+// Testing the MemoryStore implementation of MessageStore
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore(Message{ID: "0", From: "Bart", Text: "Welcome to CYF chat system!"})
+
+	t.Run("Create and get a message", func(t *testing.T) {
+		created, err := s.Create(ctx, CreateMessageRequest{From: "Lisa", Text: "Hello everyone!"})
+		if err != nil {
+			t.Fatalf("Create returned error: %v", err)
+		}
+
+		got, err := s.Get(ctx, created.ID)
+		if err != nil {
+			t.Fatalf("Get returned error: %v", err)
+		}
+		if !reflect.DeepEqual(got, created) {
+			t.Errorf("Expected %+v, got %+v", created, got)
+		}
+	})
+
+	t.Run("Update a message", func(t *testing.T) {
+		updated, err := s.Update(ctx, "0", CreateMessageRequest{From: "Marge", Text: "Updated"})
+		if err != nil {
+			t.Fatalf("Update returned error: %v", err)
+		}
+		if updated.From != "Marge" || updated.Text != "Updated" {
+			t.Errorf("Message update failed: %+v", updated)
+		}
+	})
+
+	t.Run("Search is case-insensitive", func(t *testing.T) {
+		matched, _ := searchFor(s, DefaultRoomID, search.Term(search.Fold("HELLO")))
+		if len(matched) != 1 {
+			t.Errorf("Expected 1 message found, got %v", len(matched))
+		}
+	})
+
+	t.Run("List returns a copy", func(t *testing.T) {
+		all, _ := s.List(ctx, DefaultRoomID)
+		all[0].Text = "mutated"
+
+		got, _ := s.Get(ctx, all[0].ID)
+		if got.Text == "mutated" {
+			t.Errorf("List exposed the store's internal slice")
+		}
+	})
+
+	t.Run("IDs are not reused after a delete", func(t *testing.T) {
+		last, _ := s.Create(ctx, CreateMessageRequest{From: "Homer", Text: "Doh"})
+		s.Delete(ctx, last.ID, 0)
+
+		next, _ := s.Create(ctx, CreateMessageRequest{From: "Homer", Text: "Doh again"})
+		if next.ID == last.ID {
+			t.Errorf("Deleted ID %q was reused", last.ID)
+		}
+	})
+
+	t.Run("Unknown IDs return ErrNotFound", func(t *testing.T) {
+		if _, err := s.Get(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get: expected ErrNotFound, got %v", err)
+		}
+		if _, err := s.Update(ctx, "missing", CreateMessageRequest{From: "a", Text: "b"}); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Update: expected ErrNotFound, got %v", err)
+		}
+		if err := s.Delete(ctx, "missing", 0); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Delete: expected ErrNotFound, got %v", err)
+		}
+	})
+}
+
+// Testing concurrent writers and readers against MemoryStore
+func TestMemoryStoreConcurrentAccess(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+
+	const writers = 20
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			s.Create(ctx, CreateMessageRequest{From: "Tom", Text: "Hello"})
+		}()
+		go func() {
+			defer wg.Done()
+			s.List(ctx, DefaultRoomID)
+			searchFor(s, DefaultRoomID, search.Term("hello"))
+		}()
+	}
+	wg.Wait()
+
+	all, _ := s.List(ctx, DefaultRoomID)
+	if len(all) != writers {
+		t.Errorf("Expected %d messages, got %v", writers, len(all))
+	}
+}
+
+func TestMemoryStoreListPage(t *testing.T) {
+	testListPage(t, NewMemoryStore())
+}
+
+func TestMemoryStoreCreated(t *testing.T) {
+	testCreated(t, NewMemoryStore())
+}
+
+func TestMemoryStoreRooms(t *testing.T) {
+	testRooms(t, NewMemoryStore())
+}
+
+func TestMemoryStoreReplies(t *testing.T) {
+	testReplies(t, NewMemoryStore())
+}
+
+func TestMemoryStoreReactions(t *testing.T) {
+	testReactions(t, NewMemoryStore())
+}
+
+func TestMemoryStoreRevisions(t *testing.T) {
+	testRevisions(t, NewMemoryStore())
+}
+
+func TestMemoryStoreSoftDelete(t *testing.T) {
+	testSoftDelete(t, NewMemoryStore())
+}
+
+func TestMemoryStoreVersions(t *testing.T) {
+	testVersions(t, NewMemoryStore())
+}
+
+func TestMemoryStoreFilters(t *testing.T) {
+	testFilters(t, NewMemoryStore())
+
+	// Time order need not follow ID order.
+	now := time.Now().UTC()
+	s := NewMemoryStore(
+		Message{ID: "0", From: "Tom", Text: "Late", TimeSent: now},
+		Message{ID: "1", From: "Tom", Text: "Early", TimeSent: now.Add(-time.Hour)},
+	)
+	p, _ := s.ListPage(context.Background(), DefaultRoomID, PageQuery{Limit: 10, Sort: SortByTime})
+	if len(p.Messages) != 2 || p.Messages[0].ID != "1" {
+		t.Errorf("Expected the early message first, got %+v", p.Messages)
+	}
+}
+
+func TestMemoryStoreSearch(t *testing.T) {
+	testSearch(t, NewMemoryStore())
+}
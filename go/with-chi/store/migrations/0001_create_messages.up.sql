@@ -0,0 +1,7 @@
+CREATE TABLE messages (
+    id        TEXT PRIMARY KEY,
+    seq       BIGINT NOT NULL UNIQUE,
+    sender    TEXT NOT NULL,
+    text      TEXT NOT NULL,
+    time_sent TIMESTAMP NOT NULL
+);
@@ -0,0 +1 @@
+DROP TABLE store_state;
@@ -0,0 +1,7 @@
+CREATE TABLE store_state (
+    key   TEXT PRIMARY KEY,
+    value TEXT NOT NULL
+);
+
+INSERT INTO store_state (key, value)
+SELECT 'last_message_id', id FROM messages ORDER BY seq DESC LIMIT 1;
@@ -0,0 +1,5 @@
+DROP INDEX messages_room_seq;
+
+ALTER TABLE messages DROP COLUMN room_id;
+
+DROP TABLE rooms;
@@ -0,0 +1,12 @@
+CREATE TABLE rooms (
+    id         TEXT PRIMARY KEY,
+    name       TEXT NOT NULL,
+    topic      TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL
+);
+
+INSERT INTO rooms (id, name, topic, created_at) VALUES ('general', 'General', '', CURRENT_TIMESTAMP);
+
+ALTER TABLE messages ADD COLUMN room_id TEXT NOT NULL DEFAULT 'general';
+
+CREATE INDEX messages_room_seq ON messages (room_id, seq);
@@ -0,0 +1,5 @@
+DROP INDEX messages_parent_seq;
+
+ALTER TABLE messages DROP COLUMN deleted_at;
+
+ALTER TABLE messages DROP COLUMN parent_id;
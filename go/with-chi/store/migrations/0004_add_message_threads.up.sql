@@ -0,0 +1,5 @@
+ALTER TABLE messages ADD COLUMN parent_id TEXT;
+
+ALTER TABLE messages ADD COLUMN deleted_at TIMESTAMP;
+
+CREATE INDEX messages_parent_seq ON messages (parent_id, seq);
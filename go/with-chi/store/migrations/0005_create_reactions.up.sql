@@ -0,0 +1,7 @@
+CREATE TABLE reactions (
+    message_id TEXT NOT NULL,
+    emoji      TEXT NOT NULL,
+    user_name  TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (message_id, emoji, user_name)
+);
@@ -0,0 +1,3 @@
+DROP TABLE revisions;
+
+ALTER TABLE messages DROP COLUMN edited_at;
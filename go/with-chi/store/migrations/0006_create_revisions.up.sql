@@ -0,0 +1,11 @@
+ALTER TABLE messages ADD COLUMN edited_at TIMESTAMP;
+
+CREATE TABLE revisions (
+    message_id TEXT NOT NULL,
+    number     INTEGER NOT NULL,
+    edited_at  TIMESTAMP NOT NULL,
+    editor     TEXT NOT NULL,
+    sender     TEXT NOT NULL,
+    text       TEXT NOT NULL,
+    PRIMARY KEY (message_id, number)
+);
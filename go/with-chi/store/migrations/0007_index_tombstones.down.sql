@@ -0,0 +1 @@
+DROP INDEX messages_deleted_at;
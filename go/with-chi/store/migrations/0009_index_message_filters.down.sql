@@ -0,0 +1,2 @@
+DROP INDEX messages_room_sender;
+DROP INDEX messages_room_time_sent;
@@ -0,0 +1,2 @@
+CREATE INDEX messages_room_time_sent ON messages (room_id, time_sent);
+CREATE INDEX messages_room_sender ON messages (room_id, sender);
@@ -0,0 +1,66 @@
+package store
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Purger periodically removes the tombstones that have outlived their
+// retention window, after which they can no longer be restored.
+type Purger struct {
+	store     MessageStore
+	retention time.Duration
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// StartPurger purges s once and then every interval. A retention of zero
+// keeps tombstones forever and starts nothing.
+func StartPurger(s MessageStore, retention, interval time.Duration) *Purger {
+	p := &Purger{store: s, retention: retention}
+	if retention <= 0 || interval <= 0 {
+		return p
+	}
+
+	p.stop = make(chan struct{})
+	p.done = make(chan struct{})
+	go p.loop(interval)
+	return p
+}
+
+// Close stops the background purge and waits for a run in progress.
+func (p *Purger) Close() {
+	if p.stop != nil {
+		close(p.stop)
+		<-p.done
+	}
+}
+
+// Purge removes the tombstones deleted more than the retention window ago.
+func (p *Purger) Purge(ctx context.Context) (int, error) {
+	return p.store.Purge(ctx, time.Now().UTC().Add(-p.retention))
+}
+
+func (p *Purger) loop(interval time.Duration) {
+	defer close(p.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := p.Purge(context.Background())
+		if err != nil {
+			log.Printf("store: purge failed: %v", err)
+		} else if n > 0 {
+			log.Printf("store: purged %d deleted messages", n)
+		}
+
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
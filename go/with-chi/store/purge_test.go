@@ -0,0 +1,41 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// Testing the Purger removes tombstones in the background
+func TestPurger(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	m, _ := s.Create(ctx, CreateMessageRequest{From: "Tom", Text: "Bye"})
+	s.Delete(ctx, m.ID, 0)
+
+	t.Run("Zero retention keeps tombstones", func(t *testing.T) {
+		p := StartPurger(s, 0, time.Millisecond)
+		time.Sleep(10 * time.Millisecond)
+		p.Close()
+		if _, _, err := s.Restore(ctx, m.ID); err != nil {
+			t.Fatalf("Expected the tombstone to be kept, got %v", err)
+		}
+		s.Delete(ctx, m.ID, 0)
+	})
+
+	t.Run("Tombstones are purged after the retention window", func(t *testing.T) {
+		p := StartPurger(s, time.Millisecond, time.Millisecond)
+		defer p.Close()
+
+		deadline := time.Now().Add(time.Second)
+		for {
+			if _, ok := s.stored(m.ID); !ok {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected the tombstone to be purged")
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	})
+}
@@ -0,0 +1,83 @@
+package store
+
+import (
+	"cmp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sort is the order of a message listing.
+type Sort string
+
+const (
+	// SortByID lists messages in the order they were created.
+	SortByID Sort = "id"
+	// SortByTime lists messages by time_sent, oldest first.
+	SortByTime Sort = "time_sent"
+	// SortByTimeDesc lists messages by time_sent, newest first.
+	SortByTimeDesc Sort = "-time_sent"
+)
+
+// Sorts lists every Sort a PageQuery accepts.
+var Sorts = []Sort{SortByID, SortByTime, SortByTimeDesc}
+
+// position is where a message falls in a listing. Messages sent at the
+// same time are ordered by ID.
+type position struct {
+	timeSent time.Time
+	id       string
+}
+
+// cursor returns the After or Before value that points at m. Cursors in
+// time order carry time_sent as well as the ID, so they keep their place
+// once the message is gone.
+func (s Sort) cursor(m Message) string {
+	if s == SortByID || s == "" {
+		return m.ID
+	}
+	return strconv.FormatInt(m.TimeSent.UnixNano(), 10) + "." + m.ID
+}
+
+// parse reads a cursor made by s.cursor.
+func (s Sort) parse(cursor string) (position, error) {
+	if s == SortByID || s == "" {
+		return position{id: cursor}, nil
+	}
+	nanos, id, ok := strings.Cut(cursor, ".")
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if !ok || err != nil || id == "" {
+		return position{}, ErrInvalidCursor
+	}
+	return position{timeSent: time.Unix(0, n).UTC(), id: id}, nil
+}
+
+// compare orders m against p in the order s.
+func (s Sort) compare(m Message, p position) int {
+	switch s {
+	case SortByTime:
+		return cmp.Or(m.TimeSent.Compare(p.timeSent), CompareIDs(m.ID, p.id))
+	case SortByTimeDesc:
+		return cmp.Or(p.timeSent.Compare(m.TimeSent), CompareIDs(p.id, m.ID))
+	default:
+		return CompareIDs(m.ID, p.id)
+	}
+}
+
+// sort puts messages, which must be in ID order, in the order s.
+func (s Sort) sort(messages []Message) {
+	if s == SortByID || s == "" {
+		return
+	}
+	slices.SortStableFunc(messages, func(a, b Message) int {
+		return s.compare(a, position{b.TimeSent, b.ID})
+	})
+}
+
+// matches reports whether m passes the filters of q.
+func (q PageQuery) matches(m Message) bool {
+	return (q.From == "" || m.From == q.From) &&
+		(q.Since.IsZero() || !m.TimeSent.Before(q.Since)) &&
+		(q.Until.IsZero() || m.TimeSent.Before(q.Until))
+}
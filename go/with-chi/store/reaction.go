@@ -0,0 +1,49 @@
+package store
+
+import (
+	"slices"
+	"strings"
+)
+
+// Reaction is one user's emoji on a message. A user can add each emoji to
+// a message once.
+type Reaction struct {
+	MessageID string `json:"message_id"`
+	Emoji     string `json:"emoji"`
+	User      string `json:"user"`
+}
+
+// ReactionRequest is validated by the validate package; see its tags for
+// the rules.
+type ReactionRequest struct {
+	// Name of the reacting user on a single line, without control characters
+	User string `json:"user" example:"Alice" validate:"trim,required,max=50,singleline,printable"`
+}
+
+// reactionSet holds the users behind each emoji on one message.
+type reactionSet map[string]map[string]struct{}
+
+func (set reactionSet) counts() map[string]int {
+	counts := make(map[string]int, len(set))
+	for emoji, users := range set {
+		counts[emoji] = len(users)
+	}
+	return counts
+}
+
+// list returns the reactions in set in a stable order.
+func (set reactionSet) list(messageID string) []Reaction {
+	var reactions []Reaction
+	for emoji, users := range set {
+		for user := range users {
+			reactions = append(reactions, Reaction{MessageID: messageID, Emoji: emoji, User: user})
+		}
+	}
+	slices.SortFunc(reactions, func(a, b Reaction) int {
+		if c := strings.Compare(a.Emoji, b.Emoji); c != 0 {
+			return c
+		}
+		return strings.Compare(a.User, b.User)
+	})
+	return reactions
+}
@@ -0,0 +1,41 @@
+package store
+
+import "time"
+
+// Revision records one edit of a message: when it was made, by whom, and
+// the sender and text it replaced. Numbers count a message's edits from 1.
+type Revision struct {
+	MessageID string    `json:"message_id"`
+	Number    int       `json:"number" example:"1"`
+	EditedAt  time.Time `json:"edited_at"`
+	Editor    string    `json:"editor" example:"Alice"`
+	From      string    `json:"from"`
+	Text      string    `json:"text"`
+}
+
+// edit applies req to m at now, returning the edited message and the
+// revision recording it. An edit that changes nothing returns m and nil.
+// number is the number of revisions m already has.
+func edit(m Message, req CreateMessageRequest, now time.Time, number int) (Message, *Revision) {
+	if m.From == req.From && m.Text == req.Text {
+		return m, nil
+	}
+
+	editor := req.Editor
+	if editor == "" {
+		editor = req.From
+	}
+	revision := &Revision{
+		MessageID: m.ID,
+		Number:    number + 1,
+		EditedAt:  now,
+		Editor:    editor,
+		From:      m.From,
+		Text:      m.Text,
+	}
+
+	m.From, m.Text = req.From, req.Text
+	m.EditedAt = &now
+	m.Version++
+	return m, revision
+}
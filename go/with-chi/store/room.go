@@ -0,0 +1,61 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultRoomID is the room every store starts with. It holds messages
+// created without a room and cannot be deleted.
+const DefaultRoomID = "general"
+
+const defaultRoomName = "General"
+
+type Room struct {
+	ID        string    `json:"id" example:"01JB8ZC5T8M2X9Q4Y7W3R6K1PN"`
+	Name      string    `json:"name" example:"Random"`
+	Topic     string    `json:"topic,omitempty" example:"Anything goes"`
+	CreatedAt time.Time `json:"created_at" example:"2025-02-12T12:12:12Z"`
+}
+
+// CreateRoomRequest is validated by the validate package; see its tags
+// for the rules.
+type CreateRoomRequest struct {
+	// Room name on a single line
+	Name string `json:"name" example:"Random" validate:"trim,required,max=50,singleline,printable"`
+	// Optional one-line description
+	Topic string `json:"topic" example:"Anything goes" validate:"trim,max=200,singleline,printable"`
+}
+
+// RoomStore manages the rooms messages are posted in. Rooms are listed
+// with the default room first, then in creation order. Deleting a room
+// deletes its messages.
+type RoomStore interface {
+	CreateRoom(ctx context.Context, req CreateRoomRequest) (Room, error)
+	GetRoom(ctx context.Context, id string) (Room, error)
+	ListRooms(ctx context.Context) ([]Room, error)
+	UpdateRoom(ctx context.Context, id string, req CreateRoomRequest) (Room, error)
+	DeleteRoom(ctx context.Context, id string) error
+}
+
+// roomOrFallback returns roomID, or DefaultRoomID when it is empty.
+func roomOrFallback(roomID string) string {
+	if roomID == "" {
+		return DefaultRoomID
+	}
+	return roomID
+}
+
+// compareRooms orders rooms as ListRooms returns them. Room IDs other than
+// DefaultRoomID are ULIDs, so they sort by creation.
+func compareRooms(a, b Room) int {
+	switch {
+	case a.ID == b.ID:
+		return 0
+	case a.ID == DefaultRoomID:
+		return -1
+	case b.ID == DefaultRoomID:
+		return 1
+	}
+	return CompareIDs(a.ID, b.ID)
+}
@@ -0,0 +1,103 @@
+package store
+
+import (
+	"slices"
+	"strconv"
+
+	"node-week-02-with-chi/search"
+)
+
+// searchBatch bounds the number of hits whose messages are loaded at once
+// while filling a page of search results.
+const searchBatch = 100
+
+// document is how m is indexed for search.
+func document(m Message) search.Document {
+	return search.Document{ID: m.ID, Room: m.RoomID, Text: m.Text}
+}
+
+// fields returns what search filters look at in m.
+func fields(m Message) search.Fields {
+	return search.Fields{From: m.From, TimeSent: m.TimeSent, Replies: m.ReplyCount, Reactions: len(m.Reactions)}
+}
+
+// searchPage returns the window of hits that q asks for, leaving out the
+// messages that fail its filters. Cursors are positions in the filtered
+// ranking. load returns the live, decorated messages among ids; it is
+// called a batch of hits at a time until the window is full.
+func searchPage(hits []search.Hit, q SearchQuery, load func(ids []string) (map[string]Message, error)) (SearchPage, error) {
+	start, end, err := q.window()
+	if err != nil {
+		return SearchPage{}, err
+	}
+
+	var matched []SearchResult
+	for batch := range slices.Chunk(hits, searchBatch) {
+		if len(matched) > end {
+			break
+		}
+		ids := make([]string, len(batch))
+		for i, hit := range batch {
+			ids[i] = hit.ID
+		}
+		messages, err := load(ids)
+		if err != nil {
+			return SearchPage{}, err
+		}
+		for _, hit := range batch {
+			if m, ok := messages[hit.ID]; ok && search.MatchFilters(q.Query, fields(m)) {
+				matched = append(matched, SearchResult{Message: m, Score: hit.Score})
+			}
+		}
+	}
+
+	var page SearchPage
+	if len(matched) > end {
+		page.Next = strconv.Itoa(end)
+		matched = matched[:end]
+	}
+	if start > 0 {
+		page.Prev = strconv.Itoa(start)
+	}
+	page.Results = matched[min(start, len(matched)):]
+	for i, r := range page.Results {
+		page.Results[i].Highlight = search.Highlight(r.Text, q.Query)
+	}
+	return page, nil
+}
+
+// window returns the positions in the ranking of the first result q asks
+// for and of the one after its last.
+func (q SearchQuery) window() (start, end int, err error) {
+	after, err := rank(q.After)
+	if err != nil {
+		return 0, 0, err
+	}
+	before, err := rank(q.Before)
+	if err != nil {
+		return 0, 0, err
+	}
+	switch {
+	case q.After != "":
+		start = after
+	case q.Before != "":
+		start = max(0, before-q.Limit)
+	}
+	end = start + q.Limit
+	if q.Before != "" {
+		end = min(end, before)
+	}
+	return start, max(start, end), nil
+}
+
+// rank reads a search cursor, the position of a result in the ranking.
+func rank(cursor string) (int, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(cursor)
+	if err != nil || n < 0 {
+		return 0, ErrInvalidCursor
+	}
+	return n, nil
+}
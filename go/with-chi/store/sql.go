@@ -0,0 +1,985 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"node-week-02-with-chi/search"
+)
+
+// SQLStore is a MessageStore backed by database/sql. Queries stick to the
+// subset of SQL shared by SQLite and Postgres, using $n placeholders in
+// order of appearance.
+type SQLStore struct {
+	db      *sql.DB
+	ids     IDGenerator
+	roomIDs IDGenerator
+	// createMu keeps this process's ID generator in step with the
+	// last_message_id row it reads and writes. Other processes sharing the
+	// database are not covered; see Create.
+	createMu sync.Mutex
+	// created only hears about messages created through this SQLStore.
+	created signal
+	// index is built from the database by the first Search and then kept
+	// up to date by this SQLStore's writes, so like created it misses
+	// changes made by other processes. indexMu is held from each write's
+	// commit until its change is in the index, so changes reach the index
+	// in commit order. While builds are running, the changes committed are
+	// kept in pending to replay over the new index.
+	indexMu sync.Mutex
+	index   *search.Index
+	builds  int
+	pending []func(*search.Index)
+}
+
+// NewSQLStore wraps db, which must already be migrated with MigrateUp.
+// A nil ids means a CounterIDs.
+func NewSQLStore(db *sql.DB, ids IDGenerator) *SQLStore {
+	if ids == nil {
+		ids = NewCounterIDs()
+	}
+	return &SQLStore{db: db, ids: ids, roomIDs: NewULIDs()}
+}
+
+const (
+	messageColumns = `id, room_id, parent_id, sender, text, time_sent, edited_at, deleted_at, version,
+		(SELECT COUNT(*) FROM messages AS replies WHERE replies.parent_id = messages.id AND replies.deleted_at IS NULL)`
+	roomColumns     = `id, name, topic, created_at`
+	revisionColumns = `message_id, number, edited_at, editor, sender, text`
+)
+
+// Conditions selecting the messages that are listed and the messages that
+// can be read; see MessageStore for how tombstones are treated.
+const (
+	isLive    = `deleted_at IS NULL`
+	isVisible = `(deleted_at IS NULL OR EXISTS (SELECT 1 FROM messages AS replies
+		WHERE replies.parent_id = messages.id AND replies.deleted_at IS NULL))`
+)
+
+// messageTables hold rows keyed by message_id that are deleted with their
+// message.
+var messageTables = []string{"reactions", "revisions"}
+
+// createAttempts is how many times Create tries for a seq and ID that no
+// other process has taken.
+const createAttempts = 5
+
+func (s *SQLStore) Create(ctx context.Context, req CreateMessageRequest) (Message, error) {
+	s.createMu.Lock()
+	defer s.createMu.Unlock()
+
+	// Another process can pick the same seq or ID before either commits.
+	// The unique constraints on them refuse the second INSERT, which then
+	// starts over from what the first committed.
+	for attempt := 1; ; attempt++ {
+		m, err := s.create(ctx, req)
+		if err == nil {
+			s.created.notify()
+			return m, nil
+		}
+		if attempt == createAttempts || !isUniqueViolation(err) {
+			return Message{}, err
+		}
+	}
+}
+
+func (s *SQLStore) create(ctx context.Context, req CreateMessageRequest) (Message, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Message{}, err
+	}
+	defer tx.Rollback()
+
+	var lastID string
+	err = tx.QueryRowContext(ctx, `SELECT value FROM store_state WHERE key = 'last_message_id'`).Scan(&lastID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return Message{}, err
+	}
+	s.ids.Observe(lastID)
+
+	roomID := roomOrFallback(req.RoomID)
+	if _, err := scanRoom(tx.QueryRowContext(ctx, `SELECT `+roomColumns+` FROM rooms WHERE id = $1`, roomID)); err != nil {
+		return Message{}, err
+	}
+	if req.ParentID != "" {
+		parent, err := scanMessage(tx.QueryRowContext(ctx, `SELECT `+messageColumns+` FROM messages WHERE id = $1`, req.ParentID))
+		if errors.Is(err, ErrNotFound) || (err == nil && (parent.RoomID != roomID || parent.DeletedAt != nil)) {
+			return Message{}, ErrParentNotFound
+		}
+		if err != nil {
+			return Message{}, err
+		}
+	}
+
+	var seq int64
+	if err := tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(seq), -1) + 1 FROM messages`).Scan(&seq); err != nil {
+		return Message{}, err
+	}
+
+	now := time.Now().UTC()
+	newMessage := Message{
+		ID:        s.ids.NewID(now),
+		RoomID:    roomID,
+		ParentID:  req.ParentID,
+		From:      req.From,
+		Text:      req.Text,
+		TimeSent:  now,
+		Version:   1,
+		Reactions: map[string]int{},
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO messages (id, seq, room_id, parent_id, sender, text, time_sent) VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		newMessage.ID, seq, newMessage.RoomID, nullString(newMessage.ParentID), newMessage.From, newMessage.Text, newMessage.TimeSent)
+	if err != nil {
+		return Message{}, err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO store_state (key, value) VALUES ('last_message_id', $1)
+		ON CONFLICT (key) DO UPDATE SET value = excluded.value`,
+		newMessage.ID)
+	if err != nil {
+		return Message{}, err
+	}
+
+	if err := s.commit(tx, func(ix *search.Index) { ix.Add(document(newMessage)) }); err != nil {
+		return Message{}, err
+	}
+	return newMessage, nil
+}
+
+func (s *SQLStore) Get(ctx context.Context, id string) (Message, error) {
+	messages, err := s.query(ctx, `SELECT `+messageColumns+` FROM messages WHERE id = $1 AND `+isVisible, id)
+	if err != nil {
+		return Message{}, err
+	}
+	if len(messages) == 0 {
+		return Message{}, ErrNotFound
+	}
+	return messages[0], nil
+}
+
+func (s *SQLStore) List(ctx context.Context, roomID string) ([]Message, error) {
+	messages, err := s.query(ctx, `SELECT `+messageColumns+` FROM messages WHERE room_id = $1 AND `+isLive+` ORDER BY seq`, roomID)
+	if err != nil || len(messages) > 0 {
+		return messages, err
+	}
+	return nil, s.requireRoom(ctx, roomID)
+}
+
+// Expressions comparing id with a bound parameter under CompareIDs order.
+const (
+	idAfter  = `(LENGTH(id) > LENGTH(%[1]s) OR (LENGTH(id) = LENGTH(%[1]s) AND id > %[1]s))`
+	idBefore = `(LENGTH(id) < LENGTH(%[1]s) OR (LENGTH(id) = LENGTH(%[1]s) AND id < %[1]s))`
+)
+
+func (s *SQLStore) ListPage(ctx context.Context, roomID string, q PageQuery) (Page, error) {
+	page, err := s.page(ctx, `room_id = $1 AND `+isLive, roomID, q)
+	if err == nil && len(page.Messages) == 0 {
+		err = s.requireRoom(ctx, roomID)
+	}
+	return page, err
+}
+
+// page runs a PageQuery over the messages matching condition, in which $1
+// stands for value.
+func (s *SQLStore) page(ctx context.Context, condition, value string, q PageQuery) (Page, error) {
+	filter := where{conditions: []string{condition}, args: []any{value}}
+	if q.From != "" {
+		filter.add(`sender = %s`, q.From)
+	}
+	if !q.Since.IsZero() {
+		filter.add(`time_sent >= %s`, q.Since.UTC())
+	}
+	if !q.Until.IsZero() {
+		filter.add(`time_sent < %s`, q.Until.UTC())
+	}
+
+	bounded := filter.clone()
+	for _, bound := range []struct {
+		cursor string
+		after  bool
+	}{{q.After, true}, {q.Before, false}} {
+		if bound.cursor == "" {
+			continue
+		}
+		p, err := q.Sort.parse(bound.cursor)
+		if err != nil {
+			return Page{}, err
+		}
+		bounded.beyond(q.Sort, p, bound.after)
+	}
+
+	// Paging backwards: take the messages closest to Before.
+	backwards := q.Before != "" && q.After == ""
+	bounded.args = append(bounded.args, q.Limit)
+	messages, err := s.query(ctx,
+		`SELECT `+messageColumns+` FROM messages WHERE `+bounded.String()+orderBy(q.Sort, backwards)+
+			` LIMIT `+placeholder(len(bounded.args)),
+		bounded.args...)
+	if err != nil {
+		return Page{}, err
+	}
+	if backwards {
+		slices.Reverse(messages)
+	}
+
+	var page Page
+	page.Messages = messages
+	if len(messages) == 0 {
+		return page, nil
+	}
+
+	first, last := messages[0], messages[len(messages)-1]
+	next := filter.clone()
+	next.beyond(q.Sort, position{last.TimeSent, last.ID}, true)
+	hasNext, err := s.exists(ctx, next.String(), next.args...)
+	if err != nil {
+		return Page{}, err
+	}
+	prev := filter.clone()
+	prev.beyond(q.Sort, position{first.TimeSent, first.ID}, false)
+	hasPrev, err := s.exists(ctx, prev.String(), prev.args...)
+	if err != nil {
+		return Page{}, err
+	}
+	if hasNext {
+		page.Next = q.Sort.cursor(last)
+	}
+	if hasPrev {
+		page.Prev = q.Sort.cursor(first)
+	}
+	return page, nil
+}
+
+// where builds the conditions of a WHERE clause and their arguments.
+type where struct {
+	conditions []string
+	args       []any
+}
+
+// add appends a condition in which each %s stands for the next of args.
+func (w *where) add(condition string, args ...any) {
+	placeholders := make([]any, len(args))
+	for i, arg := range args {
+		w.args = append(w.args, arg)
+		placeholders[i] = placeholder(len(w.args))
+	}
+	w.conditions = append(w.conditions, fmt.Sprintf(condition, placeholders...))
+}
+
+// beyond adds a condition selecting the messages after p in the order
+// sort, or before it.
+func (w *where) beyond(sort Sort, p position, after bool) {
+	if sort == SortByTimeDesc {
+		after = !after
+	}
+	idCondition, timeOp := idBefore, "<"
+	if after {
+		idCondition, timeOp = idAfter, ">"
+	}
+	if sort == SortByID || sort == "" {
+		w.add(idCondition, p.id)
+		return
+	}
+	w.add(`(time_sent `+timeOp+` %[1]s OR (time_sent = %[1]s AND `+fmt.Sprintf(idCondition, "%[2]s")+`))`,
+		p.timeSent, p.id)
+}
+
+func (w where) clone() where {
+	return where{slices.Clone(w.conditions), slices.Clone(w.args)}
+}
+
+func (w where) String() string {
+	return strings.Join(w.conditions, " AND ")
+}
+
+// orderBy returns the ORDER BY clause for sort, reversed if backwards.
+func orderBy(sort Sort, backwards bool) string {
+	direction := ""
+	if (sort == SortByTimeDesc) != backwards {
+		direction = " DESC"
+	}
+	columns := []string{"LENGTH(id)", "id"}
+	if sort == SortByTime || sort == SortByTimeDesc {
+		columns = append([]string{"time_sent"}, columns...)
+	}
+	return " ORDER BY " + strings.Join(columns, direction+", ") + direction
+}
+
+func (s *SQLStore) exists(ctx context.Context, condition string, args ...any) (bool, error) {
+	var found bool
+	err := s.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM messages WHERE `+condition+`)`, args...).Scan(&found)
+	return found, err
+}
+
+func (s *SQLStore) Update(ctx context.Context, id string, req CreateMessageRequest) (Message, error) {
+	var updated Message
+	err := s.unlessChanged(req.Version, func() (err error) {
+		updated, err = s.update(ctx, id, req)
+		return err
+	})
+	if err != nil {
+		return Message{}, err
+	}
+	return updated, nil
+}
+
+func (s *SQLStore) update(ctx context.Context, id string, req CreateMessageRequest) (Message, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Message{}, err
+	}
+	defer tx.Rollback()
+
+	m, err := liveMessage(ctx, tx, id)
+	if err != nil {
+		return Message{}, err
+	}
+	if err := checkVersion(m, req.Version); err != nil {
+		return Message{}, err
+	}
+
+	edited, revision := edit(m, req, time.Now().UTC(), 0)
+	if revision == nil {
+		return withReactionsOf(ctx, tx, m)
+	}
+	result, err := tx.ExecContext(ctx,
+		`UPDATE messages SET sender = $1, text = $2, edited_at = $3, version = $4 WHERE id = $5 AND version = $6`,
+		edited.From, edited.Text, edited.EditedAt, edited.Version, id, m.Version)
+	if err != nil {
+		return Message{}, err
+	}
+	if err := changedAt(ctx, tx, id, result); err != nil {
+		return Message{}, err
+	}
+	// The revision is numbered only now that the UPDATE above holds the
+	// message's row until commit, so no other edit can number one the same.
+	var earlier int
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM revisions WHERE message_id = $1`, id).Scan(&earlier); err != nil {
+		return Message{}, err
+	}
+	revision.Number += earlier
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO revisions (`+revisionColumns+`) VALUES ($1, $2, $3, $4, $5, $6)`,
+		revision.MessageID, revision.Number, revision.EditedAt, revision.Editor, revision.From, revision.Text)
+	if err != nil {
+		return Message{}, err
+	}
+	if edited, err = withReactionsOf(ctx, tx, edited); err != nil {
+		return Message{}, err
+	}
+	if err := s.commit(tx, func(ix *search.Index) { ix.Add(document(edited)) }); err != nil {
+		return Message{}, err
+	}
+	return edited, nil
+}
+
+func (s *SQLStore) Delete(ctx context.Context, id string, version int) error {
+	return s.unlessChanged(version, func() error { return s.delete(ctx, id, version) })
+}
+
+func (s *SQLStore) delete(ctx context.Context, id string, version int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	m, err := liveMessage(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	if err := checkVersion(m, version); err != nil {
+		return err
+	}
+	result, err := tx.ExecContext(ctx,
+		`UPDATE messages SET deleted_at = $1, version = version + 1 WHERE id = $2 AND version = $3`,
+		time.Now().UTC(), id, m.Version)
+	if err != nil {
+		return err
+	}
+	if err := changedAt(ctx, tx, id, result); err != nil {
+		return err
+	}
+	return s.commit(tx, func(ix *search.Index) { ix.Remove(id) })
+}
+
+// unconditionalAttempts is how many times a write without an expected
+// version is tried when other writers keep changing the message first.
+const unconditionalAttempts = 3
+
+// unlessChanged runs write, which fails with ErrVersionMismatch if the
+// message changes between being read and written. When the caller gave
+// no version to expect it has nothing to lose, so write is tried again.
+func (s *SQLStore) unlessChanged(version int, write func() error) error {
+	err := write()
+	for attempt := 1; version == 0 && errors.Is(err, ErrVersionMismatch) && attempt < unconditionalAttempts; attempt++ {
+		err = write()
+	}
+	return err
+}
+
+// changedAt checks that an UPDATE guarded by the version read earlier in
+// tx changed message id. If it did not, another writer got there first:
+// the message was deleted, or is now at a newer version.
+func changedAt(ctx context.Context, tx *sql.Tx, id string, result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil || affected > 0 {
+		return err
+	}
+	if _, err := liveMessage(ctx, tx, id); err != nil {
+		return err
+	}
+	return ErrVersionMismatch
+}
+
+func (s *SQLStore) Restore(ctx context.Context, id string) (Message, bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Message{}, false, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx,
+		`UPDATE messages SET deleted_at = NULL, version = version + 1 WHERE id = $1 AND deleted_at IS NOT NULL`, id)
+	if err != nil {
+		return Message{}, false, err
+	}
+	if requireAffected(result) != nil {
+		// Not a tombstone: report the message as it is, after releasing
+		// the connection.
+		tx.Rollback()
+		m, err := s.Get(ctx, id)
+		return m, false, err
+	}
+	m, err := liveMessage(ctx, tx, id)
+	if err == nil {
+		m, err = withReactionsOf(ctx, tx, m)
+	}
+	if err != nil {
+		return Message{}, false, err
+	}
+	if err := s.commit(tx, func(ix *search.Index) { ix.Add(document(m)) }); err != nil {
+		return Message{}, false, err
+	}
+	return m, true, nil
+}
+
+func (s *SQLStore) Purge(ctx context.Context, cutoff time.Time) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx,
+		`SELECT id, parent_id, deleted_at,
+			(SELECT COUNT(*) FROM messages AS replies WHERE replies.parent_id = messages.id)
+		FROM messages WHERE deleted_at IS NOT NULL`)
+	if err != nil {
+		return 0, err
+	}
+	var tombstones []Message
+	children := map[string]int{}
+	for rows.Next() {
+		var (
+			m         Message
+			parentID  sql.NullString
+			deletedAt time.Time
+			count     int
+		)
+		if err := rows.Scan(&m.ID, &parentID, &deletedAt, &count); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		m.ParentID, m.DeletedAt = parentID.String, &deletedAt
+		tombstones = append(tombstones, m)
+		children[m.ID] = count
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	ids := purgeable(tombstones, children, cutoff)
+	for _, id := range ids {
+		for _, table := range messageTables {
+			if _, err := tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE message_id = $1`, id); err != nil {
+				return 0, err
+			}
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM messages WHERE id = $1`, id); err != nil {
+			return 0, err
+		}
+	}
+	return len(ids), tx.Commit()
+}
+
+func (s *SQLStore) Search(ctx context.Context, roomID string, q SearchQuery) (SearchPage, error) {
+	ix, err := s.searchIndex(ctx)
+	if err != nil {
+		return SearchPage{}, err
+	}
+	hits := ix.Search(roomID, q.Query)
+	page, err := searchPage(hits, q, func(ids []string) (map[string]Message, error) {
+		return s.liveByID(ctx, ids)
+	})
+	if err == nil && len(hits) == 0 {
+		err = s.requireRoom(ctx, roomID)
+	}
+	return page, err
+}
+
+// searchIndex returns the search index, building it from the live messages
+// the first time. The build reads the database without holding indexMu,
+// since writers hold it while they commit.
+func (s *SQLStore) searchIndex(ctx context.Context) (*search.Index, error) {
+	s.indexMu.Lock()
+	if ix := s.index; ix != nil {
+		s.indexMu.Unlock()
+		return ix, nil
+	}
+	s.builds++
+	s.indexMu.Unlock()
+
+	ix, err := s.buildIndex(ctx)
+
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+	s.builds--
+	if err == nil && s.index == nil {
+		// Replaying changes that the build already saw is harmless: they
+		// are in commit order, so each document ends up as last committed.
+		for _, change := range s.pending {
+			change(ix)
+		}
+		s.index = ix
+	}
+	if s.index != nil || s.builds == 0 {
+		s.pending = nil
+	}
+	if s.index == nil {
+		return nil, err
+	}
+	return s.index, nil
+}
+
+func (s *SQLStore) buildIndex(ctx context.Context) (*search.Index, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, room_id, text FROM messages WHERE `+isLive)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ix := search.NewIndex(CompareIDs)
+	for rows.Next() {
+		var d search.Document
+		if err := rows.Scan(&d.ID, &d.Room, &d.Text); err != nil {
+			return nil, err
+		}
+		ix.Add(d)
+	}
+	return ix, rows.Err()
+}
+
+// commit commits tx and applies change to the search index, holding
+// indexMu throughout so that changes reach the index in commit order.
+func (s *SQLStore) commit(tx *sql.Tx, change func(*search.Index)) error {
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	switch {
+	case s.index != nil:
+		change(s.index)
+	case s.builds > 0:
+		s.pending = append(s.pending, change)
+	}
+	return nil
+}
+
+// liveByID looks up the live messages among ids.
+func (s *SQLStore) liveByID(ctx context.Context, ids []string) (map[string]Message, error) {
+	found := make(map[string]Message, len(ids))
+	for batch := range slices.Chunk(ids, reactionBatch) {
+		args := make([]any, len(batch))
+		placeholders := make([]string, len(batch))
+		for i, id := range batch {
+			args[i] = id
+			placeholders[i] = placeholder(i + 1)
+		}
+		messages, err := s.query(ctx,
+			`SELECT `+messageColumns+` FROM messages WHERE id IN (`+strings.Join(placeholders, ", ")+`) AND `+isLive,
+			args...)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range messages {
+			found[m.ID] = m
+		}
+	}
+	return found, nil
+}
+
+func (s *SQLStore) Replies(ctx context.Context, id string, q PageQuery) (Page, error) {
+	page, err := s.page(ctx, `parent_id = $1 AND `+isVisible, id, q)
+	if err == nil && len(page.Messages) == 0 {
+		_, err = s.Get(ctx, id)
+	}
+	return page, err
+}
+
+func (s *SQLStore) Revisions(ctx context.Context, id string) ([]Revision, error) {
+	m, err := s.Get(ctx, id)
+	if err != nil || m.DeletedAt != nil {
+		return nil, err
+	}
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+revisionColumns+` FROM revisions WHERE message_id = $1 ORDER BY number`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revisions []Revision
+	for rows.Next() {
+		var r Revision
+		if err := rows.Scan(&r.MessageID, &r.Number, &r.EditedAt, &r.Editor, &r.From, &r.Text); err != nil {
+			return nil, err
+		}
+		r.EditedAt = r.EditedAt.UTC()
+		revisions = append(revisions, r)
+	}
+	return revisions, rows.Err()
+}
+
+func (s *SQLStore) React(ctx context.Context, id, emoji, user string) (Message, bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Message{}, false, err
+	}
+	defer tx.Rollback()
+
+	if _, err := liveMessage(ctx, tx, id); err != nil {
+		return Message{}, false, err
+	}
+	result, err := tx.ExecContext(ctx,
+		`INSERT INTO reactions (message_id, emoji, user_name, created_at) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (message_id, emoji, user_name) DO NOTHING`,
+		id, emoji, user, time.Now().UTC())
+	if err != nil {
+		return Message{}, false, err
+	}
+	added := requireAffected(result) == nil
+	if err := tx.Commit(); err != nil {
+		return Message{}, false, err
+	}
+
+	m, err := s.Get(ctx, id)
+	return m, added, err
+}
+
+func (s *SQLStore) Unreact(ctx context.Context, id, emoji, user string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := liveMessage(ctx, tx, id); err != nil {
+		return err
+	}
+	result, err := tx.ExecContext(ctx,
+		`DELETE FROM reactions WHERE message_id = $1 AND emoji = $2 AND user_name = $3`,
+		id, emoji, user)
+	if err != nil {
+		return err
+	}
+	if err := requireAffected(result); err != nil {
+		return ErrReactionNotFound
+	}
+	return tx.Commit()
+}
+
+func (s *SQLStore) Created() <-chan struct{} {
+	return s.created.wait()
+}
+
+func (s *SQLStore) CreateRoom(ctx context.Context, req CreateRoomRequest) (Room, error) {
+	now := time.Now().UTC()
+	room := Room{
+		ID:        s.roomIDs.NewID(now),
+		Name:      req.Name,
+		Topic:     req.Topic,
+		CreatedAt: now,
+	}
+
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO rooms (id, name, topic, created_at) VALUES ($1, $2, $3, $4)`,
+		room.ID, room.Name, room.Topic, room.CreatedAt)
+	if err != nil {
+		return Room{}, err
+	}
+	return room, nil
+}
+
+func (s *SQLStore) GetRoom(ctx context.Context, id string) (Room, error) {
+	return scanRoom(s.db.QueryRowContext(ctx, `SELECT `+roomColumns+` FROM rooms WHERE id = $1`, id))
+}
+
+func (s *SQLStore) ListRooms(ctx context.Context) ([]Room, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+roomColumns+` FROM rooms`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rooms []Room
+	for rows.Next() {
+		room, err := scanRoom(rows)
+		if err != nil {
+			return nil, err
+		}
+		rooms = append(rooms, room)
+	}
+	slices.SortFunc(rooms, compareRooms)
+	return rooms, rows.Err()
+}
+
+func (s *SQLStore) UpdateRoom(ctx context.Context, id string, req CreateRoomRequest) (Room, error) {
+	result, err := s.db.ExecContext(ctx,
+		`UPDATE rooms SET name = $1, topic = $2 WHERE id = $3`,
+		req.Name, req.Topic, id)
+	if err != nil {
+		return Room{}, err
+	}
+	if err := requireAffected(result); err != nil {
+		return Room{}, ErrRoomNotFound
+	}
+	return s.GetRoom(ctx, id)
+}
+
+func (s *SQLStore) DeleteRoom(ctx context.Context, id string) error {
+	if id == DefaultRoomID {
+		return ErrDefaultRoom
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range messageTables {
+		_, err := tx.ExecContext(ctx,
+			`DELETE FROM `+table+` WHERE message_id IN (SELECT id FROM messages WHERE room_id = $1)`, id)
+		if err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM messages WHERE room_id = $1`, id); err != nil {
+		return err
+	}
+	result, err := tx.ExecContext(ctx, `DELETE FROM rooms WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if err := requireAffected(result); err != nil {
+		return ErrRoomNotFound
+	}
+	return s.commit(tx, func(ix *search.Index) { ix.RemoveRoom(id) })
+}
+
+// requireRoom returns ErrRoomNotFound if there is no room id.
+func (s *SQLStore) requireRoom(ctx context.Context, id string) error {
+	_, err := s.GetRoom(ctx, id)
+	return err
+}
+
+func (s *SQLStore) query(ctx context.Context, query string, args ...any) ([]Message, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []Message
+	for rows.Next() {
+		message, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, message)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	if err := withReactions(ctx, s.db, messages); err != nil {
+		return nil, err
+	}
+	for i, m := range messages {
+		if m.DeletedAt != nil {
+			messages[i] = redact(m)
+		}
+	}
+	return messages, nil
+}
+
+// reactionBatch bounds the number of IDs looked up per reactions query.
+const reactionBatch = 500
+
+// querier runs queries on a database or in a transaction.
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// withReactions fills in the reaction counts of messages.
+func withReactions(ctx context.Context, db querier, messages []Message) error {
+	index := make(map[string]int, len(messages))
+	for i := range messages {
+		messages[i].Reactions = map[string]int{}
+		index[messages[i].ID] = i
+	}
+
+	for batch := range slices.Chunk(messages, reactionBatch) {
+		args := make([]any, len(batch))
+		placeholders := make([]string, len(batch))
+		for i, m := range batch {
+			args[i] = m.ID
+			placeholders[i] = placeholder(i + 1)
+		}
+
+		rows, err := db.QueryContext(ctx,
+			`SELECT message_id, emoji, COUNT(*) FROM reactions
+			WHERE message_id IN (`+strings.Join(placeholders, ", ")+`)
+			GROUP BY message_id, emoji`,
+			args...)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var (
+				id, emoji string
+				count     int
+			)
+			if err := rows.Scan(&id, &emoji, &count); err != nil {
+				rows.Close()
+				return err
+			}
+			messages[index[id]].Reactions[emoji] = count
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// withReactionsOf returns m with its reaction counts read in tx.
+func withReactionsOf(ctx context.Context, tx *sql.Tx, m Message) (Message, error) {
+	messages := []Message{m}
+	err := withReactions(ctx, tx, messages)
+	return messages[0], err
+}
+
+func placeholder(n int) string {
+	return "$" + strconv.Itoa(n)
+}
+
+// liveMessage reads message id inside tx, treating tombstones as missing.
+func liveMessage(ctx context.Context, tx *sql.Tx, id string) (Message, error) {
+	m, err := scanMessage(tx.QueryRowContext(ctx, `SELECT `+messageColumns+` FROM messages WHERE id = $1`, id))
+	if err != nil {
+		return Message{}, err
+	}
+	if m.DeletedAt != nil {
+		return Message{}, ErrNotFound
+	}
+	return m, nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanMessage(row rowScanner) (Message, error) {
+	var (
+		m         Message
+		parentID  sql.NullString
+		editedAt  sql.NullTime
+		deletedAt sql.NullTime
+	)
+	err := row.Scan(&m.ID, &m.RoomID, &parentID, &m.From, &m.Text, &m.TimeSent, &editedAt, &deletedAt, &m.Version, &m.ReplyCount)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Message{}, ErrNotFound
+	}
+	if err != nil {
+		return Message{}, err
+	}
+	m.ParentID = parentID.String
+	m.TimeSent = m.TimeSent.UTC()
+	m.EditedAt = nullTime(editedAt)
+	m.DeletedAt = nullTime(deletedAt)
+	return m, nil
+}
+
+func scanRoom(row rowScanner) (Room, error) {
+	var room Room
+	err := row.Scan(&room.ID, &room.Name, &room.Topic, &room.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Room{}, ErrRoomNotFound
+	}
+	if err != nil {
+		return Room{}, err
+	}
+	room.CreatedAt = room.CreatedAt.UTC()
+	return room, nil
+}
+
+func nullTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	utc := t.Time.UTC()
+	return &utc
+}
+
+// nullString stores empty strings as NULL.
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// isUniqueViolation reports whether err is a unique constraint failure, as
+// reported by SQLite or by a Postgres driver with SQLSTATE 23505.
+func isUniqueViolation(err error) bool {
+	var state interface{ SQLState() string }
+	if errors.As(err, &state) {
+		return state.SQLState() == "23505"
+	}
+	return strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
+
+func requireAffected(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,344 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"node-week-02-with-chi/search"
+
+	_ "modernc.org/sqlite"
+)
+
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "chat.db"))
+	if err != nil {
+		t.Fatalf("sql.Open returned error: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// Testing migrations can be applied and rolled back
+func TestMigrations(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+
+	if err := MigrateUp(ctx, db); err != nil {
+		t.Fatalf("MigrateUp returned error: %v", err)
+	}
+	// Running again is a no-op.
+	if err := MigrateUp(ctx, db); err != nil {
+		t.Fatalf("Second MigrateUp returned error: %v", err)
+	}
+
+	statuses, err := MigrationStatuses(ctx, db)
+	if err != nil {
+		t.Fatalf("MigrationStatuses returned error: %v", err)
+	}
+	for _, status := range statuses {
+		if status.AppliedAt == nil {
+			t.Errorf("Migration %d was not applied", status.Version)
+		}
+	}
+
+	if err := MigrateDown(ctx, db, len(statuses)); err != nil {
+		t.Fatalf("MigrateDown returned error: %v", err)
+	}
+	if _, err := db.ExecContext(ctx, `SELECT 1 FROM messages`); err == nil {
+		t.Errorf("Expected messages table to be dropped after rolling back all migrations")
+	}
+}
+
+// Testing the SQLStore implementation of MessageStore
+func TestSQLStore(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	if err := MigrateUp(ctx, db); err != nil {
+		t.Fatalf("MigrateUp returned error: %v", err)
+	}
+	s := NewSQLStore(db, nil)
+
+	first, err := s.Create(ctx, CreateMessageRequest{From: "Bart", Text: "Welcome to CYF chat system!"})
+	if err != nil {
+		t.Fatalf("Create returned error: %v", err)
+	}
+	s.Create(ctx, CreateMessageRequest{From: "Lisa", Text: "100% hello"})
+
+	t.Run("Get returns the created message", func(t *testing.T) {
+		got, err := s.Get(ctx, first.ID)
+		if err != nil {
+			t.Fatalf("Get returned error: %v", err)
+		}
+		if got.From != first.From || got.Text != first.Text || !got.TimeSent.Equal(first.TimeSent) {
+			t.Errorf("Expected %+v, got %+v", first, got)
+		}
+	})
+
+	t.Run("Search matches whole words", func(t *testing.T) {
+		q, _ := search.Parse("100%")
+		matched, _ := searchFor(s, DefaultRoomID, q)
+		if len(matched) != 1 {
+			t.Errorf("Expected 1 message found, got %v", len(matched))
+		}
+		matched, _ = searchFor(s, DefaultRoomID, search.Term("hell"))
+		if len(matched) != 0 {
+			t.Errorf("Expected no messages found, got %v", len(matched))
+		}
+	})
+
+	t.Run("Update and delete", func(t *testing.T) {
+		updated, err := s.Update(ctx, first.ID, CreateMessageRequest{From: "Marge", Text: "Edited"})
+		if err != nil || updated.From != "Marge" {
+			t.Errorf("Update failed: %+v, %v", updated, err)
+		}
+		if err := s.Delete(ctx, first.ID, 0); err != nil {
+			t.Errorf("Delete returned error: %v", err)
+		}
+		all, _ := s.List(ctx, DefaultRoomID)
+		if len(all) != 1 {
+			t.Errorf("Expected 1 message, got %v", len(all))
+		}
+	})
+
+	t.Run("IDs are not reused after a delete", func(t *testing.T) {
+		last, _ := s.Create(ctx, CreateMessageRequest{From: "Homer", Text: "Doh"})
+		s.Delete(ctx, last.ID, 0)
+
+		// A fresh store on the same database must also skip the ID.
+		next, _ := NewSQLStore(db, nil).Create(ctx, CreateMessageRequest{From: "Homer", Text: "Doh again"})
+		if next.ID == last.ID {
+			t.Errorf("Deleted ID %q was reused", last.ID)
+		}
+	})
+
+	t.Run("Unknown IDs return ErrNotFound", func(t *testing.T) {
+		if _, err := s.Get(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get: expected ErrNotFound, got %v", err)
+		}
+		if _, err := s.Update(ctx, "missing", CreateMessageRequest{From: "a", Text: "b"}); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Update: expected ErrNotFound, got %v", err)
+		}
+		if err := s.Delete(ctx, "missing", 0); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Delete: expected ErrNotFound, got %v", err)
+		}
+	})
+}
+
+func TestSQLStoreListPage(t *testing.T) {
+	db := openTestDB(t)
+	if err := MigrateUp(context.Background(), db); err != nil {
+		t.Fatalf("MigrateUp returned error: %v", err)
+	}
+	testListPage(t, NewSQLStore(db, nil))
+}
+
+func TestSQLStoreCreated(t *testing.T) {
+	db := openTestDB(t)
+	if err := MigrateUp(context.Background(), db); err != nil {
+		t.Fatalf("MigrateUp returned error: %v", err)
+	}
+	testCreated(t, NewSQLStore(db, nil))
+}
+
+func TestSQLStoreRooms(t *testing.T) {
+	db := openTestDB(t)
+	if err := MigrateUp(context.Background(), db); err != nil {
+		t.Fatalf("MigrateUp returned error: %v", err)
+	}
+	testRooms(t, NewSQLStore(db, nil))
+}
+
+func TestSQLStoreReplies(t *testing.T) {
+	db := openTestDB(t)
+	if err := MigrateUp(context.Background(), db); err != nil {
+		t.Fatalf("MigrateUp returned error: %v", err)
+	}
+	testReplies(t, NewSQLStore(db, nil))
+}
+
+func TestSQLStoreReactions(t *testing.T) {
+	db := openTestDB(t)
+	if err := MigrateUp(context.Background(), db); err != nil {
+		t.Fatalf("MigrateUp returned error: %v", err)
+	}
+	testReactions(t, NewSQLStore(db, nil))
+}
+
+func TestSQLStoreRevisions(t *testing.T) {
+	db := openTestDB(t)
+	if err := MigrateUp(context.Background(), db); err != nil {
+		t.Fatalf("MigrateUp returned error: %v", err)
+	}
+	testRevisions(t, NewSQLStore(db, nil))
+}
+
+func TestSQLStoreSoftDelete(t *testing.T) {
+	db := openTestDB(t)
+	if err := MigrateUp(context.Background(), db); err != nil {
+		t.Fatalf("MigrateUp returned error: %v", err)
+	}
+	testSoftDelete(t, NewSQLStore(db, nil))
+}
+
+func TestSQLStoreVersions(t *testing.T) {
+	db := openTestDB(t)
+	if err := MigrateUp(context.Background(), db); err != nil {
+		t.Fatalf("MigrateUp returned error: %v", err)
+	}
+	testVersions(t, NewSQLStore(db, nil))
+}
+
+func TestSQLStoreFilters(t *testing.T) {
+	db := openTestDB(t)
+	if err := MigrateUp(context.Background(), db); err != nil {
+		t.Fatalf("MigrateUp returned error: %v", err)
+	}
+	s := NewSQLStore(db, nil)
+	testFilters(t, s)
+
+	// Time order need not follow ID order, and sub-second times compare
+	// correctly.
+	ctx := context.Background()
+	late, _ := s.Create(ctx, CreateMessageRequest{From: "Zed", Text: "Late"})
+	early, _ := s.Create(ctx, CreateMessageRequest{From: "Zed", Text: "Early"})
+	earlier := late.TimeSent.Add(-1500 * time.Millisecond)
+	if _, err := db.Exec(`UPDATE messages SET time_sent = $1 WHERE id = $2`, earlier, early.ID); err != nil {
+		t.Fatalf("UPDATE returned error: %v", err)
+	}
+	p, _ := s.ListPage(ctx, DefaultRoomID, PageQuery{Limit: 10, Sort: SortByTime, From: "Zed"})
+	if len(p.Messages) != 2 || p.Messages[0].ID != early.ID {
+		t.Errorf("Expected the early message first, got %+v", p.Messages)
+	}
+	p, _ = s.ListPage(ctx, DefaultRoomID, PageQuery{Limit: 10, Since: earlier.Add(time.Second), From: "Zed"})
+	if len(p.Messages) != 1 || p.Messages[0].ID != late.ID {
+		t.Errorf("Expected only the late message, got %+v", p.Messages)
+	}
+}
+
+func TestSQLStoreSearch(t *testing.T) {
+	db := openTestDB(t)
+	if err := MigrateUp(context.Background(), db); err != nil {
+		t.Fatalf("MigrateUp returned error: %v", err)
+	}
+	testSearch(t, NewSQLStore(db, nil))
+
+	// A fresh store builds its index from what is already stored.
+	reopened := NewSQLStore(db, nil)
+	if results, err := searchFor(reopened, DefaultRoomID, search.Term("tea")); err != nil || len(results) != 2 {
+		t.Errorf("Expected 2 results from a fresh store, got %+v, %v", results, err)
+	}
+}
+
+// Testing concurrent writers on separate connections cannot overwrite each
+// other's changes
+func TestSQLStoreConcurrentUpdates(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "chat.db")+"?_pragma=busy_timeout(10000)&_txlock=immediate")
+	if err != nil {
+		t.Fatalf("sql.Open returned error: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	db.SetMaxOpenConns(8)
+	if err := MigrateUp(ctx, db); err != nil {
+		t.Fatalf("MigrateUp returned error: %v", err)
+	}
+	s := NewSQLStore(db, nil)
+	m, _ := s.Create(ctx, CreateMessageRequest{From: "Tom", Text: "One"})
+
+	const writers = 8
+	write := func(version int) []error {
+		errs := make([]error, writers)
+		var wg sync.WaitGroup
+		for i := range writers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, errs[i] = s.Update(ctx, m.ID, CreateMessageRequest{From: "Tom", Text: fmt.Sprintf("Edit %d.%d", version, i), Version: version})
+			}()
+		}
+		wg.Wait()
+		return errs
+	}
+
+	t.Run("Only one writer with the same version succeeds", func(t *testing.T) {
+		succeeded := 0
+		for _, err := range write(m.Version) {
+			switch {
+			case err == nil:
+				succeeded++
+			case !errors.Is(err, ErrVersionMismatch):
+				t.Errorf("Expected ErrVersionMismatch, got %v", err)
+			}
+		}
+		if got, _ := s.Get(ctx, m.ID); succeeded != 1 || got.Version != m.Version+1 {
+			t.Errorf("Expected 1 successful update to version %d, got %d at version %d", m.Version+1, succeeded, got.Version)
+		}
+	})
+
+	t.Run("Writers without a version all apply, with distinct revisions", func(t *testing.T) {
+		searchFor(s, DefaultRoomID, search.Term("edit"))
+		for _, err := range write(0) {
+			if err != nil {
+				t.Errorf("Update returned error: %v", err)
+			}
+		}
+		revisions, _ := s.Revisions(ctx, m.ID)
+		if len(revisions) != writers+1 {
+			t.Fatalf("Expected %d revisions, got %d", writers+1, len(revisions))
+		}
+		for i, r := range revisions {
+			if r.Number != i+1 {
+				t.Errorf("Expected revision %d, got %d", i+1, r.Number)
+			}
+		}
+
+		// The index must end up with the last committed text.
+		got, _ := s.Get(ctx, m.ID)
+		for i := range writers {
+			text := fmt.Sprintf("Edit 0.%d", i)
+			results, _ := searchFor(s, DefaultRoomID, search.Phrase{"0", fmt.Sprint(i)})
+			if found := len(results) == 1; found != (text == got.Text) {
+				t.Errorf("Searching for %q: expected only %q to be indexed, found %d", text, got.Text, len(results))
+			}
+		}
+	})
+}
+
+// takenIDs hands out ids in order, as if another process had already
+// used some of them.
+type takenIDs struct{ ids []string }
+
+func (g *takenIDs) NewID(time.Time) string {
+	id := g.ids[0]
+	g.ids = g.ids[1:]
+	return id
+}
+
+func (g *takenIDs) Observe(string) {}
+
+// Testing Create starts over when another writer took its ID
+func TestSQLStoreCreateRetries(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	if err := MigrateUp(ctx, db); err != nil {
+		t.Fatalf("MigrateUp returned error: %v", err)
+	}
+	s := NewSQLStore(db, &takenIDs{ids: []string{"10", "10", "10", "11"}})
+
+	s.Create(ctx, CreateMessageRequest{From: "Tom", Text: "First"})
+	m, err := s.Create(ctx, CreateMessageRequest{From: "Tom", Text: "Second"})
+	if err != nil || m.ID != "11" {
+		t.Fatalf("Expected message 11 after two taken IDs, got %+v, %v", m, err)
+	}
+	messages, _ := s.List(ctx, DefaultRoomID)
+	if len(messages) != 2 || messages[1].ID != "11" {
+		t.Errorf("Expected both messages in order, got %+v", messages)
+	}
+}
@@ -1,15 +1,225 @@
 package store
 
-import "time"
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"node-week-02-with-chi/search"
+)
 
 type Message struct {
-	ID       string    `json:"id"`
+	ID string `json:"id"`
+	// RoomID is the room the message was posted in.
+	RoomID string `json:"room_id" example:"general"`
+	// ParentID is the message this one replies to, if any.
+	ParentID string    `json:"parent_id,omitempty"`
 	From     string    `json:"from"`
 	Text     string    `json:"text"`
 	TimeSent time.Time `json:"time_sent,omitempty"`
+	// EditedAt is when the sender or text last changed; see Revisions.
+	EditedAt *time.Time `json:"edited_at,omitempty"`
+	// ReplyCount is the number of direct replies to the message.
+	ReplyCount int `json:"reply_count"`
+	// Reactions counts the users who reacted with each emoji.
+	Reactions map[string]int `json:"reactions"`
+	// Version starts at 1 and goes up with every edit, delete and restore.
+	// Reactions and replies leave it alone.
+	Version int `json:"version" example:"1"`
+	// DeletedAt is set on tombstones: deleted messages that are shown
+	// without their sender and text while they still have replies.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// SearchResult is a message that matched a search.
+type SearchResult struct {
+	Message
+	// Score is the BM25 relevance of the message to the query; results
+	// come highest first.
+	Score float64 `json:"score" example:"1.86"`
+	// Highlight is the text, HTML-escaped, with the words that matched
+	// wrapped in <mark> tags.
+	Highlight string `json:"highlight" example:"<mark>Hello</mark> World"`
 }
 
+// CreateMessageRequest is validated by the validate package; see its tags
+// for the rules. The fields are trimmed before they are stored.
 type CreateMessageRequest struct {
-	From string `json:"from" example:"Alice"`
-	Text string `json:"text" example:"Hello World"`
+	// Sender name on a single line, without control characters
+	From string `json:"from" example:"Alice" validate:"trim,required,max=50,singleline,printable"`
+	// Message body; tabs and newlines are the only control characters allowed
+	Text string `json:"text" example:"Hello World" validate:"trim,required,max=2000,printable"`
+	// ID of the message to reply to, which must be in the same room. Only
+	// used when creating a message; replies cannot be moved between threads.
+	ParentID string `json:"parent_id,omitempty" example:"" validate:"trim,max=100,singleline,printable"`
+	// Name recorded as the editor of an update; defaults to From. Ignored
+	// when creating a message.
+	Editor string `json:"editor,omitempty" example:"Alice" validate:"trim,max=50,singleline,printable"`
+	// RoomID picks the room for a new message and is ignored by Update.
+	// It comes from the URL rather than the body; empty means DefaultRoomID.
+	RoomID string `json:"-"`
+	// Version, if non-zero, makes Update fail with ErrVersionMismatch
+	// unless the message is still at that version. It comes from If-Match.
+	Version int `json:"-"`
+}
+
+var (
+	// ErrNotFound is returned when no message matches the requested ID.
+	ErrNotFound = errors.New("message not found")
+	// ErrRoomNotFound is returned when no room matches the requested ID.
+	ErrRoomNotFound = errors.New("room not found")
+	// ErrParentNotFound is returned by Create when the message to reply to
+	// does not exist, is in another room or was deleted.
+	ErrParentNotFound = errors.New("parent message not found")
+	// ErrReactionNotFound is returned by Unreact when the user has not
+	// reacted to the message with the emoji.
+	ErrReactionNotFound = errors.New("reaction not found")
+	// ErrVersionMismatch is returned by Update and Delete when the message
+	// is no longer at the version the caller expected.
+	ErrVersionMismatch = errors.New("message version mismatch")
+	// ErrInvalidCursor is returned when the After or Before of a
+	// PageQuery did not come from a page in the same Sort order, or those
+	// of a SearchQuery from a page of search results.
+	ErrInvalidCursor = errors.New("invalid cursor")
+	// ErrDefaultRoom is returned on attempts to delete DefaultRoomID.
+	ErrDefaultRoom = errors.New("the default room cannot be deleted")
+)
+
+// PageQuery selects a window of messages in Sort order. After and Before
+// are exclusive bounds, taken from the Next and Prev of an earlier page in
+// the same order; they need not refer to messages that still exist, so
+// pages stay stable while other clients insert and delete. In ID order
+// they are plain message IDs.
+type PageQuery struct {
+	Limit  int
+	After  string
+	Before string
+	// Sort is the order of the messages; empty means SortByID.
+	Sort Sort
+	// From, Since and Until, when set, keep only the messages from that
+	// sender, sent at or after Since and sent before Until.
+	From  string
+	Since time.Time
+	Until time.Time
+}
+
+// Page is one window of messages. Next is set when more messages follow
+// the page and is the cursor to pass as After; Prev is set when messages
+// precede it and is the cursor to pass as Before.
+type Page struct {
+	Messages []Message
+	Next     string
+	Prev     string
+}
+
+// SearchQuery selects a window of the results of a search, best first.
+// After and Before are exclusive bounds taken from the Next and Prev of an
+// earlier page of the same search. Results are ranked afresh for every
+// page, so one that moves in the ranking in between can be repeated or
+// skipped.
+type SearchQuery struct {
+	Query  search.Query
+	Limit  int
+	After  string
+	Before string
+}
+
+// SearchPage is one window of search results, with Next and Prev set like
+// those of a Page.
+type SearchPage struct {
+	Results []SearchResult
+	Next    string
+	Prev    string
+}
+
+// MessageStore is the persistence layer behind the message handlers.
+// Implementations assign IDs and timestamps on Create and return
+// ErrNotFound for unknown IDs. Delete is soft: the message becomes a
+// tombstone (see Message.DeletedAt) that keeps its content for Restore
+// until Purge removes it. Tombstones are left out of List, ListPage and
+// Search and cannot be updated, reacted to or deleted again. Get, Replies
+// and Revisions treat them as missing unless they still have live
+// replies, in which case they are shown redacted so threads stay intact.
+// Update records a Revision for every edit that changes the sender or
+// text.
+// Message IDs are unique across rooms; List,
+// ListPage and Search only see the messages in one room and, like Create,
+// return ErrRoomNotFound for unknown rooms.
+type MessageStore interface {
+	RoomStore
+
+	Create(ctx context.Context, req CreateMessageRequest) (Message, error)
+	Get(ctx context.Context, id string) (Message, error)
+	List(ctx context.Context, roomID string) ([]Message, error)
+	ListPage(ctx context.Context, roomID string, q PageQuery) (Page, error)
+	Update(ctx context.Context, id string, req CreateMessageRequest) (Message, error)
+	// Delete turns message id into a tombstone. A non-zero version makes
+	// it fail with ErrVersionMismatch if the message has changed since.
+	Delete(ctx context.Context, id string, version int) error
+	// Search returns a page of the messages in room roomID that match
+	// q.Query, most relevant first. Stores keep a search.Index up to date
+	// as messages are created, edited, deleted and restored, and check
+	// the query's filters on its hits.
+	Search(ctx context.Context, roomID string, q SearchQuery) (SearchPage, error)
+	// Replies returns a page of the direct replies to message id, in ID
+	// order, or ErrNotFound if there is no such message.
+	Replies(ctx context.Context, id string, q PageQuery) (Page, error)
+	// Revisions returns the edits of message id, oldest first, or
+	// ErrNotFound if there is no such message.
+	Revisions(ctx context.Context, id string) ([]Revision, error)
+	// React adds user's emoji to message id and reports whether it was
+	// new; reacting again with the same emoji changes nothing.
+	React(ctx context.Context, id, emoji, user string) (Message, bool, error)
+	// Unreact removes user's emoji from message id.
+	Unreact(ctx context.Context, id, emoji, user string) error
+	// Restore undoes the Delete of message id and reports whether it was
+	// deleted; restoring a live message changes nothing.
+	Restore(ctx context.Context, id string) (Message, bool, error)
+	// Purge permanently removes the tombstones deleted before cutoff,
+	// keeping those that still have replies, and returns how many it
+	// removed.
+	Purge(ctx context.Context, cutoff time.Time) (int, error)
+	// Created returns a channel that is closed the next time a message is
+	// created, so readers can wait for new messages without polling. Take
+	// the channel before reading to avoid missing a message in between.
+	Created() <-chan struct{}
+}
+
+// checkVersion returns ErrVersionMismatch unless version is zero or the
+// version of m.
+func checkVersion(m Message, version int) error {
+	if version != 0 && version != m.Version {
+		return ErrVersionMismatch
+	}
+	return nil
+}
+
+// redact returns what is shown of m once it is a tombstone.
+func redact(m Message) Message {
+	m.From, m.Text = "", ""
+	m.EditedAt = nil
+	m.Reactions = map[string]int{}
+	return m
+}
+
+// purgeable returns the IDs of the tombstones Purge may remove, replies
+// before the messages they reply to. children counts the stored replies
+// of each tombstone, deleted or not.
+func purgeable(tombstones []Message, children map[string]int, cutoff time.Time) []string {
+	// Replies are always newer than their parent, so going newest first
+	// frees a parent once its last tombstoned reply is purged.
+	slices.SortFunc(tombstones, func(a, b Message) int { return CompareIDs(b.ID, a.ID) })
+
+	var ids []string
+	for _, m := range tombstones {
+		if !m.DeletedAt.Before(cutoff) || children[m.ID] > 0 {
+			continue
+		}
+		ids = append(ids, m.ID)
+		if m.ParentID != "" {
+			children[m.ParentID]--
+		}
+	}
+	return ids
 }
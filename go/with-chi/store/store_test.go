@@ -0,0 +1,744 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"node-week-02-with-chi/search"
+)
+
+// testListPage checks ListPage against any MessageStore implementation.
+func testListPage(t *testing.T, s MessageStore) {
+	ctx := context.Background()
+
+	var ids []string
+	for i := 0; i < 12; i++ {
+		m, err := s.Create(ctx, CreateMessageRequest{From: "Tom", Text: fmt.Sprintf("Message %d", i)})
+		if err != nil {
+			t.Fatalf("Create returned error: %v", err)
+		}
+		ids = append(ids, m.ID)
+	}
+
+	pageIDs := func(p Page) []string {
+		var got []string
+		for _, m := range p.Messages {
+			got = append(got, m.ID)
+		}
+		return got
+	}
+	expect := func(t *testing.T, p Page, want []string, next, prev string) {
+		t.Helper()
+		if fmt.Sprint(pageIDs(p)) != fmt.Sprint(want) {
+			t.Errorf("Expected IDs %v, got %v", want, pageIDs(p))
+		}
+		if p.Next != next || p.Prev != prev {
+			t.Errorf("Expected next %q prev %q, got next %q prev %q", next, prev, p.Next, p.Prev)
+		}
+	}
+
+	t.Run("First page", func(t *testing.T) {
+		p, _ := s.ListPage(ctx, DefaultRoomID, PageQuery{Limit: 5})
+		expect(t, p, ids[:5], ids[4], "")
+	})
+
+	t.Run("Page after a cursor", func(t *testing.T) {
+		p, _ := s.ListPage(ctx, DefaultRoomID, PageQuery{Limit: 5, After: ids[4]})
+		expect(t, p, ids[5:10], ids[9], ids[5])
+	})
+
+	t.Run("Last page", func(t *testing.T) {
+		p, _ := s.ListPage(ctx, DefaultRoomID, PageQuery{Limit: 5, After: ids[9]})
+		expect(t, p, ids[10:], "", ids[10])
+	})
+
+	t.Run("Page before a cursor", func(t *testing.T) {
+		p, _ := s.ListPage(ctx, DefaultRoomID, PageQuery{Limit: 5, Before: ids[10]})
+		expect(t, p, ids[5:10], ids[9], ids[5])
+	})
+
+	t.Run("Bounded on both sides", func(t *testing.T) {
+		p, _ := s.ListPage(ctx, DefaultRoomID, PageQuery{Limit: 5, After: ids[2], Before: ids[5]})
+		expect(t, p, ids[3:5], ids[4], ids[3])
+	})
+
+	t.Run("Cursor survives deletion of its message", func(t *testing.T) {
+		if err := s.Delete(ctx, ids[4], 0); err != nil {
+			t.Fatalf("Delete returned error: %v", err)
+		}
+		p, _ := s.ListPage(ctx, DefaultRoomID, PageQuery{Limit: 3, After: ids[4]})
+		expect(t, p, ids[5:8], ids[7], ids[5])
+	})
+}
+
+// testCreated checks that Created wakes waiters on new messages only.
+func testCreated(t *testing.T, s MessageStore) {
+	ctx := context.Background()
+
+	before := s.Created()
+	select {
+	case <-before:
+		t.Fatal("Created fired before any message was created")
+	default:
+	}
+
+	m, err := s.Create(ctx, CreateMessageRequest{From: "Tom", Text: "Hi"})
+	if err != nil {
+		t.Fatalf("Create returned error: %v", err)
+	}
+	select {
+	case <-before:
+	case <-time.After(time.Second):
+		t.Fatal("Created did not fire after Create")
+	}
+
+	after := s.Created()
+	s.Update(ctx, m.ID, CreateMessageRequest{From: "Tom", Text: "Edited"})
+	s.Delete(ctx, m.ID, 0)
+	select {
+	case <-after:
+		t.Error("Created fired for an update or delete")
+	default:
+	}
+}
+
+// testRooms checks room management and room scoping against any
+// MessageStore implementation.
+func testRooms(t *testing.T, s MessageStore) {
+	ctx := context.Background()
+
+	general, err := s.GetRoom(ctx, DefaultRoomID)
+	if err != nil || general.Name == "" || general.CreatedAt.IsZero() {
+		t.Fatalf("Expected the default room, got %+v, %v", general, err)
+	}
+
+	room, err := s.CreateRoom(ctx, CreateRoomRequest{Name: "Random", Topic: "Anything"})
+	if err != nil {
+		t.Fatalf("CreateRoom returned error: %v", err)
+	}
+	if got, _ := s.GetRoom(ctx, room.ID); got.Name != "Random" || got.Topic != "Anything" {
+		t.Errorf("Expected the new room, got %+v", got)
+	}
+
+	inGeneral, _ := s.Create(ctx, CreateMessageRequest{From: "Tom", Text: "hello general"})
+	inRoom, err := s.Create(ctx, CreateMessageRequest{From: "Tom", Text: "hello random", RoomID: room.ID})
+	if err != nil {
+		t.Fatalf("Create in room returned error: %v", err)
+	}
+	if inGeneral.RoomID != DefaultRoomID || inRoom.RoomID != room.ID {
+		t.Errorf("Expected messages in %s and %s, got %s and %s", DefaultRoomID, room.ID, inGeneral.RoomID, inRoom.RoomID)
+	}
+
+	t.Run("Listing is scoped to the room", func(t *testing.T) {
+		all, _ := s.List(ctx, room.ID)
+		if len(all) != 1 || all[0].ID != inRoom.ID {
+			t.Errorf("Expected only %s, got %+v", inRoom.ID, all)
+		}
+		page, _ := s.ListPage(ctx, room.ID, PageQuery{Limit: 10})
+		if len(page.Messages) != 1 || page.Next != "" || page.Prev != "" {
+			t.Errorf("Expected a single-message page, got %+v", page)
+		}
+		matched, _ := searchFor(s, room.ID, search.Term("hello"))
+		if len(matched) != 1 || matched[0].ID != inRoom.ID {
+			t.Errorf("Expected search to find only %s, got %+v", inRoom.ID, matched)
+		}
+		if got, _ := s.Get(ctx, inRoom.ID); got.RoomID != room.ID {
+			t.Errorf("Expected Get to report room %s, got %+v", room.ID, got)
+		}
+	})
+
+	t.Run("Update keeps the room", func(t *testing.T) {
+		updated, _ := s.Update(ctx, inRoom.ID, CreateMessageRequest{From: "Tom", Text: "edited", RoomID: DefaultRoomID})
+		if updated.RoomID != room.ID {
+			t.Errorf("Expected the message to stay in %s, got %s", room.ID, updated.RoomID)
+		}
+		updatedRoom, err := s.UpdateRoom(ctx, room.ID, CreateRoomRequest{Name: "Renamed"})
+		if err != nil || updatedRoom.Name != "Renamed" || updatedRoom.Topic != "" {
+			t.Errorf("Expected the renamed room, got %+v, %v", updatedRoom, err)
+		}
+	})
+
+	t.Run("Rooms are listed default first", func(t *testing.T) {
+		second, _ := s.CreateRoom(ctx, CreateRoomRequest{Name: "Second"})
+		rooms, _ := s.ListRooms(ctx)
+		if len(rooms) != 3 || rooms[0].ID != DefaultRoomID || rooms[1].ID != room.ID || rooms[2].ID != second.ID {
+			t.Errorf("Expected general, %s, %s, got %+v", room.ID, second.ID, rooms)
+		}
+	})
+
+	t.Run("Deleting a room deletes its messages", func(t *testing.T) {
+		if err := s.DeleteRoom(ctx, room.ID); err != nil {
+			t.Fatalf("DeleteRoom returned error: %v", err)
+		}
+		if _, err := s.Get(ctx, inRoom.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected the room's message to be gone, got %v", err)
+		}
+		if _, err := s.Get(ctx, inGeneral.ID); err != nil {
+			t.Errorf("Expected other rooms to keep their messages, got %v", err)
+		}
+	})
+
+	t.Run("Unknown rooms", func(t *testing.T) {
+		if _, err := s.Create(ctx, CreateMessageRequest{From: "a", Text: "b", RoomID: "missing"}); !errors.Is(err, ErrRoomNotFound) {
+			t.Errorf("Create: expected ErrRoomNotFound, got %v", err)
+		}
+		if _, err := s.List(ctx, "missing"); !errors.Is(err, ErrRoomNotFound) {
+			t.Errorf("List: expected ErrRoomNotFound, got %v", err)
+		}
+		if _, err := s.ListPage(ctx, "missing", PageQuery{Limit: 1}); !errors.Is(err, ErrRoomNotFound) {
+			t.Errorf("ListPage: expected ErrRoomNotFound, got %v", err)
+		}
+		if _, err := searchFor(s, "missing", search.Term("x")); !errors.Is(err, ErrRoomNotFound) {
+			t.Errorf("Search: expected ErrRoomNotFound, got %v", err)
+		}
+		if _, err := s.UpdateRoom(ctx, "missing", CreateRoomRequest{Name: "x"}); !errors.Is(err, ErrRoomNotFound) {
+			t.Errorf("UpdateRoom: expected ErrRoomNotFound, got %v", err)
+		}
+		if err := s.DeleteRoom(ctx, room.ID); !errors.Is(err, ErrRoomNotFound) {
+			t.Errorf("DeleteRoom: expected ErrRoomNotFound, got %v", err)
+		}
+		if err := s.DeleteRoom(ctx, DefaultRoomID); !errors.Is(err, ErrDefaultRoom) {
+			t.Errorf("DeleteRoom: expected ErrDefaultRoom, got %v", err)
+		}
+	})
+}
+
+// testReplies checks threads and tombstones against any MessageStore
+// implementation.
+func testReplies(t *testing.T, s MessageStore) {
+	ctx := context.Background()
+
+	parent, _ := s.Create(ctx, CreateMessageRequest{From: "Tom", Text: "Who is in?"})
+	var replies []Message
+	for _, from := range []string{"Ann", "Bob", "Cid"} {
+		reply, err := s.Create(ctx, CreateMessageRequest{From: from, Text: "Me", ParentID: parent.ID})
+		if err != nil {
+			t.Fatalf("Create reply returned error: %v", err)
+		}
+		if reply.ParentID != parent.ID {
+			t.Errorf("Expected a reply to %s, got %+v", parent.ID, reply)
+		}
+		replies = append(replies, reply)
+	}
+
+	t.Run("Replies are counted and listed", func(t *testing.T) {
+		if got, _ := s.Get(ctx, parent.ID); got.ReplyCount != 3 {
+			t.Errorf("Expected 3 replies, got %d", got.ReplyCount)
+		}
+		all, _ := s.List(ctx, DefaultRoomID)
+		if len(all) != 4 || all[0].ReplyCount != 3 || all[1].ReplyCount != 0 {
+			t.Errorf("Expected List to carry reply counts, got %+v", all)
+		}
+
+		page, err := s.Replies(ctx, parent.ID, PageQuery{Limit: 2})
+		if err != nil || len(page.Messages) != 2 || page.Messages[0].ID != replies[0].ID || page.Next != replies[1].ID {
+			t.Fatalf("Expected the first two replies, got %+v, %v", page, err)
+		}
+		page, _ = s.Replies(ctx, parent.ID, PageQuery{Limit: 2, After: page.Next})
+		if len(page.Messages) != 1 || page.Messages[0].ID != replies[2].ID || page.Next != "" || page.Prev == "" {
+			t.Errorf("Expected the last reply, got %+v", page)
+		}
+		page, err = s.Replies(ctx, replies[0].ID, PageQuery{Limit: 2})
+		if err != nil || len(page.Messages) != 0 {
+			t.Errorf("Expected no replies to a reply, got %+v, %v", page, err)
+		}
+		if _, err := s.Replies(ctx, "missing", PageQuery{Limit: 2}); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound, got %v", err)
+		}
+	})
+
+	t.Run("Parents must exist in the same room", func(t *testing.T) {
+		room, _ := s.CreateRoom(ctx, CreateRoomRequest{Name: "Other"})
+		for _, req := range []CreateMessageRequest{
+			{From: "a", Text: "b", ParentID: "missing"},
+			{From: "a", Text: "b", ParentID: parent.ID, RoomID: room.ID},
+		} {
+			if _, err := s.Create(ctx, req); !errors.Is(err, ErrParentNotFound) {
+				t.Errorf("Expected ErrParentNotFound for %+v, got %v", req, err)
+			}
+		}
+	})
+
+	t.Run("Deleting a parent leaves a tombstone", func(t *testing.T) {
+		if err := s.Delete(ctx, parent.ID, 0); err != nil {
+			t.Fatalf("Delete returned error: %v", err)
+		}
+		tomb, err := s.Get(ctx, parent.ID)
+		if err != nil || tomb.DeletedAt == nil || tomb.Text != "" || tomb.From != "" || tomb.ReplyCount != 3 {
+			t.Fatalf("Expected a tombstone with its replies, got %+v, %v", tomb, err)
+		}
+		if page, _ := s.Replies(ctx, parent.ID, PageQuery{Limit: 10}); len(page.Messages) != 3 {
+			t.Errorf("Expected the thread to stay intact, got %+v", page)
+		}
+
+		if _, err := s.Update(ctx, parent.ID, CreateMessageRequest{From: "Tom", Text: "Back"}); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Update: expected ErrNotFound for a tombstone, got %v", err)
+		}
+		if err := s.Delete(ctx, parent.ID, 0); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Delete: expected ErrNotFound for a tombstone, got %v", err)
+		}
+		if _, err := s.Create(ctx, CreateMessageRequest{From: "a", Text: "b", ParentID: parent.ID}); !errors.Is(err, ErrParentNotFound) {
+			t.Errorf("Create: expected ErrParentNotFound for a tombstone, got %v", err)
+		}
+	})
+
+	t.Run("Deleting a reply removes it", func(t *testing.T) {
+		if err := s.Delete(ctx, replies[1].ID, 0); err != nil {
+			t.Fatalf("Delete returned error: %v", err)
+		}
+		if _, err := s.Get(ctx, replies[1].ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected the reply to be gone, got %v", err)
+		}
+		if got, _ := s.Get(ctx, parent.ID); got.ReplyCount != 2 {
+			t.Errorf("Expected 2 replies left, got %d", got.ReplyCount)
+		}
+	})
+}
+
+// testReactions checks reactions against any MessageStore implementation.
+func testReactions(t *testing.T, s MessageStore) {
+	ctx := context.Background()
+
+	m, _ := s.Create(ctx, CreateMessageRequest{From: "Tom", Text: "Lunch?"})
+	if m.Reactions == nil || len(m.Reactions) != 0 {
+		t.Errorf("Expected an empty reaction map, got %#v", m.Reactions)
+	}
+
+	t.Run("Reactions are deduplicated per user", func(t *testing.T) {
+		for _, r := range []struct {
+			emoji, user string
+			added       bool
+		}{
+			{"👍", "Ann", true},
+			{"👍", "Bob", true},
+			{"👍", "Ann", false},
+			{"🍕", "Ann", true},
+		} {
+			_, added, err := s.React(ctx, m.ID, r.emoji, r.user)
+			if err != nil || added != r.added {
+				t.Errorf("React(%s, %s): expected added=%v, got %v, %v", r.emoji, r.user, r.added, added, err)
+			}
+		}
+
+		got, _ := s.Get(ctx, m.ID)
+		if len(got.Reactions) != 2 || got.Reactions["👍"] != 2 || got.Reactions["🍕"] != 1 {
+			t.Errorf("Expected 2 thumbs up and 1 pizza, got %v", got.Reactions)
+		}
+		all, _ := s.List(ctx, DefaultRoomID)
+		page, _ := s.ListPage(ctx, DefaultRoomID, PageQuery{Limit: 10})
+		if all[len(all)-1].Reactions["👍"] != 2 || page.Messages[len(page.Messages)-1].Reactions["👍"] != 2 {
+			t.Errorf("Expected lists to carry reaction counts, got %v and %v", all, page.Messages)
+		}
+	})
+
+	t.Run("Unreact", func(t *testing.T) {
+		if err := s.Unreact(ctx, m.ID, "🍕", "Ann"); err != nil {
+			t.Fatalf("Unreact returned error: %v", err)
+		}
+		if err := s.Unreact(ctx, m.ID, "🍕", "Ann"); !errors.Is(err, ErrReactionNotFound) {
+			t.Errorf("Expected ErrReactionNotFound, got %v", err)
+		}
+		if got, _ := s.Get(ctx, m.ID); len(got.Reactions) != 1 || got.Reactions["👍"] != 2 {
+			t.Errorf("Expected only the thumbs up left, got %v", got.Reactions)
+		}
+	})
+
+	t.Run("Missing and deleted messages", func(t *testing.T) {
+		if _, _, err := s.React(ctx, "missing", "👍", "Ann"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("React: expected ErrNotFound, got %v", err)
+		}
+		if err := s.Unreact(ctx, "missing", "👍", "Ann"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Unreact: expected ErrNotFound, got %v", err)
+		}
+
+		reply, _ := s.Create(ctx, CreateMessageRequest{From: "Ann", Text: "Yes", ParentID: m.ID})
+		s.React(ctx, reply.ID, "👍", "Tom")
+		s.Delete(ctx, m.ID, 0)
+		if got, _ := s.Get(ctx, m.ID); len(got.Reactions) != 0 {
+			t.Errorf("Expected a tombstone without reactions, got %v", got.Reactions)
+		}
+		if _, _, err := s.React(ctx, m.ID, "👍", "Ann"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound reacting to a tombstone, got %v", err)
+		}
+		if got, _ := s.Get(ctx, reply.ID); got.Reactions["👍"] != 1 {
+			t.Errorf("Expected the reply to keep its reactions, got %v", got.Reactions)
+		}
+	})
+}
+
+// testRevisions checks edit history against any MessageStore
+// implementation.
+func testRevisions(t *testing.T, s MessageStore) {
+	ctx := context.Background()
+
+	m, _ := s.Create(ctx, CreateMessageRequest{From: "Tom", Text: "Helo"})
+	if m.EditedAt != nil {
+		t.Errorf("Expected a new message not to be edited, got %v", m.EditedAt)
+	}
+
+	first, _ := s.Update(ctx, m.ID, CreateMessageRequest{From: "Tom", Text: "Hello"})
+	second, _ := s.Update(ctx, m.ID, CreateMessageRequest{From: "Tommy", Text: "Hello", Editor: "Mod"})
+	unchanged, _ := s.Update(ctx, m.ID, CreateMessageRequest{From: "Tommy", Text: "Hello"})
+
+	t.Run("Edits are recorded", func(t *testing.T) {
+		if first.EditedAt == nil || second.EditedAt == nil || second.EditedAt.Before(*first.EditedAt) {
+			t.Fatalf("Expected increasing edit times, got %v and %v", first.EditedAt, second.EditedAt)
+		}
+		if !unchanged.EditedAt.Equal(*second.EditedAt) {
+			t.Errorf("Expected an unchanged update to keep edited_at, got %v", unchanged.EditedAt)
+		}
+		if !second.TimeSent.Equal(m.TimeSent) {
+			t.Errorf("Expected time_sent to stay %v, got %v", m.TimeSent, second.TimeSent)
+		}
+
+		revisions, err := s.Revisions(ctx, m.ID)
+		if err != nil || len(revisions) != 2 {
+			t.Fatalf("Expected 2 revisions, got %+v, %v", revisions, err)
+		}
+		want := []Revision{
+			{MessageID: m.ID, Number: 1, EditedAt: *first.EditedAt, Editor: "Tom", From: "Tom", Text: "Helo"},
+			{MessageID: m.ID, Number: 2, EditedAt: *second.EditedAt, Editor: "Mod", From: "Tom", Text: "Hello"},
+		}
+		for i, got := range revisions {
+			if got.MessageID != want[i].MessageID || got.Number != want[i].Number || !got.EditedAt.Equal(want[i].EditedAt) ||
+				got.Editor != want[i].Editor || got.From != want[i].From || got.Text != want[i].Text {
+				t.Errorf("Revision %d: expected %+v, got %+v", i, want[i], got)
+			}
+		}
+	})
+
+	t.Run("Unedited and missing messages", func(t *testing.T) {
+		other, _ := s.Create(ctx, CreateMessageRequest{From: "Ann", Text: "Hi"})
+		if revisions, err := s.Revisions(ctx, other.ID); err != nil || len(revisions) != 0 {
+			t.Errorf("Expected no revisions, got %+v, %v", revisions, err)
+		}
+		if _, err := s.Revisions(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound, got %v", err)
+		}
+	})
+
+	t.Run("Tombstones drop their history", func(t *testing.T) {
+		s.Create(ctx, CreateMessageRequest{From: "Ann", Text: "Hi", ParentID: m.ID})
+		s.Delete(ctx, m.ID, 0)
+		if revisions, err := s.Revisions(ctx, m.ID); err != nil || len(revisions) != 0 {
+			t.Errorf("Expected no revisions on a tombstone, got %+v, %v", revisions, err)
+		}
+		if got, _ := s.Get(ctx, m.ID); got.EditedAt != nil {
+			t.Errorf("Expected the tombstone to drop edited_at, got %v", got.EditedAt)
+		}
+	})
+}
+
+// testSoftDelete checks tombstones, Restore and Purge against any
+// MessageStore implementation.
+func testSoftDelete(t *testing.T, s MessageStore) {
+	ctx := context.Background()
+
+	m, _ := s.Create(ctx, CreateMessageRequest{From: "Tom", Text: "Typo"})
+	s.Update(ctx, m.ID, CreateMessageRequest{From: "Tom", Text: "Fixed"})
+	s.React(ctx, m.ID, "👍", "Ann")
+
+	t.Run("Deleted messages are hidden", func(t *testing.T) {
+		if err := s.Delete(ctx, m.ID, 0); err != nil {
+			t.Fatalf("Delete returned error: %v", err)
+		}
+		if _, err := s.Get(ctx, m.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get: expected ErrNotFound, got %v", err)
+		}
+		if _, err := s.Revisions(ctx, m.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Revisions: expected ErrNotFound, got %v", err)
+		}
+		if all, _ := s.List(ctx, DefaultRoomID); len(all) != 0 {
+			t.Errorf("List: expected no messages, got %+v", all)
+		}
+		if page, _ := s.ListPage(ctx, DefaultRoomID, PageQuery{Limit: 10}); len(page.Messages) != 0 {
+			t.Errorf("ListPage: expected no messages, got %+v", page)
+		}
+		if found, _ := searchFor(s, DefaultRoomID, search.Term("fixed")); len(found) != 0 {
+			t.Errorf("Search: expected no messages, got %+v", found)
+		}
+	})
+
+	t.Run("Restore brings everything back", func(t *testing.T) {
+		got, restored, err := s.Restore(ctx, m.ID)
+		if err != nil || !restored || got.DeletedAt != nil || got.Text != "Fixed" || got.Reactions["👍"] != 1 {
+			t.Fatalf("Expected the restored message, got %+v, %v, %v", got, restored, err)
+		}
+		if revisions, _ := s.Revisions(ctx, m.ID); len(revisions) != 1 || revisions[0].Text != "Typo" {
+			t.Errorf("Expected the revision to be kept, got %+v", revisions)
+		}
+		if _, restored, err := s.Restore(ctx, m.ID); err != nil || restored {
+			t.Errorf("Expected restoring a live message to change nothing, got %v, %v", restored, err)
+		}
+		if _, _, err := s.Restore(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound, got %v", err)
+		}
+	})
+
+	t.Run("Purge removes old tombstones without replies", func(t *testing.T) {
+		parent, _ := s.Create(ctx, CreateMessageRequest{From: "Tom", Text: "Who is in?"})
+		reply, _ := s.Create(ctx, CreateMessageRequest{From: "Ann", Text: "Me", ParentID: parent.ID})
+		s.Delete(ctx, m.ID, 0)
+		s.Delete(ctx, parent.ID, 0)
+
+		if n, err := s.Purge(ctx, time.Now().Add(-time.Hour)); err != nil || n != 0 {
+			t.Errorf("Expected nothing to be old enough, got %d, %v", n, err)
+		}
+		if n, err := s.Purge(ctx, time.Now().Add(time.Second)); err != nil || n != 1 {
+			t.Errorf("Expected the parent to be kept for its reply, got %d, %v", n, err)
+		}
+		if _, _, err := s.Restore(ctx, m.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected a purged message to be gone, got %v", err)
+		}
+
+		s.Delete(ctx, reply.ID, 0)
+		if n, err := s.Purge(ctx, time.Now().Add(time.Second)); err != nil || n != 2 {
+			t.Errorf("Expected the reply and then its parent to be purged, got %d, %v", n, err)
+		}
+		if _, _, err := s.Restore(ctx, parent.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected the parent to be gone, got %v", err)
+		}
+	})
+}
+
+// testVersions checks that edits, deletes and restores bump a message's
+// version and that stale versions are refused.
+func testVersions(t *testing.T, s MessageStore) {
+	ctx := context.Background()
+
+	m, _ := s.Create(ctx, CreateMessageRequest{From: "Tom", Text: "One"})
+	if m.Version != 1 {
+		t.Fatalf("Expected a new message at version 1, got %d", m.Version)
+	}
+
+	t.Run("Edits bump the version", func(t *testing.T) {
+		edited, err := s.Update(ctx, m.ID, CreateMessageRequest{From: "Tom", Text: "Two", Version: 1})
+		if err != nil || edited.Version != 2 {
+			t.Fatalf("Expected version 2, got %+v, %v", edited, err)
+		}
+		if unchanged, _ := s.Update(ctx, m.ID, CreateMessageRequest{From: "Tom", Text: "Two"}); unchanged.Version != 2 {
+			t.Errorf("Expected an unchanged update to keep version 2, got %d", unchanged.Version)
+		}
+		s.React(ctx, m.ID, "👍", "Ann")
+		if got, _ := s.Get(ctx, m.ID); got.Version != 2 {
+			t.Errorf("Expected a reaction to keep version 2, got %d", got.Version)
+		}
+	})
+
+	t.Run("Stale versions are refused", func(t *testing.T) {
+		if _, err := s.Update(ctx, m.ID, CreateMessageRequest{From: "Tom", Text: "Stale", Version: 1}); !errors.Is(err, ErrVersionMismatch) {
+			t.Errorf("Expected ErrVersionMismatch from Update, got %v", err)
+		}
+		if err := s.Delete(ctx, m.ID, 1); !errors.Is(err, ErrVersionMismatch) {
+			t.Errorf("Expected ErrVersionMismatch from Delete, got %v", err)
+		}
+		if got, _ := s.Get(ctx, m.ID); got.Text != "Two" || got.Version != 2 {
+			t.Errorf("Expected the message to be unchanged, got %+v", got)
+		}
+	})
+
+	t.Run("Delete and restore bump the version", func(t *testing.T) {
+		if err := s.Delete(ctx, m.ID, 2); err != nil {
+			t.Fatalf("Delete returned error: %v", err)
+		}
+		restored, _, err := s.Restore(ctx, m.ID)
+		if err != nil || restored.Version != 4 {
+			t.Errorf("Expected version 4 after delete and restore, got %+v, %v", restored, err)
+		}
+	})
+}
+
+// testFilters checks the filters and sort orders of ListPage against any
+// MessageStore implementation.
+func testFilters(t *testing.T, s MessageStore) {
+	ctx := context.Background()
+
+	var messages []Message
+	for i, from := range []string{"Tom", "Ann", "Tom", "Ann", "Tom", "Ann"} {
+		m, err := s.Create(ctx, CreateMessageRequest{From: from, Text: fmt.Sprintf("Message %d", i)})
+		if err != nil {
+			t.Fatalf("Create returned error: %v", err)
+		}
+		messages = append(messages, m)
+	}
+	ids := func(indexes ...int) []string {
+		var want []string
+		for _, i := range indexes {
+			want = append(want, messages[i].ID)
+		}
+		return want
+	}
+	list := func(t *testing.T, q PageQuery, want []string) Page {
+		t.Helper()
+		if q.Limit == 0 {
+			q.Limit = 10
+		}
+		p, err := s.ListPage(ctx, DefaultRoomID, q)
+		if err != nil {
+			t.Fatalf("ListPage returned error: %v", err)
+		}
+		var got []string
+		for _, m := range p.Messages {
+			got = append(got, m.ID)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("Expected IDs %v, got %v", want, got)
+		}
+		return p
+	}
+
+	t.Run("Filter by sender", func(t *testing.T) {
+		list(t, PageQuery{From: "Ann"}, ids(1, 3, 5))
+		list(t, PageQuery{From: "Nobody"}, nil)
+	})
+
+	t.Run("Filter by time", func(t *testing.T) {
+		list(t, PageQuery{Since: messages[2].TimeSent, Until: messages[4].TimeSent}, ids(2, 3))
+		list(t, PageQuery{Since: messages[4].TimeSent, From: "Ann"}, ids(5))
+	})
+
+	t.Run("Newest first, page by page", func(t *testing.T) {
+		first := list(t, PageQuery{Sort: SortByTimeDesc, Limit: 4}, ids(5, 4, 3, 2))
+		if first.Next == "" || first.Prev != "" {
+			t.Fatalf("Expected only a next cursor, got %+v", first)
+		}
+		second := list(t, PageQuery{Sort: SortByTimeDesc, Limit: 4, After: first.Next}, ids(1, 0))
+		if second.Next != "" || second.Prev == "" {
+			t.Fatalf("Expected only a prev cursor, got %+v", second)
+		}
+		list(t, PageQuery{Sort: SortByTimeDesc, Limit: 4, Before: second.Prev}, ids(5, 4, 3, 2))
+		list(t, PageQuery{Sort: SortByTimeDesc, From: "Tom"}, ids(4, 2, 0))
+	})
+
+	t.Run("Oldest first, page by page", func(t *testing.T) {
+		first := list(t, PageQuery{Sort: SortByTime, Limit: 4}, ids(0, 1, 2, 3))
+		list(t, PageQuery{Sort: SortByTime, Limit: 4, After: first.Next}, ids(4, 5))
+	})
+
+	t.Run("Cursors from another order are refused", func(t *testing.T) {
+		_, err := s.ListPage(ctx, DefaultRoomID, PageQuery{Limit: 10, Sort: SortByTime, After: messages[0].ID})
+		if !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("Expected ErrInvalidCursor, got %v", err)
+		}
+	})
+}
+
+// testSearch checks that Search follows messages as they are created,
+// edited, deleted and restored, and filters and pages its results, against
+// any MessageStore implementation.
+func testSearch(t *testing.T, s MessageStore) {
+	ctx := context.Background()
+
+	find := func(t *testing.T, query string) []SearchResult {
+		t.Helper()
+		q, err := search.Parse(query)
+		if err != nil {
+			t.Fatalf("Parse(%q) returned error: %v", query, err)
+		}
+		results, err := searchFor(s, DefaultRoomID, q)
+		if err != nil {
+			t.Fatalf("Search returned error: %v", err)
+		}
+		return results
+	}
+
+	tea, _ := s.Create(ctx, CreateMessageRequest{From: "Tom", Text: "Tea at the Café?"})
+	more, _ := s.Create(ctx, CreateMessageRequest{From: "Ann", Text: "Tea, tea and more tea"})
+	s.Create(ctx, CreateMessageRequest{From: "Ann", Text: "Coffee for me"})
+
+	t.Run("Ranked and highlighted", func(t *testing.T) {
+		results := find(t, "TEA")
+		if len(results) != 2 || results[0].ID != more.ID || results[0].Score <= results[1].Score {
+			t.Fatalf("Expected the message repeating tea first, got %+v", results)
+		}
+		results = find(t, "cafe OR coffee")
+		if len(results) != 2 {
+			t.Fatalf("Expected 2 results, got %+v", results)
+		}
+		for _, r := range results {
+			if r.ID == tea.ID && r.Highlight != "Tea at the <mark>Café</mark>?" {
+				t.Errorf("Unexpected highlight %q", r.Highlight)
+			}
+		}
+	})
+
+	t.Run("Edits, deletes and restores are indexed", func(t *testing.T) {
+		s.Update(ctx, tea.ID, CreateMessageRequest{From: "Tom", Text: "Lunch at noon"})
+		if results := find(t, "lunch"); len(results) != 1 || results[0].Text != "Lunch at noon" {
+			t.Errorf("Expected the edited message, got %+v", results)
+		}
+		if results := find(t, "cafe"); len(results) != 0 {
+			t.Errorf("Expected the old text to be gone, got %+v", results)
+		}
+
+		s.Delete(ctx, more.ID, 0)
+		if results := find(t, "tea"); len(results) != 0 {
+			t.Errorf("Expected the deleted message to be gone, got %+v", results)
+		}
+		s.Restore(ctx, more.ID)
+		if results := find(t, "tea"); len(results) != 1 || results[0].ID != more.ID {
+			t.Errorf("Expected the restored message, got %+v", results)
+		}
+	})
+
+	reply, _ := s.Create(ctx, CreateMessageRequest{From: "Bob", Text: "Green tea for me", ParentID: more.ID})
+	s.React(ctx, reply.ID, "👍", "Ann")
+
+	t.Run("Filters are checked on the hits", func(t *testing.T) {
+		for query, want := range map[string]string{
+			"tea from:ANN":          more.ID,
+			"tea -from:ann":         reply.ID,
+			"tea has:reply":         more.ID,
+			"tea has:reaction":      reply.ID,
+			`"for me" -coffee`:      reply.ID,
+			"tea before:2000-01-01": "",
+		} {
+			results := find(t, query)
+			var got string
+			if len(results) == 1 {
+				got = results[0].ID
+			}
+			if got != want || len(results) > 1 {
+				t.Errorf("%s: expected %q, got %+v", query, want, results)
+			}
+		}
+	})
+
+	t.Run("Pages of results", func(t *testing.T) {
+		q := SearchQuery{Query: search.Term("tea"), Limit: 1}
+		first, err := s.Search(ctx, DefaultRoomID, q)
+		if err != nil || len(first.Results) != 1 || first.Next == "" || first.Prev != "" {
+			t.Fatalf("Expected a first page with a next cursor, got %+v, %v", first, err)
+		}
+		q.After = first.Next
+		second, _ := s.Search(ctx, DefaultRoomID, q)
+		if len(second.Results) != 1 || second.Results[0].ID == first.Results[0].ID || second.Next != "" || second.Prev == "" {
+			t.Fatalf("Expected a last page with the other result, got %+v", second)
+		}
+		q.After, q.Before = "", second.Prev
+		if back, _ := s.Search(ctx, DefaultRoomID, q); len(back.Results) != 1 || back.Results[0].ID != first.Results[0].ID {
+			t.Errorf("Expected the first page again, got %+v", back)
+		}
+
+		// Filtered hits do not count towards a page.
+		q.Query, _ = search.Parse("tea -from:ann")
+		q.Before = ""
+		if page, _ := s.Search(ctx, DefaultRoomID, q); len(page.Results) != 1 || page.Next != "" {
+			t.Errorf("Expected a single page, got %+v", page)
+		}
+
+		q.After = "first"
+		if _, err := s.Search(ctx, DefaultRoomID, q); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("Expected ErrInvalidCursor, got %v", err)
+		}
+	})
+}
+
+// searchFor returns the first page of results for q in room roomID.
+func searchFor(s MessageStore, roomID string, q search.Query) ([]SearchResult, error) {
+	page, err := s.Search(context.Background(), roomID, SearchQuery{Query: q, Limit: 50})
+	return page.Results, err
+}
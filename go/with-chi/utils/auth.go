@@ -0,0 +1,28 @@
+package utils
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// RequireBearer is middleware that only lets through requests carrying
+// "Authorization: Bearer <token>". An empty token turns the routes off
+// rather than leaving them open.
+func RequireBearer(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if token == "" {
+				WriteProblem(w, http.StatusForbidden, CodeForbidden, "Admin endpoints are disabled on this server.")
+				return
+			}
+			given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+				WriteProblem(w, http.StatusUnauthorized, CodeUnauthorized, "A valid admin token is required.")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// VersionETag returns the strong entity tag of a resource at version.
+// Parts of the resource that change without a new version are hashed in
+// from state, so that the tag changes whenever the representation does.
+func VersionETag(version int, state ...any) string {
+	tag := strconv.Itoa(version)
+	if len(state) > 0 {
+		data, _ := json.Marshal(state)
+		sum := sha256.Sum256(data)
+		tag += "-" + hex.EncodeToString(sum[:8])
+	}
+	return `"` + tag + `"`
+}
+
+// ContentETag returns a weak entity tag derived from the JSON encoding of
+// v, for responses such as lists that have no version of their own.
+func ContentETag(v any) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return `W/"` + hex.EncodeToString(sum[:16]) + `"`, nil
+}
+
+// IfMatch reports whether the If-Match header of r lets a change to a
+// resource whose current entity tag is etag go ahead. An absent header
+// always does; otherwise tags are compared strongly, so weak ones never
+// match.
+func IfMatch(r *http.Request, etag string) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return true
+	}
+	for _, tag := range parseETags(header) {
+		if tag == "*" || (!strings.HasPrefix(tag, "W/") && tag == etag) {
+			return true
+		}
+	}
+	return false
+}
+
+// NotModified reports whether the If-None-Match header of r lists etag,
+// compared weakly, so that a GET can answer 304 Not Modified.
+func NotModified(r *http.Request, etag string) bool {
+	header := r.Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+	for _, tag := range parseETags(header) {
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// parseETags splits a comma-separated list of entity tags, which may
+// themselves contain commas inside their quotes.
+func parseETags(header string) []string {
+	var tags []string
+	for header != "" {
+		header = strings.TrimLeft(header, " \t,")
+		if header == "" {
+			break
+		}
+		if header[0] == '*' {
+			tags = append(tags, "*")
+			header = header[1:]
+			continue
+		}
+		start := 0
+		if strings.HasPrefix(header, "W/") {
+			start = 2
+		}
+		if len(header) <= start || header[start] != '"' {
+			// Not an entity tag; skip to the next list element.
+			_, header, _ = strings.Cut(header, ",")
+			continue
+		}
+		end := strings.IndexByte(header[start+1:], '"')
+		if end < 0 {
+			break
+		}
+		end += start + 2
+		tags = append(tags, header[:end])
+		header = header[end:]
+	}
+	return tags
+}
@@ -0,0 +1,146 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxBodyBytes caps the size of JSON request bodies.
+const MaxBodyBytes = 1 << 20
+
+// BodyError explains why a request body was rejected and maps onto a
+// problem response.
+type BodyError struct {
+	Status int
+	Code   ProblemCode
+	Detail string
+	Errors []FieldError
+}
+
+func (e *BodyError) Error() string {
+	return e.Detail
+}
+
+// WriteBodyError writes err as a problem response; errors that are not a
+// *BodyError become a 500.
+func WriteBodyError(w http.ResponseWriter, err error) error {
+	var bodyErr *BodyError
+	if !errors.As(err, &bodyErr) {
+		return WriteProblem(w, http.StatusInternalServerError, CodeInternal, "The request body could not be read.")
+	}
+	return WriteProblem(w, bodyErr.Status, bodyErr.Code, bodyErr.Detail, bodyErr.Errors...)
+}
+
+// ParseJSON strictly decodes an application/json body into payload. The
+// body must be a single JSON value of at most MaxBodyBytes with no fields
+// payload does not declare. Failures are returned as *BodyError.
+func ParseJSON(w http.ResponseWriter, r *http.Request, payload any) error {
+	return ParseJSONAs(w, r, payload, "application/json")
+}
+
+// ParseJSONAs is ParseJSON for endpoints that accept other JSON media
+// types, such as application/merge-patch+json.
+func ParseJSONAs(w http.ResponseWriter, r *http.Request, payload any, mediaTypes ...string) error {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || !slices.Contains(mediaTypes, mediaType) {
+		return &BodyError{
+			Status: http.StatusUnsupportedMediaType,
+			Code:   CodeUnsupportedMediaType,
+			Detail: fmt.Sprintf("Content-Type must be %s.", strings.Join(mediaTypes, " or ")),
+		}
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MaxBodyBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return &BodyError{
+				Status: http.StatusRequestEntityTooLarge,
+				Code:   CodePayloadTooLarge,
+				Detail: fmt.Sprintf("The request body must not exceed %d bytes.", MaxBodyBytes),
+			}
+		}
+		return err
+	}
+	return DecodeJSON(body, payload)
+}
+
+// DecodeJSON applies ParseJSON's rules to a body that has already been
+// read, such as a WebSocket frame.
+func DecodeJSON(body []byte, payload any) error {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return invalidBody("The request body is empty.")
+	}
+	// encoding/json would silently replace bad bytes with U+FFFD.
+	if !utf8.Valid(body) {
+		return invalidBody("The request body is not valid UTF-8.")
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(payload); err != nil {
+		return decodeError(body, err)
+	}
+	end := decoder.InputOffset()
+	if rest := bytes.TrimLeft(body[end:], " \t\r\n"); len(rest) > 0 {
+		line, col := position(body, int64(len(body)-len(rest)))
+		return invalidBody(fmt.Sprintf("Unexpected data after the JSON value at line %d, column %d.", line, col))
+	}
+	return nil
+}
+
+func decodeError(body []byte, err error) error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+
+	switch {
+	case errors.As(err, &syntaxErr):
+		// Offset counts the offending byte; point at it rather than past it.
+		line, col := position(body, syntaxErr.Offset-1)
+		return invalidBody(fmt.Sprintf("Malformed JSON at line %d, column %d: %v.", line, col, syntaxErr))
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		line, col := position(body, int64(len(body)))
+		return invalidBody(fmt.Sprintf("Malformed JSON: unexpected end of input at line %d, column %d.", line, col))
+	case errors.As(err, &typeErr):
+		line, col := position(body, typeErr.Offset)
+		return invalidBody(
+			fmt.Sprintf("Wrong type at line %d, column %d.", line, col),
+			FieldError{Field: typeErr.Field, Code: FieldInvalid, Message: fmt.Sprintf("%s must be a %s", typeErr.Field, typeErr.Type)},
+		)
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		return invalidBody(
+			fmt.Sprintf("Unknown field %q.", field),
+			FieldError{Field: field, Code: FieldUnknown, Message: field + " is not a recognised field"},
+		)
+	default:
+		return invalidBody(err.Error())
+	}
+}
+
+func invalidBody(detail string, fieldErrors ...FieldError) *BodyError {
+	return &BodyError{
+		Status: http.StatusBadRequest,
+		Code:   CodeInvalidBody,
+		Detail: detail,
+		Errors: fieldErrors,
+	}
+}
+
+// position converts a byte offset into a 1-based line and column.
+func position(body []byte, offset int64) (line, col int) {
+	offset = min(offset, int64(len(body)))
+	before := body[:offset]
+	line = bytes.Count(before, []byte("\n")) + 1
+	col = int(offset) - bytes.LastIndexByte(before, '\n')
+	return line, col
+}
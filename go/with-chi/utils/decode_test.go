@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type decodeTarget struct {
+	From string `json:"from"`
+	Text string `json:"text"`
+}
+
+// Testing the strict request body decoder
+func TestParseJSON(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+		code        ProblemCode
+		detail      string
+		field       string
+	}{
+		{name: "valid body", contentType: "application/json", body: `{"from":"Tom","text":"Hi"}`},
+		{name: "charset parameter is allowed", contentType: "application/json; charset=utf-8", body: `{"from":"Tom"}`},
+		{name: "missing content type", body: `{}`, status: 415, code: CodeUnsupportedMediaType},
+		{name: "wrong content type", contentType: "text/plain", body: `{}`, status: 415, code: CodeUnsupportedMediaType},
+		{name: "empty body", contentType: "application/json", body: "  ", status: 400, code: CodeInvalidBody},
+		{name: "malformed JSON", contentType: "application/json", body: "{\n  \"from\": \"Tom\",\n  oops\n}", status: 400, code: CodeInvalidBody, detail: "line 3, column 3"},
+		{name: "truncated JSON", contentType: "application/json", body: `{"from": "Tom"`, status: 400, code: CodeInvalidBody, detail: "unexpected end of input"},
+		{name: "unknown field", contentType: "application/json", body: `{"from":"Tom","admin":true}`, status: 400, code: CodeInvalidBody, field: "admin"},
+		{name: "wrong type", contentType: "application/json", body: `{"from":42}`, status: 400, code: CodeInvalidBody, field: "from"},
+		{name: "trailing data", contentType: "application/json", body: `{"from":"Tom"} {}`, status: 400, code: CodeInvalidBody, detail: "after the JSON value at line 1, column 16"},
+		{name: "oversized body", contentType: "application/json", body: `{"text":"` + strings.Repeat("a", MaxBodyBytes) + `"}`, status: 413, code: CodePayloadTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			rr := httptest.NewRecorder()
+
+			var target decodeTarget
+			err := ParseJSON(rr, req, &target)
+
+			if tt.status == 0 {
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				return
+			}
+
+			bodyErr, ok := err.(*BodyError)
+			if !ok {
+				t.Fatalf("Expected *BodyError, got %T: %v", err, err)
+			}
+			if bodyErr.Status != tt.status || bodyErr.Code != tt.code {
+				t.Errorf("Expected %d %s, got %d %s", tt.status, tt.code, bodyErr.Status, bodyErr.Code)
+			}
+			if !strings.Contains(bodyErr.Detail, tt.detail) {
+				t.Errorf("Expected detail to contain %q, got %q", tt.detail, bodyErr.Detail)
+			}
+			if tt.field != "" && (len(bodyErr.Errors) != 1 || bodyErr.Errors[0].Field != tt.field) {
+				t.Errorf("Expected a field error for %q, got %+v", tt.field, bodyErr.Errors)
+			}
+		})
+	}
+}
@@ -0,0 +1,312 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Media types of the patch formats understood by ApplyMergePatch and
+// ApplyJSONPatch.
+const (
+	MergePatchContentType = "application/merge-patch+json"
+	JSONPatchContentType  = "application/json-patch+json"
+)
+
+// ApplyMergePatch applies an RFC 7386 JSON Merge Patch to doc: members of
+// patch replace those of doc, objects are merged recursively and null
+// removes a member. Both must be valid JSON.
+func ApplyMergePatch(doc, patch []byte) ([]byte, error) {
+	var target, changes any
+	if err := json.Unmarshal(doc, &target); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(patch, &changes); err != nil {
+		return nil, invalidBody("The merge patch is not valid JSON.")
+	}
+	return json.Marshal(mergePatch(target, changes))
+}
+
+func mergePatch(target, patch any) any {
+	changes, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	object, ok := target.(map[string]any)
+	if !ok {
+		object = map[string]any{}
+	}
+	for name, value := range changes {
+		if value == nil {
+			delete(object, name)
+		} else {
+			object[name] = mergePatch(object[name], value)
+		}
+	}
+	return object
+}
+
+// patchOperation is one step of an RFC 6902 JSON Patch.
+type patchOperation struct {
+	Op    string          `json:"op"`
+	Path  *string         `json:"path"`
+	From  *string         `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// ApplyJSONPatch applies an RFC 6902 JSON Patch to doc. The operations run
+// in order and the patch is all or nothing. A malformed patch is reported
+// as a 400 *BodyError; an operation that cannot be applied, including a
+// failed test, as a 409 one.
+func ApplyJSONPatch(doc, patch []byte) ([]byte, error) {
+	var operations []patchOperation
+	if err := DecodeJSON(patch, &operations); err != nil {
+		return nil, err
+	}
+	var root any
+	if err := json.Unmarshal(doc, &root); err != nil {
+		return nil, err
+	}
+
+	for i, op := range operations {
+		var err error
+		if root, err = op.apply(root); err != nil {
+			return nil, patchError(i, op, err)
+		}
+	}
+	return json.Marshal(root)
+}
+
+// malformedError wraps the problems that make an operation invalid whatever
+// document it is applied to.
+type malformedError struct{ field, message string }
+
+func (e malformedError) Error() string { return e.message }
+
+func patchError(i int, op patchOperation, err error) *BodyError {
+	if malformed, ok := err.(malformedError); ok {
+		field := fmt.Sprintf("/%d/%s", i, malformed.field)
+		return invalidBody(
+			fmt.Sprintf("Operation %d is invalid: %s.", i, malformed.message),
+			FieldError{Field: field, Code: FieldInvalid, Message: malformed.message},
+		)
+	}
+	return &BodyError{
+		Status: http.StatusConflict,
+		Code:   CodeConflict,
+		Detail: fmt.Sprintf("Operation %d (%s) could not be applied: %v.", i, op.Op, err),
+	}
+}
+
+func (op patchOperation) apply(root any) (any, error) {
+	if op.Path == nil {
+		return nil, malformedError{"path", "path is required"}
+	}
+	path, err := parsePointer(*op.Path, "path")
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return nil, malformedError{"value", "value is required"}
+		}
+		var value any
+		if err := json.Unmarshal(op.Value, &value); err != nil {
+			return nil, malformedError{"value", "value is not valid JSON"}
+		}
+		switch op.Op {
+		case "add":
+			return add(root, path, value)
+		case "replace":
+			if _, err := get(root, path); err != nil {
+				return nil, err
+			}
+			if len(path) == 0 {
+				return value, nil
+			}
+			return update(root, path, func(container any, key string) (any, error) {
+				return put(container, key, value, false)
+			})
+		default:
+			current, err := get(root, path)
+			if err != nil {
+				return nil, err
+			}
+			if !reflect.DeepEqual(current, value) {
+				return nil, fmt.Errorf("the value at %q is not %s", *op.Path, op.Value)
+			}
+			return root, nil
+		}
+	case "remove":
+		if len(path) == 0 {
+			return nil, malformedError{"path", "the whole document cannot be removed"}
+		}
+		return update(root, path, remove)
+	case "move", "copy":
+		if op.From == nil {
+			return nil, malformedError{"from", "from is required"}
+		}
+		from, err := parsePointer(*op.From, "from")
+		if err != nil {
+			return nil, err
+		}
+		value, err := get(root, from)
+		if err != nil {
+			return nil, err
+		}
+		if op.Op == "copy" {
+			// Round-trip so the copy shares nothing with the original.
+			var clone any
+			data, _ := json.Marshal(value)
+			json.Unmarshal(data, &clone)
+			return add(root, path, clone)
+		}
+		if isPrefix(from, path) {
+			if len(from) == len(path) {
+				return root, nil
+			}
+			return nil, malformedError{"path", "a value cannot be moved into itself"}
+		}
+		if root, err = update(root, from, remove); err != nil {
+			return nil, err
+		}
+		return add(root, path, value)
+	default:
+		return nil, malformedError{"op", fmt.Sprintf("unknown op %q", op.Op)}
+	}
+}
+
+// parsePointer splits an RFC 6901 JSON Pointer into unescaped tokens.
+func parsePointer(pointer, field string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, malformedError{field, fmt.Sprintf("%q is not a JSON Pointer", pointer)}
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+	return tokens, nil
+}
+
+func isPrefix(prefix, path []string) bool {
+	return len(prefix) <= len(path) && reflect.DeepEqual(prefix, path[:len(prefix)])
+}
+
+func add(root any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	return update(root, path, func(container any, key string) (any, error) {
+		return put(container, key, value, true)
+	})
+}
+
+func get(node any, path []string) (any, error) {
+	for _, token := range path {
+		switch container := node.(type) {
+		case map[string]any:
+			child, ok := container[token]
+			if !ok {
+				return nil, fmt.Errorf("there is no member %q", token)
+			}
+			node = child
+		case []any:
+			i, err := arrayIndex(token, len(container)-1)
+			if err != nil {
+				return nil, err
+			}
+			node = container[i]
+		default:
+			return nil, fmt.Errorf("%q is inside a value that is neither an object nor an array", token)
+		}
+	}
+	return node, nil
+}
+
+// update returns node with fn applied to the container that holds the
+// last token of path, which must not be empty.
+func update(node any, path []string, fn func(container any, key string) (any, error)) (any, error) {
+	if len(path) == 1 {
+		return fn(node, path[0])
+	}
+	child, err := get(node, path[:1])
+	if err != nil {
+		return nil, err
+	}
+	child, err = update(child, path[1:], fn)
+	if err != nil {
+		return nil, err
+	}
+	return put(node, path[0], child, false)
+}
+
+// put sets key in container. Inserting into an array shifts the elements
+// after it and accepts "-" for the end; otherwise the key must exist.
+func put(container any, key string, value any, insert bool) (any, error) {
+	switch c := container.(type) {
+	case map[string]any:
+		if _, ok := c[key]; !ok && !insert {
+			return nil, fmt.Errorf("there is no member %q", key)
+		}
+		c[key] = value
+		return c, nil
+	case []any:
+		if !insert {
+			i, err := arrayIndex(key, len(c)-1)
+			if err != nil {
+				return nil, err
+			}
+			c[i] = value
+			return c, nil
+		}
+		if key == "-" {
+			return append(c, value), nil
+		}
+		i, err := arrayIndex(key, len(c))
+		if err != nil {
+			return nil, err
+		}
+		return append(c[:i], append([]any{value}, c[i:]...)...), nil
+	default:
+		return nil, fmt.Errorf("cannot set %q on a value that is neither an object nor an array", key)
+	}
+}
+
+func remove(container any, key string) (any, error) {
+	switch c := container.(type) {
+	case map[string]any:
+		if _, ok := c[key]; !ok {
+			return nil, fmt.Errorf("there is no member %q", key)
+		}
+		delete(c, key)
+		return c, nil
+	case []any:
+		i, err := arrayIndex(key, len(c)-1)
+		if err != nil {
+			return nil, err
+		}
+		return append(c[:i], c[i+1:]...), nil
+	default:
+		return nil, fmt.Errorf("cannot remove %q from a value that is neither an object nor an array", key)
+	}
+}
+
+// arrayIndex parses an array index token no greater than max.
+func arrayIndex(token string, max int) (int, error) {
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || (token != "0" && strings.HasPrefix(token, "0")) {
+		return 0, fmt.Errorf("%q is not an array index", token)
+	}
+	if i > max {
+		return 0, fmt.Errorf("index %d is out of range", i)
+	}
+	return i, nil
+}
@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+const patchDoc = `{"from":"Tom","text":"Hi","tags":["a","b"],"meta":{"pinned":false}}`
+
+// Testing ApplyMergePatch follows RFC 7386
+func TestApplyMergePatch(t *testing.T) {
+	for _, tc := range []struct {
+		name, patch, want string
+	}{
+		{"replace a member", `{"text":"Hello"}`, `{"from":"Tom","text":"Hello","tags":["a","b"],"meta":{"pinned":false}}`},
+		{"null removes a member", `{"tags":null}`, `{"from":"Tom","text":"Hi","meta":{"pinned":false}}`},
+		{"objects are merged", `{"meta":{"pinned":true,"by":"Ann"}}`, `{"from":"Tom","text":"Hi","tags":["a","b"],"meta":{"pinned":true,"by":"Ann"}}`},
+		{"arrays are replaced", `{"tags":["c"]}`, `{"from":"Tom","text":"Hi","tags":["c"],"meta":{"pinned":false}}`},
+		{"a non-object replaces the document", `"text"`, `"text"`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ApplyMergePatch([]byte(patchDoc), []byte(tc.patch))
+			if err != nil {
+				t.Fatalf("ApplyMergePatch returned error: %v", err)
+			}
+			assertJSONEqual(t, got, tc.want)
+		})
+	}
+}
+
+// Testing ApplyJSONPatch follows RFC 6902
+func TestApplyJSONPatch(t *testing.T) {
+	for _, tc := range []struct {
+		name, patch, want string
+	}{
+		{"replace", `[{"op":"replace","path":"/text","value":"Hello"}]`, `{"from":"Tom","text":"Hello","tags":["a","b"],"meta":{"pinned":false}}`},
+		{"add and remove", `[{"op":"add","path":"/tags/1","value":"x"},{"op":"remove","path":"/meta"}]`, `{"from":"Tom","text":"Hi","tags":["a","x","b"]}`},
+		{"append to an array", `[{"op":"add","path":"/tags/-","value":"c"}]`, `{"from":"Tom","text":"Hi","tags":["a","b","c"],"meta":{"pinned":false}}`},
+		{"move and copy", `[{"op":"move","from":"/text","path":"/meta/text"},{"op":"copy","from":"/from","path":"/text"}]`, `{"from":"Tom","text":"Tom","tags":["a","b"],"meta":{"pinned":false,"text":"Hi"}}`},
+		{"a passing test", `[{"op":"test","path":"/meta/pinned","value":false},{"op":"replace","path":"/from","value":"Ann"}]`, `{"from":"Ann","text":"Hi","tags":["a","b"],"meta":{"pinned":false}}`},
+		{"escaped pointers", `[{"op":"add","path":"/a~1b~0c","value":1}]`, `{"from":"Tom","text":"Hi","tags":["a","b"],"meta":{"pinned":false},"a/b~c":1}`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ApplyJSONPatch([]byte(patchDoc), []byte(tc.patch))
+			if err != nil {
+				t.Fatalf("ApplyJSONPatch returned error: %v", err)
+			}
+			assertJSONEqual(t, got, tc.want)
+		})
+	}
+
+	for _, tc := range []struct {
+		name, patch string
+		status      int
+	}{
+		{"not a list", `{"op":"add"}`, http.StatusBadRequest},
+		{"unknown op", `[{"op":"frobnicate","path":"/text"}]`, http.StatusBadRequest},
+		{"missing value", `[{"op":"add","path":"/text"}]`, http.StatusBadRequest},
+		{"bad pointer", `[{"op":"remove","path":"text"}]`, http.StatusBadRequest},
+		{"failed test", `[{"op":"test","path":"/text","value":"Bye"}]`, http.StatusConflict},
+		{"missing member", `[{"op":"replace","path":"/missing","value":1}]`, http.StatusConflict},
+		{"index out of range", `[{"op":"remove","path":"/tags/2"}]`, http.StatusConflict},
+		{"leading zero index", `[{"op":"remove","path":"/tags/01"}]`, http.StatusConflict},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ApplyJSONPatch([]byte(patchDoc), []byte(tc.patch))
+			var bodyErr *BodyError
+			if !errors.As(err, &bodyErr) || bodyErr.Status != tc.status {
+				t.Errorf("Expected a %d BodyError, got %v", tc.status, err)
+			}
+		})
+	}
+}
+
+func assertJSONEqual(t *testing.T, got []byte, want string) {
+	t.Helper()
+	var g, w any
+	json.Unmarshal(got, &g)
+	json.Unmarshal([]byte(want), &w)
+	if !reflect.DeepEqual(g, w) {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
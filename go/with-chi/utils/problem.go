@@ -0,0 +1,93 @@
+package utils
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// ProblemCode is the stable, machine-readable identifier of an error.
+// Clients should branch on it rather than on title or detail text.
+type ProblemCode string
+
+const (
+	CodeInvalidBody          ProblemCode = "invalid_body"
+	CodeUnsupportedMediaType ProblemCode = "unsupported_media_type"
+	CodePayloadTooLarge      ProblemCode = "payload_too_large"
+	CodeValidationFailed     ProblemCode = "validation_failed"
+	CodeInvalidQuery         ProblemCode = "invalid_query"
+	CodeUnauthorized         ProblemCode = "unauthorized"
+	CodeForbidden            ProblemCode = "forbidden"
+	CodeNotFound             ProblemCode = "not_found"
+	CodeConflict             ProblemCode = "conflict"
+	CodePreconditionFailed   ProblemCode = "precondition_failed"
+	CodeInternal             ProblemCode = "internal_error"
+)
+
+var problemTitles = map[ProblemCode]string{
+	CodeInvalidBody:          "Request body could not be read",
+	CodeUnsupportedMediaType: "Unsupported content type",
+	CodePayloadTooLarge:      "Request body too large",
+	CodeValidationFailed:     "Request failed validation",
+	CodeInvalidQuery:         "Query parameters are invalid",
+	CodeUnauthorized:         "Authentication required",
+	CodeForbidden:            "Access denied",
+	CodeNotFound:             "Resource not found",
+	CodeConflict:             "Request conflicts with the current state",
+	CodePreconditionFailed:   "Precondition failed",
+	CodeInternal:             "Internal server error",
+}
+
+// Field error codes shared by validation and query parsing.
+const (
+	FieldRequired          = "required"
+	FieldInvalid           = "invalid"
+	FieldOutOfRange        = "out_of_range"
+	FieldUnknown           = "unknown"
+	FieldTooShort          = "too_short"
+	FieldTooLong           = "too_long"
+	FieldInvalidUTF8       = "invalid_utf8"
+	FieldInvalidCharacters = "invalid_characters"
+)
+
+// Problem is an RFC 7807 problem details object, extended with a code
+// and per-field errors.
+type Problem struct {
+	Type   string       `json:"type" example:"/problems/validation-failed"`
+	Code   ProblemCode  `json:"code" example:"validation_failed"`
+	Title  string       `json:"title" example:"Request failed validation"`
+	Status int          `json:"status" example:"400"`
+	Detail string       `json:"detail,omitempty" example:"The message has 1 invalid field."`
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError pinpoints one invalid field or query parameter.
+type FieldError struct {
+	Field   string `json:"field" example:"from"`
+	Code    string `json:"code" example:"required"`
+	Message string `json:"message" example:"from is required"`
+}
+
+const ProblemContentType = "application/problem+json"
+
+// NewProblem builds a Problem whose type and title are derived from code.
+func NewProblem(status int, code ProblemCode, detail string, fieldErrors ...FieldError) Problem {
+	title, ok := problemTitles[code]
+	if !ok {
+		title = http.StatusText(status)
+	}
+	return Problem{
+		Type:   "/problems/" + strings.ReplaceAll(string(code), "_", "-"),
+		Code:   code,
+		Title:  title,
+		Status: status,
+		Detail: detail,
+		Errors: fieldErrors,
+	}
+}
+
+func WriteProblem(w http.ResponseWriter, status int, code ProblemCode, detail string, fieldErrors ...FieldError) error {
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(status)
+	return json.NewEncoder(w).Encode(NewProblem(status, code, detail, fieldErrors...))
+}
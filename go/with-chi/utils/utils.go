@@ -1,35 +1,112 @@
 package utils
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
-	"node-week-02-with-chi/store"
+	"time"
 )
 
-// CreateMessage and GetMessage return store.Message
-// UpdateMessage returns *store.Message
-// GetAllMessages, GetLatestMessages, and GetSearchedMessages return []store.Message
-type MessageData interface {
-	store.Message | *store.Message | []store.Message
+// Response is the envelope every handler writes: the payload under data,
+// plus optional meta and links.
+type Response[T any] struct {
+	Data  T      `json:"data"`
+	Meta  *Meta  `json:"meta,omitempty"`
+	Links *Links `json:"links,omitempty"`
 }
 
-type Response[T MessageData] struct {
-	Data T `json:"data"`
+// Meta carries information about the payload rather than the payload itself.
+type Meta struct {
+	Count      *int        `json:"count,omitempty"`
+	Pagination *Pagination `json:"pagination,omitempty"`
+	// TookMS is how long the server spent on the request, in milliseconds.
+	TookMS float64 `json:"took_ms,omitempty"`
 }
-type ErrorResponse struct {
-	Error string `json:"error"`
+
+// Pagination describes a cursor-paginated list. Next and Prev are opaque
+// cursors for the after and before query parameters.
+type Pagination struct {
+	Limit int    `json:"limit"`
+	Next  string `json:"next,omitempty"`
+	Prev  string `json:"prev,omitempty"`
 }
 
-func ParseJSON(r *http.Request, payload any) error {
-	return json.NewDecoder(r.Body).Decode(payload)
+// Links holds URLs related to the response.
+type Links struct {
+	Self string `json:"self"`
+	Next string `json:"next,omitempty"`
+	Prev string `json:"prev,omitempty"`
 }
 
-func WriteJSON[T MessageData](w http.ResponseWriter, status int, data T) error {
-	w.WriteHeader(status)
-	return json.NewEncoder(w).Encode(Response[T]{Data: data})
+func WriteJSON[T any](w http.ResponseWriter, status int, data T) error {
+	return WriteResponse(w, status, Response[T]{Data: data})
 }
 
-func WriteError(w http.ResponseWriter, status int, err string) error {
+func WriteResponse[T any](w http.ResponseWriter, status int, response Response[T]) error {
 	w.WriteHeader(status)
-	return json.NewEncoder(w).Encode(ErrorResponse{Error: err})
+	return json.NewEncoder(w).Encode(response)
+}
+
+// ListMeta builds the meta for a list response of n items, including the
+// time spent so far when the request went through Timer.
+func ListMeta(r *http.Request, n int) *Meta {
+	return &Meta{
+		Count:  &n,
+		TookMS: float64(Elapsed(r).Microseconds()) / 1000,
+	}
+}
+
+// PageLinks returns the self link for r and, for each non-empty cursor,
+// the same URL with after or before set to it.
+func PageLinks(r *http.Request, next, prev string) *Links {
+	links := &Links{Self: r.URL.RequestURI()}
+	if next != "" {
+		links.Next = withCursor(r, "after", next)
+	}
+	if prev != "" {
+		links.Prev = withCursor(r, "before", prev)
+	}
+	return links
+}
+
+// PollLinks returns the self link for r and, when since is known, the
+// same URL with since set to it so clients can keep polling from there.
+func PollLinks(r *http.Request, since string) *Links {
+	links := &Links{Self: r.URL.RequestURI()}
+	if since != "" {
+		links.Next = withCursor(r, "since", since)
+	}
+	return links
+}
+
+func withCursor(r *http.Request, param, cursor string) string {
+	u := *r.URL
+	query := u.Query()
+	query.Del("after")
+	query.Del("before")
+	query.Set(param, cursor)
+	u.RawQuery = query.Encode()
+	return u.RequestURI()
+}
+
+type contextKey int
+
+const startTimeKey contextKey = iota
+
+// Timer is middleware that records when a request arrived so handlers can
+// report meta.took_ms.
+func Timer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), startTimeKey, time.Now())
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Elapsed returns the time since Timer saw r, or zero without Timer.
+func Elapsed(r *http.Request) time.Duration {
+	start, ok := r.Context().Value(startTimeKey).(time.Time)
+	if !ok {
+		return 0
+	}
+	return time.Since(start)
 }
@@ -0,0 +1,160 @@
+package utils
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Testing that optional envelope fields are left out when unset
+func TestWriteJSONOmitsMetaAndLinks(t *testing.T) {
+	rr := httptest.NewRecorder()
+
+	if err := WriteJSON(rr, http.StatusOK, map[string]int{"rooms": 3}); err != nil {
+		t.Fatalf("WriteJSON returned error: %v", err)
+	}
+
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if _, ok := body["meta"]; ok {
+		t.Errorf("Expected no meta, got %s", body["meta"])
+	}
+	if _, ok := body["links"]; ok {
+		t.Errorf("Expected no links, got %s", body["links"])
+	}
+	if string(body["data"]) != `{"rooms":3}` {
+		t.Errorf("Unexpected data: %s", body["data"])
+	}
+}
+
+// Testing PageLinks swaps the cursor parameters and keeps the rest
+func TestPageLinks(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/api/v1/messages?limit=5&after=abc", nil)
+
+	links := PageLinks(req, "next", "prev")
+
+	if links.Self != "/api/v1/messages?limit=5&after=abc" {
+		t.Errorf("Unexpected self link %q", links.Self)
+	}
+	if links.Next != "/api/v1/messages?after=next&limit=5" {
+		t.Errorf("Unexpected next link %q", links.Next)
+	}
+	if links.Prev != "/api/v1/messages?before=prev&limit=5" {
+		t.Errorf("Unexpected prev link %q", links.Prev)
+	}
+}
+
+// Testing WriteProblem produces an RFC 7807 document
+func TestWriteProblem(t *testing.T) {
+	rr := httptest.NewRecorder()
+	rr.Header().Set("Content-Type", "application/json")
+
+	WriteProblem(rr, http.StatusBadRequest, CodeValidationFailed, "bad input",
+		FieldError{Field: "from", Code: FieldRequired, Message: "from is required"})
+
+	if contentType := rr.Header().Get("Content-Type"); contentType != ProblemContentType {
+		t.Errorf("Expected content type %q, got %q", ProblemContentType, contentType)
+	}
+
+	var problem Problem
+	if err := json.Unmarshal(rr.Body.Bytes(), &problem); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	want := Problem{
+		Type:   "/problems/validation-failed",
+		Code:   CodeValidationFailed,
+		Title:  "Request failed validation",
+		Status: http.StatusBadRequest,
+		Detail: "bad input",
+	}
+	if problem.Type != want.Type || problem.Code != want.Code || problem.Title != want.Title ||
+		problem.Status != want.Status || problem.Detail != want.Detail {
+		t.Errorf("Expected %+v, got %+v", want, problem)
+	}
+	if len(problem.Errors) != 1 || problem.Errors[0].Field != "from" {
+		t.Errorf("Unexpected field errors: %+v", problem.Errors)
+	}
+}
+
+// Testing RequireBearer
+func TestRequireBearer(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) })
+
+	for _, tc := range []struct {
+		name, token, header string
+		want                int
+	}{
+		{"matching token", "secret", "Bearer secret", http.StatusNoContent},
+		{"missing header", "secret", "", http.StatusUnauthorized},
+		{"wrong token", "secret", "Bearer guess", http.StatusUnauthorized},
+		{"wrong scheme", "secret", "Basic secret", http.StatusUnauthorized},
+		{"no token configured", "", "Bearer ", http.StatusForbidden},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", nil)
+			if tc.header != "" {
+				req.Header.Set("Authorization", tc.header)
+			}
+			rr := httptest.NewRecorder()
+			RequireBearer(tc.token)(ok).ServeHTTP(rr, req)
+			if rr.Code != tc.want {
+				t.Errorf("Expected status %d, got %d", tc.want, rr.Code)
+			}
+			if tc.want == http.StatusUnauthorized && rr.Header().Get("WWW-Authenticate") == "" {
+				t.Errorf("Expected a WWW-Authenticate challenge")
+			}
+		})
+	}
+}
+
+// Testing If-Match and If-None-Match against entity tags
+func TestConditionalHeaders(t *testing.T) {
+	for _, tc := range []struct {
+		name, header         string
+		ifMatch, notModified bool
+	}{
+		{"no header", "", true, false},
+		{"same tag", `"3"`, true, true},
+		{"other tag", `"2"`, false, false},
+		{"weak tag", `W/"3"`, false, true},
+		{"list", `"1", W/"2", "3"`, true, true},
+		{"star", "*", true, true},
+		{"commas in tags", `"a,b", "3"`, true, true},
+		{"junk", `3, nonsense`, false, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.header != "" {
+				req.Header.Set("If-Match", tc.header)
+				req.Header.Set("If-None-Match", tc.header)
+			}
+			if got := IfMatch(req, VersionETag(3)); got != tc.ifMatch {
+				t.Errorf("IfMatch(%q) = %v, expected %v", tc.header, got, tc.ifMatch)
+			}
+			if got := NotModified(req, VersionETag(3)); got != tc.notModified {
+				t.Errorf("NotModified(%q) = %v, expected %v", tc.header, got, tc.notModified)
+			}
+		})
+	}
+
+	t.Run("version tags change with state", func(t *testing.T) {
+		a := VersionETag(3, map[string]int{"👍": 1})
+		b := VersionETag(3, map[string]int{"👍": 2})
+		if a == b || a != VersionETag(3, map[string]int{"👍": 1}) || !strings.HasPrefix(a, `"3-`) {
+			t.Errorf("Unexpected version tags %q %q", a, b)
+		}
+	})
+
+	t.Run("content tags are weak and stable", func(t *testing.T) {
+		a, _ := ContentETag([]string{"x"})
+		b, _ := ContentETag([]string{"x"})
+		c, _ := ContentETag([]string{"y"})
+		if a != b || a == c || !strings.HasPrefix(a, `W/"`) {
+			t.Errorf("Unexpected content tags %q %q %q", a, b, c)
+		}
+	})
+}
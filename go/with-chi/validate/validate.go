@@ -0,0 +1,198 @@
+// Package validate checks request structs against rules declared in their
+// `validate` struct tags. The same tags feed the OpenAPI schema: swag turns
+// required, min= and max= into required, minLength and maxLength.
+//
+// Supported rules, applied in this order to string fields:
+//
+//	trim        strip surrounding whitespace in place before other checks
+//	required    must not be empty
+//	min=N       at least N characters
+//	max=N       at most N characters (overridable through Limits)
+//	singleline  no line breaks
+//	printable   no control characters other than tab and newline, and no
+//	            bidirectional overrides that can disguise text
+//	url         an absolute http or https URL
+//
+// Every string is also checked for valid UTF-8. Lengths count runes.
+package validate
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"node-week-02-with-chi/utils"
+)
+
+// Limits overrides the max= rule of fields, keyed by JSON field name.
+type Limits map[string]int
+
+// Struct validates the struct v points to and reports every failing field.
+// It panics if v is not a pointer to a struct or a tag is malformed, since
+// both are programming errors.
+func Struct(v any, limits Limits) []utils.FieldError {
+	value := reflect.ValueOf(v)
+	if value.Kind() != reflect.Pointer || value.Elem().Kind() != reflect.Struct {
+		panic("validate: Struct needs a pointer to a struct")
+	}
+	value = value.Elem()
+
+	var fieldErrors []utils.FieldError
+	for _, f := range fieldsOf(value.Type()) {
+		field := value.Field(f.index)
+		rules := f.rules
+		if max, ok := limits[f.name]; ok {
+			rules.max = max
+		}
+		if fieldError, ok := rules.check(f.name, field); !ok {
+			fieldErrors = append(fieldErrors, fieldError)
+		}
+	}
+	return fieldErrors
+}
+
+type fieldRules struct {
+	index int
+	name  string
+	rules rules
+}
+
+type rules struct {
+	trim, required, singleline, printable, url bool
+	min, max                                   int
+}
+
+var fieldCache sync.Map // reflect.Type -> []fieldRules
+
+func fieldsOf(t reflect.Type) []fieldRules {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if cached, ok := fieldCache.Load(t); ok {
+		return cached.([]fieldRules)
+	}
+
+	var fields []fieldRules
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag, ok := sf.Tag.Lookup("validate")
+		if !ok {
+			continue
+		}
+		if sf.Type.Kind() != reflect.String {
+			panic(fmt.Sprintf("validate: %s.%s: only string fields are supported", t.Name(), sf.Name))
+		}
+		fields = append(fields, fieldRules{
+			index: i,
+			name:  jsonName(sf),
+			rules: parseRules(t, sf, tag),
+		})
+	}
+
+	fieldCache.Store(t, fields)
+	return fields
+}
+
+func parseRules(t reflect.Type, sf reflect.StructField, tag string) rules {
+	var r rules
+	for _, rule := range strings.Split(tag, ",") {
+		name, arg, _ := strings.Cut(rule, "=")
+		switch name {
+		case "trim":
+			r.trim = true
+		case "required":
+			r.required = true
+		case "singleline":
+			r.singleline = true
+		case "printable":
+			r.printable = true
+		case "url":
+			r.url = true
+		case "min", "max":
+			n, err := strconv.Atoi(arg)
+			if err != nil || n < 0 {
+				panic(fmt.Sprintf("validate: %s.%s: bad %s value %q", t.Name(), sf.Name, name, arg))
+			}
+			if name == "min" {
+				r.min = n
+			} else {
+				r.max = n
+			}
+		default:
+			panic(fmt.Sprintf("validate: %s.%s: unknown rule %q", t.Name(), sf.Name, rule))
+		}
+	}
+	return r
+}
+
+func (r rules) check(name string, field reflect.Value) (utils.FieldError, bool) {
+	fail := func(code, message string) (utils.FieldError, bool) {
+		return utils.FieldError{Field: name, Code: code, Message: message}, false
+	}
+
+	s := field.String()
+	if r.trim {
+		s = strings.TrimSpace(s)
+		field.SetString(s)
+	}
+
+	if !utf8.ValidString(s) {
+		return fail(utils.FieldInvalidUTF8, name+" must be valid UTF-8")
+	}
+	if s == "" {
+		if r.required {
+			return fail(utils.FieldRequired, name+" is required")
+		}
+		return utils.FieldError{}, true
+	}
+
+	length := utf8.RuneCountInString(s)
+	if length < r.min {
+		return fail(utils.FieldTooShort, fmt.Sprintf("%s must be at least %d characters", name, r.min))
+	}
+	if r.max > 0 && length > r.max {
+		return fail(utils.FieldTooLong, fmt.Sprintf("%s must be at most %d characters", name, r.max))
+	}
+	if r.singleline && strings.ContainsAny(s, "\r\n") {
+		return fail(utils.FieldInvalidCharacters, name+" must be a single line")
+	}
+	if r.printable {
+		if i := strings.IndexFunc(s, disallowed); i != -1 {
+			bad, _ := utf8.DecodeRuneInString(s[i:])
+			return fail(utils.FieldInvalidCharacters, fmt.Sprintf("%s contains the disallowed character %U", name, bad))
+		}
+	}
+	if r.url {
+		u, err := url.Parse(s)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fail(utils.FieldInvalid, name+" must be an absolute http or https URL")
+		}
+	}
+	return utils.FieldError{}, true
+}
+
+func disallowed(r rune) bool {
+	switch {
+	case r == '\n' || r == '\t':
+		return false
+	case unicode.IsControl(r):
+		return true
+	case r >= '\u202A' && r <= '\u202E', r >= '\u2066' && r <= '\u2069':
+		// Bidirectional embeddings, overrides and isolates.
+		return true
+	}
+	return false
+}
+
+func jsonName(sf reflect.StructField) string {
+	name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return sf.Name
+	}
+	return name
+}
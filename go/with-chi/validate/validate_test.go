@@ -0,0 +1,105 @@
+package validate
+
+import (
+	"strings"
+	"testing"
+
+	"node-week-02-with-chi/store"
+	"node-week-02-with-chi/utils"
+)
+
+// Testing the rules declared on store.CreateMessageRequest
+func TestStructCreateMessageRequest(t *testing.T) {
+	tests := []struct {
+		name   string
+		req    store.CreateMessageRequest
+		limits Limits
+		want   map[string]string // field -> code
+	}{
+		{name: "valid", req: store.CreateMessageRequest{From: "Alice", Text: "Hello\n\tWorld"}},
+		{name: "missing both", req: store.CreateMessageRequest{}, want: map[string]string{"from": utils.FieldRequired, "text": utils.FieldRequired}},
+		{name: "whitespace only", req: store.CreateMessageRequest{From: "  \t", Text: "\n"}, want: map[string]string{"from": utils.FieldRequired, "text": utils.FieldRequired}},
+		{name: "too long", req: store.CreateMessageRequest{From: strings.Repeat("a", 51), Text: strings.Repeat("b", 2001)}, want: map[string]string{"from": utils.FieldTooLong, "text": utils.FieldTooLong}},
+		{name: "length counts characters not bytes", req: store.CreateMessageRequest{From: strings.Repeat("é", 50), Text: "ok"}},
+		{name: "limits override max", req: store.CreateMessageRequest{From: "Alice", Text: "Hello"}, limits: Limits{"text": 3}, want: map[string]string{"text": utils.FieldTooLong}},
+		{name: "name must be one line", req: store.CreateMessageRequest{From: "Al\nice", Text: "Hello"}, want: map[string]string{"from": utils.FieldInvalidCharacters}},
+		{name: "control characters", req: store.CreateMessageRequest{From: "Alice", Text: "bell\a"}, want: map[string]string{"text": utils.FieldInvalidCharacters}},
+		{name: "bidi override", req: store.CreateMessageRequest{From: "Alice\u202Eevil", Text: "Hello"}, want: map[string]string{"from": utils.FieldInvalidCharacters}},
+		{name: "invalid UTF-8", req: store.CreateMessageRequest{From: "Alice", Text: "bad \xff byte"}, want: map[string]string{"text": utils.FieldInvalidUTF8}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := tt.req
+			got := map[string]string{}
+			for _, fieldError := range Struct(&req, tt.limits) {
+				got[fieldError.Field] = fieldError.Code
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("Expected errors %v, got %v", tt.want, got)
+			}
+			for field, code := range tt.want {
+				if got[field] != code {
+					t.Errorf("%s: expected %q, got %q", field, code, got[field])
+				}
+			}
+		})
+	}
+}
+
+// Testing trim rewrites the field in place
+func TestStructTrims(t *testing.T) {
+	req := store.CreateMessageRequest{From: "  Alice ", Text: "\tHello\n"}
+
+	if errs := Struct(&req, nil); len(errs) != 0 {
+		t.Fatalf("Unexpected errors: %+v", errs)
+	}
+	if req.From != "Alice" || req.Text != "Hello" {
+		t.Errorf("Expected trimmed fields, got %+v", req)
+	}
+}
+
+// Testing the url rule
+func TestStructURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{url: "https://example.com/hooks"},
+		{url: "http://localhost:8080"},
+		{url: "", want: ""},
+		{url: "ftp://example.com", want: utils.FieldInvalid},
+		{url: "/relative/path", want: utils.FieldInvalid},
+		{url: "https://", want: utils.FieldInvalid},
+		{url: "://bad", want: utils.FieldInvalid},
+	}
+
+	for _, tt := range tests {
+		v := struct {
+			URL string `json:"url" validate:"url"`
+		}{URL: tt.url}
+
+		var got string
+		if errs := Struct(&v, nil); len(errs) > 0 {
+			got = errs[0].Code
+		}
+		if got != tt.want {
+			t.Errorf("%q: expected %q, got %q", tt.url, tt.want, got)
+		}
+	}
+}
+
+// Testing malformed tags are caught as programming errors
+func TestStructPanicsOnUnknownRule(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected a panic for an unknown rule")
+		}
+	}()
+
+	var v struct {
+		Name string `validate:"required,shiny"`
+	}
+	Struct(&v, nil)
+}
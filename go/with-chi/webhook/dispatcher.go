@@ -0,0 +1,428 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"log"
+	mrand "math/rand/v2"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"node-week-02-with-chi/store"
+)
+
+// eventBuffer is how many events can queue up before the Broker drops the
+// dispatcher; it then catches up from the Broker's history.
+const eventBuffer = 256
+
+type Options struct {
+	// MaxAttempts per delivery before it is dead-lettered; zero means 6.
+	MaxAttempts int
+	// InitialBackoff is the wait before the first retry, doubled after
+	// each further failure up to MaxBackoff. Zero means 1s and 5m.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Timeout bounds each attempt; zero means 10s.
+	Timeout time.Duration
+	// LogSize is how many deliveries, and separately how many dead
+	// letters, are kept; zero means 1000.
+	LogSize int
+	// Client sends deliveries; nil means a client without a timeout of
+	// its own that does not follow redirects and only connects to internal
+	// addresses on the Allowlist. Other clients are not checked.
+	Client *http.Client
+	// Resolver looks up the hosts of new subscriptions for CheckTarget;
+	// nil means net.DefaultResolver.
+	Resolver Resolver
+}
+
+func (o Options) withDefaults() Options {
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = 6
+	}
+	if o.InitialBackoff <= 0 {
+		o.InitialBackoff = time.Second
+	}
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = 5 * time.Minute
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = 10 * time.Second
+	}
+	if o.LogSize <= 0 {
+		o.LogSize = 1000
+	}
+	if o.Resolver == nil {
+		o.Resolver = net.DefaultResolver
+	}
+	return o
+}
+
+type subscription struct {
+	Subscription
+	secret string
+}
+
+func (s *subscription) wants(t store.EventType) bool {
+	return len(s.Events) == 0 || slices.Contains(s.Events, t)
+}
+
+// Dispatcher manages subscriptions and delivers events to them.
+type Dispatcher struct {
+	opts Options
+	ids  *store.ULIDs
+
+	mu    sync.Mutex
+	subs  map[string]*subscription
+	allow Allowlist
+	// log and dead hold deliveries oldest first, each capped at LogSize.
+	log  []*Delivery
+	dead []*Delivery
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewDispatcher(opts Options) *Dispatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &Dispatcher{
+		opts:   opts.withDefaults(),
+		ids:    store.NewULIDs(),
+		subs:   map[string]*subscription{},
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	if d.opts.Client == nil {
+		d.opts.Client = d.newClient()
+	}
+	return d
+}
+
+// Start delivers the events published to broker from now on, until the
+// broker or the Dispatcher is closed.
+func (d *Dispatcher) Start(broker *store.Broker) {
+	// Subscribe before reading LastSeq so nothing published in between is
+	// lost; events the subscription gets up to last are skipped below.
+	sub := broker.Subscribe(eventBuffer)
+	last := broker.LastSeq()
+
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		for {
+			select {
+			case event, open := <-sub.C:
+				if open {
+					if event.Seq > last {
+						last = event.Seq
+						d.Dispatch(event)
+					}
+					continue
+				}
+				if broker.Closed() {
+					return
+				}
+				// We fell behind and were dropped: resubscribe, then
+				// replay what we missed from the history.
+				sub = broker.Subscribe(eventBuffer)
+				missed, ok := broker.Since(last)
+				if !ok {
+					// Everything the new subscription receives is
+					// undelivered, so take it all.
+					log.Printf("webhook: events after %d were lost", last)
+					last = 0
+				}
+				for _, event := range missed {
+					last = event.Seq
+					d.Dispatch(event)
+				}
+			case <-d.ctx.Done():
+				sub.Unsubscribe()
+				return
+			}
+		}
+	}()
+}
+
+// Close cancels pending retries and waits for attempts in flight.
+func (d *Dispatcher) Close() {
+	// Cancel under mu so that start never adds to wg after Wait begins.
+	d.mu.Lock()
+	d.cancel()
+	d.mu.Unlock()
+	d.wg.Wait()
+}
+
+// Subscribe adds a subscription. req must already be validated.
+func (d *Dispatcher) Subscribe(req CreateSubscriptionRequest) (Subscription, error) {
+	secret := req.Secret
+	if secret == "" {
+		raw := make([]byte, 24)
+		if _, err := rand.Read(raw); err != nil {
+			return Subscription{}, err
+		}
+		secret = base64.RawURLEncoding.EncodeToString(raw)
+	}
+
+	s := &subscription{
+		Subscription: Subscription{
+			ID:        d.ids.NewID(time.Now()),
+			URL:       req.URL,
+			Events:    slices.Clone(req.Events),
+			CreatedAt: time.Now().UTC(),
+		},
+		secret: secret,
+	}
+	if s.Events == nil {
+		s.Events = []store.EventType{}
+	}
+
+	d.mu.Lock()
+	d.subs[s.ID] = s
+	d.mu.Unlock()
+
+	created := s.Subscription
+	created.Secret = secret
+	return created, nil
+}
+
+// Subscriptions returns every subscription, oldest first.
+func (d *Dispatcher) Subscriptions() []Subscription {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	subs := make([]Subscription, 0, len(d.subs))
+	for _, s := range d.subs {
+		subs = append(subs, s.Subscription)
+	}
+	slices.SortFunc(subs, func(a, b Subscription) int { return store.CompareIDs(a.ID, b.ID) })
+	return subs
+}
+
+func (d *Dispatcher) Subscription(id string) (Subscription, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	s, ok := d.subs[id]
+	if !ok {
+		return Subscription{}, ErrNotFound
+	}
+	return s.Subscription, nil
+}
+
+// Unsubscribe removes a subscription and cancels its pending deliveries.
+func (d *Dispatcher) Unsubscribe(id string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.subs[id]; !ok {
+		return ErrNotFound
+	}
+	delete(d.subs, id)
+	return nil
+}
+
+// Deliveries returns the logged deliveries to a subscription, oldest first.
+func (d *Dispatcher) Deliveries(subscriptionID string) ([]Delivery, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.subs[subscriptionID]; !ok {
+		return nil, ErrNotFound
+	}
+	deliveries := []Delivery{}
+	for _, delivery := range d.log {
+		if delivery.SubscriptionID == subscriptionID {
+			deliveries = append(deliveries, delivery.clone())
+		}
+	}
+	return deliveries, nil
+}
+
+// DeadLetters returns the deliveries that ran out of attempts, oldest
+// first.
+func (d *Dispatcher) DeadLetters() []Delivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	deliveries := make([]Delivery, 0, len(d.dead))
+	for _, delivery := range d.dead {
+		deliveries = append(deliveries, delivery.clone())
+	}
+	return deliveries
+}
+
+// Redeliver takes a dead letter off the list and tries it again with a
+// fresh set of attempts.
+func (d *Dispatcher) Redeliver(deliveryID string) (Delivery, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	i := slices.IndexFunc(d.dead, func(delivery *Delivery) bool { return delivery.ID == deliveryID })
+	if i == -1 {
+		return Delivery{}, ErrNotFound
+	}
+	delivery := d.dead[i]
+	s, ok := d.subs[delivery.SubscriptionID]
+	if !ok {
+		return Delivery{}, ErrNotFound
+	}
+
+	d.dead = slices.Delete(d.dead, i, i+1)
+	delivery.Status = DeliveryPending
+	d.start(delivery, s)
+	return delivery.clone(), nil
+}
+
+// Dispatch queues event for every subscription that wants it.
+func (d *Dispatcher) Dispatch(event store.Event) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, s := range d.subs {
+		if !s.wants(event.Type) {
+			continue
+		}
+		delivery := &Delivery{
+			ID:             d.ids.NewID(time.Now()),
+			SubscriptionID: s.ID,
+			Event:          event,
+			Status:         DeliveryPending,
+			Attempts:       []Attempt{},
+		}
+		d.log = appendCapped(d.log, delivery, d.opts.LogSize)
+		d.start(delivery, s)
+	}
+}
+
+// start runs delivery in the background. d.mu must be held.
+func (d *Dispatcher) start(delivery *Delivery, s *subscription) {
+	if d.ctx.Err() != nil {
+		return
+	}
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		d.deliver(delivery, s.URL, s.secret)
+	}()
+}
+
+func (d *Dispatcher) deliver(delivery *Delivery, url, secret string) {
+	body, err := json.Marshal(delivery.Event)
+	if err != nil {
+		log.Printf("webhook: encoding event %d: %v", delivery.Event.Seq, err)
+		return
+	}
+
+	for attempt := 1; ; attempt++ {
+		result := d.post(url, secret, delivery, body)
+
+		d.mu.Lock()
+		delivery.Attempts = append(delivery.Attempts, result)
+		delivery.NextAttemptAt = nil
+		var wait time.Duration
+		switch {
+		case result.Error == "" && result.StatusCode < 300:
+			delivery.Status = DeliverySucceeded
+		case d.subs[delivery.SubscriptionID] == nil:
+			delivery.Status = DeliveryCanceled
+		case attempt >= d.opts.MaxAttempts:
+			delivery.Status = DeliveryDead
+			d.dead = appendCapped(d.dead, delivery, d.opts.LogSize)
+		default:
+			wait = d.backoff(attempt)
+			next := time.Now().Add(wait).UTC()
+			delivery.NextAttemptAt = &next
+		}
+		d.mu.Unlock()
+
+		if wait == 0 {
+			return
+		}
+		select {
+		case <-time.After(wait):
+		case <-d.ctx.Done():
+			return
+		}
+
+		d.mu.Lock()
+		canceled := d.subs[delivery.SubscriptionID] == nil
+		if canceled {
+			delivery.Status = DeliveryCanceled
+			delivery.NextAttemptAt = nil
+		}
+		d.mu.Unlock()
+		if canceled {
+			return
+		}
+	}
+}
+
+// post makes one attempt at a delivery.
+func (d *Dispatcher) post(url, secret string, delivery *Delivery, body []byte) (result Attempt) {
+	ctx, cancel := context.WithTimeout(d.ctx, d.opts.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	result.At = start.UTC()
+	defer func() {
+		result.DurationMS = float64(time.Since(start).Microseconds()) / 1000
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderID, delivery.ID)
+	req.Header.Set(HeaderEvent, string(delivery.Event.Type))
+	timestamp := start.Unix()
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(secret, timestamp, body))
+
+	resp, err := d.opts.Client.Do(req)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer resp.Body.Close()
+	// Drain a little so the connection can be reused.
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	result.StatusCode = resp.StatusCode
+	if resp.StatusCode >= 300 {
+		result.Error = "receiver responded " + resp.Status
+	}
+	return result
+}
+
+// backoff returns the wait after the given failed attempt: InitialBackoff
+// doubled per attempt, capped at MaxBackoff, with the upper half jittered
+// so that many failing deliveries do not retry in lockstep.
+func (d *Dispatcher) backoff(attempt int) time.Duration {
+	wait := d.opts.InitialBackoff
+	for i := 1; i < attempt && wait < d.opts.MaxBackoff; i++ {
+		wait *= 2
+	}
+	wait = min(wait, d.opts.MaxBackoff)
+
+	half := wait / 2
+	return half + mrand.N(half+1)
+}
+
+func appendCapped(deliveries []*Delivery, delivery *Delivery, limit int) []*Delivery {
+	if len(deliveries) >= limit {
+		deliveries = slices.Delete(deliveries, 0, len(deliveries)-limit+1)
+	}
+	return append(deliveries, delivery)
+}
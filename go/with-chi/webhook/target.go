@@ -0,0 +1,173 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrInternalTarget is returned by CheckTarget, and fails deliveries, for
+// addresses in the server's own network that are not on the Allowlist.
+var ErrInternalTarget = errors.New("webhook target is a loopback, private or link-local address")
+
+// lookupTimeout bounds the DNS lookup in CheckTarget.
+const lookupTimeout = 2 * time.Second
+
+// Resolver looks up host names for CheckTarget; *net.Resolver is one.
+type Resolver interface {
+	LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error)
+}
+
+// Allowlist names the internal receivers that webhooks may reach. Every
+// other loopback, private, link-local or unspecified address is refused.
+type Allowlist struct {
+	// Networks are allowed address ranges, such as 10.20.0.0/16.
+	Networks []netip.Prefix
+	// Hosts are allowed host names, such as hooks.internal. Connections to
+	// them are not checked, whatever the names resolve to.
+	Hosts []string
+}
+
+// ParseAllowlist reads a comma-separated list of CIDR ranges, IP addresses
+// and host names.
+func ParseAllowlist(s string) (Allowlist, error) {
+	var a Allowlist
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if strings.Contains(item, "/") {
+			prefix, err := netip.ParsePrefix(item)
+			if err != nil {
+				return Allowlist{}, fmt.Errorf("invalid network %q", item)
+			}
+			a.Networks = append(a.Networks, prefix.Masked())
+			continue
+		}
+		if addr, err := netip.ParseAddr(item); err == nil {
+			addr = addr.Unmap()
+			a.Networks = append(a.Networks, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		a.Hosts = append(a.Hosts, hostname(item))
+	}
+	return a, nil
+}
+
+func (a Allowlist) allowsHost(host string) bool {
+	return slices.Contains(a.Hosts, hostname(host))
+}
+
+// permits reports whether deliveries may connect to addr.
+func (a Allowlist) permits(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !internal(addr) {
+		return true
+	}
+	return slices.ContainsFunc(a.Networks, func(p netip.Prefix) bool { return p.Contains(addr) })
+}
+
+func internal(addr netip.Addr) bool {
+	return addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast()
+}
+
+func hostname(host string) string {
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+// CheckTarget returns ErrInternalTarget if rawURL names localhost or an
+// address the Allowlist does not permit, directly or through DNS, so that
+// subscribers hear about it at once. It is not the guard itself:
+// deliveries check every address they connect to, so a name that does not
+// resolve yet, or later resolves somewhere else, is refused then.
+func (d *Dispatcher) CheckTarget(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	allow := d.allowlist()
+	host := hostname(u.Hostname())
+	if allow.allowsHost(host) {
+		return nil
+	}
+
+	var addrs []netip.Addr
+	if addr, err := netip.ParseAddr(host); err == nil {
+		addrs = []netip.Addr{addr}
+	} else if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		addrs = []netip.Addr{netip.AddrFrom4([4]byte{127, 0, 0, 1}), netip.IPv6Loopback()}
+	} else {
+		ctx, cancel := context.WithTimeout(ctx, lookupTimeout)
+		defer cancel()
+		if addrs, err = d.opts.Resolver.LookupNetIP(ctx, "ip", host); err != nil {
+			return nil
+		}
+	}
+	for _, addr := range addrs {
+		if !allow.permits(addr) {
+			return ErrInternalTarget
+		}
+	}
+	return nil
+}
+
+// Allow replaces the Allowlist of internal receivers.
+func (d *Dispatcher) Allow(a Allowlist) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.allow = a
+}
+
+func (d *Dispatcher) allowlist() Allowlist {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.allow
+}
+
+// newClient returns the default delivery client. Its dialer checks each
+// address as it connects, after DNS, so that no lookup between CheckTarget
+// and a delivery can point it into the server's network. It ignores proxy
+// settings, since a proxy would make the connection on its behalf.
+func (d *Dispatcher) newClient() *http.Client {
+	guarded := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second, Control: d.control}
+	open := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		if host, _, err := net.SplitHostPort(address); err == nil && d.allowlist().allowsHost(host) {
+			return open.DialContext(ctx, network, address)
+		}
+		return guarded.DialContext(ctx, network, address)
+	}
+	return &http.Client{Transport: transport, CheckRedirect: refuseRedirects}
+}
+
+// control refuses connections to addresses the Allowlist does not permit.
+func (d *Dispatcher) control(_, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if !d.allowlist().permits(addrPort.Addr()) {
+		return ErrInternalTarget
+	}
+	return nil
+}
+
+// refuseRedirects stops the default client from following redirects, so
+// receivers must answer at the URL they subscribed with. The redirect
+// counts as a failed attempt.
+func refuseRedirects(*http.Request, []*http.Request) error {
+	return http.ErrUseLastResponse
+}
@@ -0,0 +1,141 @@
+// Package webhook notifies subscribed HTTP endpoints of message lifecycle
+// events. Every delivery is a JSON POST of the store.Event, signed with the
+// subscription's secret (see Sign and Verify). Failed deliveries are
+// retried with exponential backoff; once they run out of attempts they are
+// kept on a dead-letter list from which they can be retried by hand.
+//
+// Subscriptions and delivery logs are kept in memory and do not survive a
+// restart.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"node-week-02-with-chi/store"
+)
+
+// Headers sent with every delivery.
+const (
+	HeaderID        = "Webhook-Id"
+	HeaderEvent     = "Webhook-Event"
+	HeaderTimestamp = "Webhook-Timestamp"
+	HeaderSignature = "Webhook-Signature"
+)
+
+const signaturePrefix = "sha256="
+
+var (
+	ErrNotFound         = errors.New("not found")
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+)
+
+// Events lists the event types a subscription can ask for.
+var Events = []store.EventType{store.MessageCreated, store.MessageUpdated, store.MessageDeleted, store.MessageRestored}
+
+// Subscription is a receiver of webhook deliveries.
+type Subscription struct {
+	ID     string            `json:"id" example:"01JB8ZC5T8M2X9Q4Y7W3R6K1PN"`
+	URL    string            `json:"url" example:"https://example.com/hooks/chat"`
+	Events []store.EventType `json:"events" swaggertype:"array,string" example:"message.created,message.deleted"`
+	// Secret is only returned when the subscription is created.
+	Secret    string    `json:"secret,omitempty" example:"3q2-7wR0bX9kY1v..."`
+	CreatedAt time.Time `json:"created_at" example:"2025-02-12T12:12:12Z"`
+}
+
+type CreateSubscriptionRequest struct {
+	// URL receives a POST for every matching event.
+	URL string `json:"url" validate:"trim,required,max=2000,url" example:"https://example.com/hooks/chat"`
+	// Events limits deliveries to these event types; empty means all.
+	Events []store.EventType `json:"events" swaggertype:"array,string" example:"message.created"`
+	// Secret signs deliveries. When empty, a random one is generated and
+	// returned in the response.
+	Secret string `json:"secret" validate:"trim,min=16,max=200,singleline,printable" example:"a-long-shared-secret"`
+}
+
+// DeliveryStatus is where a delivery stands.
+type DeliveryStatus string
+
+const (
+	// DeliveryPending deliveries are waiting for their next attempt.
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliverySucceeded DeliveryStatus = "succeeded"
+	// DeliveryDead deliveries ran out of attempts and are on the
+	// dead-letter list.
+	DeliveryDead DeliveryStatus = "dead"
+	// DeliveryCanceled deliveries were pending when their subscription was
+	// deleted.
+	DeliveryCanceled DeliveryStatus = "canceled"
+)
+
+// Delivery is the log of sending one event to one subscription.
+type Delivery struct {
+	ID             string         `json:"id" example:"01JB8ZD0Q2A6C3V5N7M9K1H4TX"`
+	SubscriptionID string         `json:"subscription_id" example:"01JB8ZC5T8M2X9Q4Y7W3R6K1PN"`
+	Event          store.Event    `json:"event"`
+	Status         DeliveryStatus `json:"status" example:"succeeded"`
+	Attempts       []Attempt      `json:"attempts"`
+	NextAttemptAt  *time.Time     `json:"next_attempt_at,omitempty"`
+}
+
+// Attempt records one POST of a delivery.
+type Attempt struct {
+	At time.Time `json:"at" example:"2025-02-12T12:12:12Z"`
+	// StatusCode is the receiver's response status, absent when the
+	// request failed before a response arrived.
+	StatusCode int     `json:"status_code,omitempty" example:"200"`
+	Error      string  `json:"error,omitempty"`
+	DurationMS float64 `json:"duration_ms" example:"12.5"`
+}
+
+// ValidEvent reports whether t is one of Events.
+func ValidEvent(t store.EventType) bool {
+	return slices.Contains(Events, t)
+}
+
+func (d Delivery) clone() Delivery {
+	d.Attempts = slices.Clone(d.Attempts)
+	if d.NextAttemptAt != nil {
+		next := *d.NextAttemptAt
+		d.NextAttemptAt = &next
+	}
+	return d
+}
+
+// Sign returns the Webhook-Signature value for body sent at timestamp
+// (Unix seconds): the hex HMAC-SHA256 of "<timestamp>.<body>" keyed with
+// secret. Binding the timestamp lets receivers reject replays.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature headers of a delivery received at now.
+// Deliveries signed more than tolerance away from now are rejected;
+// a zero tolerance skips that check.
+func Verify(secret string, header http.Header, body []byte, tolerance time.Duration, now time.Time) error {
+	timestamp, err := strconv.ParseInt(header.Get(HeaderTimestamp), 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if tolerance > 0 && now.Sub(time.Unix(timestamp, 0)).Abs() > tolerance {
+		return ErrInvalidSignature
+	}
+
+	got := header.Get(HeaderSignature)
+	if !strings.HasPrefix(got, signaturePrefix) ||
+		!hmac.Equal([]byte(got), []byte(Sign(secret, timestamp, body))) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
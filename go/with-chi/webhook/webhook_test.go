@@ -0,0 +1,317 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"node-week-02-with-chi/store"
+)
+
+// receiver is a local endpoint that records deliveries and answers with
+// the status returned by respond.
+type receiver struct {
+	mu      sync.Mutex
+	bodies  [][]byte
+	headers []http.Header
+	calls   atomic.Int32
+	respond func(call int) int
+}
+
+func newReceiver(t *testing.T, respond func(call int) int) (*receiver, *httptest.Server) {
+	rec := &receiver{respond: respond}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		call := int(rec.calls.Add(1))
+
+		rec.mu.Lock()
+		rec.bodies = append(rec.bodies, body)
+		rec.headers = append(rec.headers, r.Header.Clone())
+		rec.mu.Unlock()
+
+		w.WriteHeader(rec.respond(call))
+	}))
+	t.Cleanup(ts.Close)
+	return rec, ts
+}
+
+func setupDispatcher(t *testing.T, opts Options) (*Dispatcher, store.MessageStore) {
+	broker := store.NewBroker(16)
+	d := NewDispatcher(opts)
+	// The receivers in these tests listen on loopback.
+	d.Allow(Allowlist{Networks: []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")}})
+	d.Start(broker)
+	t.Cleanup(func() {
+		broker.Close()
+		d.Close()
+	})
+
+	return d, store.NewNotifyingStore(store.NewMemoryStore(), broker)
+}
+
+// eventually polls check until it returns true or a few seconds pass.
+func eventually(t *testing.T, what string, check func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !check() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func fastRetries() Options {
+	return Options{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+}
+
+// Testing delivery of signed events
+func TestDispatcherDelivers(t *testing.T) {
+	d, messages := setupDispatcher(t, fastRetries())
+	rec, ts := newReceiver(t, func(int) int { return http.StatusOK })
+	ctx := context.Background()
+
+	sub, err := d.Subscribe(CreateSubscriptionRequest{URL: ts.URL})
+	if err != nil {
+		t.Fatalf("Subscribe returned error: %v", err)
+	}
+	if sub.Secret == "" {
+		t.Fatal("Expected a generated secret")
+	}
+
+	m, _ := messages.Create(ctx, store.CreateMessageRequest{From: "Bart", Text: "Hi"})
+	messages.Delete(ctx, m.ID, 0)
+
+	eventually(t, "two deliveries", func() bool { return rec.calls.Load() == 2 })
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	types := map[store.EventType]bool{}
+	for i, body := range rec.bodies {
+		header := rec.headers[i]
+		if err := Verify(sub.Secret, header, body, time.Minute, time.Now()); err != nil {
+			t.Errorf("Delivery %d failed verification: %v", i, err)
+		}
+		var event store.Event
+		if err := json.Unmarshal(body, &event); err != nil {
+			t.Fatalf("Failed to unmarshal delivery: %v", err)
+		}
+		if header.Get(HeaderEvent) != string(event.Type) || event.Message.ID != m.ID {
+			t.Errorf("Unexpected delivery %s: %+v", header.Get(HeaderEvent), event)
+		}
+		types[event.Type] = true
+	}
+	if !types[store.MessageCreated] || !types[store.MessageDeleted] {
+		t.Errorf("Expected created and deleted events, got %v", types)
+	}
+
+	eventually(t, "a delivery log", func() bool {
+		deliveries, _ := d.Deliveries(sub.ID)
+		return len(deliveries) == 2 &&
+			deliveries[0].Status == DeliverySucceeded && deliveries[1].Status == DeliverySucceeded
+	})
+}
+
+// Testing subscriptions only receive the events they asked for
+func TestDispatcherFiltersEvents(t *testing.T) {
+	d, messages := setupDispatcher(t, fastRetries())
+	rec, ts := newReceiver(t, func(int) int { return http.StatusNoContent })
+	ctx := context.Background()
+
+	d.Subscribe(CreateSubscriptionRequest{URL: ts.URL, Events: []store.EventType{store.MessageDeleted}})
+
+	m, _ := messages.Create(ctx, store.CreateMessageRequest{From: "Bart", Text: "Hi"})
+	messages.Update(ctx, m.ID, store.CreateMessageRequest{From: "Bart", Text: "Edited"})
+	messages.Delete(ctx, m.ID, 0)
+
+	eventually(t, "the delete delivery", func() bool { return rec.calls.Load() == 1 })
+	time.Sleep(20 * time.Millisecond)
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if len(rec.headers) != 1 || rec.headers[0].Get(HeaderEvent) != string(store.MessageDeleted) {
+		t.Errorf("Expected only the delete event, got %d deliveries", len(rec.headers))
+	}
+}
+
+// Testing failed deliveries are retried until they succeed
+func TestDispatcherRetries(t *testing.T) {
+	d, messages := setupDispatcher(t, fastRetries())
+	rec, ts := newReceiver(t, func(call int) int {
+		if call < 3 {
+			return http.StatusServiceUnavailable
+		}
+		return http.StatusOK
+	})
+
+	sub, _ := d.Subscribe(CreateSubscriptionRequest{URL: ts.URL})
+	messages.Create(context.Background(), store.CreateMessageRequest{From: "Bart", Text: "Hi"})
+
+	var delivery Delivery
+	eventually(t, "a successful retry", func() bool {
+		deliveries, _ := d.Deliveries(sub.ID)
+		if len(deliveries) == 1 {
+			delivery = deliveries[0]
+		}
+		return delivery.Status == DeliverySucceeded
+	})
+
+	if len(delivery.Attempts) != 3 || rec.calls.Load() != 3 {
+		t.Fatalf("Expected 3 attempts, got %+v", delivery.Attempts)
+	}
+	if delivery.Attempts[0].StatusCode != http.StatusServiceUnavailable || delivery.Attempts[0].Error == "" {
+		t.Errorf("Expected the first attempt to log the 503, got %+v", delivery.Attempts[0])
+	}
+	if len(rec.headers) == 3 && rec.headers[0].Get(HeaderID) != rec.headers[2].Get(HeaderID) {
+		t.Errorf("Expected retries to keep the delivery ID")
+	}
+}
+
+// Testing deliveries that run out of attempts are dead-lettered
+func TestDispatcherDeadLetters(t *testing.T) {
+	d, messages := setupDispatcher(t, fastRetries())
+	var healthy atomic.Bool
+	rec, ts := newReceiver(t, func(int) int {
+		if healthy.Load() {
+			return http.StatusOK
+		}
+		return http.StatusInternalServerError
+	})
+
+	d.Subscribe(CreateSubscriptionRequest{URL: ts.URL})
+	messages.Create(context.Background(), store.CreateMessageRequest{From: "Bart", Text: "Hi"})
+
+	eventually(t, "a dead letter", func() bool { return len(d.DeadLetters()) == 1 })
+	dead := d.DeadLetters()[0]
+	if dead.Status != DeliveryDead || len(dead.Attempts) != 3 || rec.calls.Load() != 3 {
+		t.Fatalf("Expected a dead delivery after 3 attempts, got %+v", dead)
+	}
+
+	if _, err := d.Redeliver("missing"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound for an unknown dead letter, got %v", err)
+	}
+
+	healthy.Store(true)
+	if _, err := d.Redeliver(dead.ID); err != nil {
+		t.Fatalf("Redeliver returned error: %v", err)
+	}
+	if len(d.DeadLetters()) != 0 {
+		t.Errorf("Expected the dead letter to leave the list")
+	}
+	eventually(t, "the redelivery", func() bool {
+		deliveries, _ := d.Deliveries(dead.SubscriptionID)
+		return len(deliveries) == 1 && deliveries[0].Status == DeliverySucceeded && len(deliveries[0].Attempts) == 4
+	})
+}
+
+// Testing deleting a subscription cancels its pending retries
+func TestDispatcherUnsubscribeCancels(t *testing.T) {
+	opts := fastRetries()
+	opts.InitialBackoff, opts.MaxBackoff = 100*time.Millisecond, time.Second
+	d, messages := setupDispatcher(t, opts)
+	rec, ts := newReceiver(t, func(int) int { return http.StatusBadGateway })
+
+	sub, _ := d.Subscribe(CreateSubscriptionRequest{URL: ts.URL})
+	messages.Create(context.Background(), store.CreateMessageRequest{From: "Bart", Text: "Hi"})
+	eventually(t, "the first attempt", func() bool { return rec.calls.Load() == 1 })
+
+	if err := d.Unsubscribe(sub.ID); err != nil {
+		t.Fatalf("Unsubscribe returned error: %v", err)
+	}
+	time.Sleep(150 * time.Millisecond)
+	if calls := rec.calls.Load(); calls != 1 {
+		t.Errorf("Expected no retries after unsubscribing, got %d calls", calls)
+	}
+	if _, err := d.Subscription(sub.ID); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+// Testing the backoff doubles and stays under MaxBackoff
+func TestDispatcherBackoff(t *testing.T) {
+	d := NewDispatcher(Options{InitialBackoff: time.Second, MaxBackoff: 10 * time.Second})
+	defer d.Close()
+
+	for attempt, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 5: 10 * time.Second, 100: 10 * time.Second} {
+		got := d.backoff(attempt)
+		if got < want/2 || got > want {
+			t.Errorf("Attempt %d: expected a wait in [%v, %v], got %v", attempt, want/2, want, got)
+		}
+	}
+}
+
+// Testing Verify rejects tampered and stale deliveries
+func TestVerify(t *testing.T) {
+	now := time.Now()
+	body := []byte(`{"seq":1}`)
+	header := http.Header{}
+	header.Set(HeaderTimestamp, "1700000000")
+	header.Set(HeaderSignature, Sign("secret", 1700000000, body))
+
+	if err := Verify("secret", header, body, 0, now); err != nil {
+		t.Errorf("Expected a valid signature, got %v", err)
+	}
+	if err := Verify("other", header, body, 0, now); err != ErrInvalidSignature {
+		t.Errorf("Expected a wrong secret to fail, got %v", err)
+	}
+	if err := Verify("secret", header, []byte(`{"seq":2}`), 0, now); err != ErrInvalidSignature {
+		t.Errorf("Expected a tampered body to fail, got %v", err)
+	}
+	if err := Verify("secret", header, body, time.Minute, now); err != ErrInvalidSignature {
+		t.Errorf("Expected a stale timestamp to fail, got %v", err)
+	}
+}
+
+// Testing redirects from a subscriber are not followed
+func TestDispatcherRefusesRedirects(t *testing.T) {
+	d, messages := setupDispatcher(t, fastRetries())
+	target, internal := newReceiver(t, func(int) int { return http.StatusOK })
+	redirect := httptest.NewServer(http.RedirectHandler(internal.URL, http.StatusTemporaryRedirect))
+	t.Cleanup(redirect.Close)
+
+	d.Subscribe(CreateSubscriptionRequest{URL: redirect.URL})
+	messages.Create(context.Background(), store.CreateMessageRequest{From: "Bart", Text: "Hi"})
+
+	eventually(t, "a dead letter", func() bool { return len(d.DeadLetters()) == 1 })
+	if calls := target.calls.Load(); calls != 0 {
+		t.Errorf("Expected the redirect not to be followed, got %d calls", calls)
+	}
+}
+
+// Testing deliveries only connect to allowlisted internal addresses
+func TestDispatcherGuardsConnections(t *testing.T) {
+	d, messages := setupDispatcher(t, fastRetries())
+	rec, ts := newReceiver(t, func(int) int { return http.StatusOK })
+	ctx := context.Background()
+
+	d.Allow(Allowlist{})
+	d.Subscribe(CreateSubscriptionRequest{URL: ts.URL})
+	messages.Create(ctx, store.CreateMessageRequest{From: "Bart", Text: "Hi"})
+
+	eventually(t, "a dead letter", func() bool { return len(d.DeadLetters()) == 1 })
+	attempts := d.DeadLetters()[0].Attempts
+	if calls := rec.calls.Load(); calls != 0 || !strings.Contains(attempts[0].Error, ErrInternalTarget.Error()) {
+		t.Errorf("Expected the connection to be refused, got %d calls and %+v", calls, attempts)
+	}
+
+	allow, err := ParseAllowlist(" localhost , 10.0.0.0/8,::1")
+	if err != nil || len(allow.Hosts) != 1 || len(allow.Networks) != 2 {
+		t.Fatalf("Unexpected allowlist %+v, %v", allow, err)
+	}
+	if _, err := ParseAllowlist("10.0.0.0/33"); err == nil {
+		t.Error("Expected an invalid network to be rejected")
+	}
+	d.Allow(allow)
+	d.Subscribe(CreateSubscriptionRequest{URL: strings.Replace(ts.URL, "127.0.0.1", "localhost", 1)})
+	messages.Create(ctx, store.CreateMessageRequest{From: "Bart", Text: "Hi again"})
+
+	eventually(t, "a delivery to the allowlisted host", func() bool { return rec.calls.Load() == 1 })
+}